@@ -17,31 +17,44 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
+	"net"
 	"net/http"
 	"net/http/pprof"
 	"os"
 	"os/signal"
 	"runtime"
 	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/KimMachineGun/automemlimit/memlimit"
 	"github.com/jkroepke/access-log-exporter/internal/collector"
 	"github.com/jkroepke/access-log-exporter/internal/config"
+	"github.com/jkroepke/access-log-exporter/internal/metric"
 	"github.com/jkroepke/access-log-exporter/internal/nginx"
+	"github.com/jkroepke/access-log-exporter/internal/push"
 	"github.com/jkroepke/access-log-exporter/internal/syslog"
+	"github.com/jkroepke/access-log-exporter/internal/systemd"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	versioncollector "github.com/prometheus/client_golang/prometheus/collectors/version"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/version"
+	"golang.org/x/sys/unix"
 )
 
 type ReturnCode = int
@@ -55,13 +68,24 @@ const (
 	ReturnCodeOK ReturnCode = 0
 	// ReturnCodeError indicates an error during execution.
 	ReturnCodeError ReturnCode = 1
+	// ReturnCodeWarning indicates a valid configuration with warnings, returned by --verify-config.
+	ReturnCodeWarning ReturnCode = 2
+)
+
+const (
+	defaultTraceCount   = 10
+	maxTraceCount       = 1000
+	defaultTraceTimeout = 30 * time.Second
+
+	// shutdownDrainTimeout limits the time spent processing buffered syslog messages on shutdown or reload.
+	shutdownDrainTimeout = 5 * time.Second
 )
 
 var ErrReload = errors.New("reload")
 
 func main() {
 	termCh := make(chan os.Signal, 1)
-	signal.Notify(termCh, os.Interrupt, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGUSR1)
+	signal.Notify(termCh, os.Interrupt, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
 
 	os.Exit(execute(os.Args, os.Stdout, termCh)) //nolint:forbidigo // entry point
 }
@@ -70,20 +94,33 @@ func main() {
 func execute(args []string, stdout io.Writer, termCh <-chan os.Signal) int {
 	ctx := context.Background()
 
+	var previous *collector.Collector
+
 	for {
-		if returnCode := run(ctx, args, stdout, termCh); returnCode != ReturnCodeReload {
+		returnCode, prometheusCollector := runWithPrevious(ctx, args, stdout, termCh, previous)
+		if returnCode != ReturnCodeReload {
 			return returnCode
 		}
+
+		previous = prometheusCollector
 	}
 }
 
 // run runs the main program logic of the daemon.
+func run(ctx context.Context, args []string, stdout io.Writer, termCh <-chan os.Signal) ReturnCode {
+	returnCode, _ := runWithPrevious(ctx, args, stdout, termCh, nil)
+
+	return returnCode
+}
+
+// runWithPrevious runs the main program logic of the daemon. Unless resetOnReload is set, the series of the previous
+// collector are carried over. On reload, it returns the collector to pass into the next run.
 //
 //nolint:cyclop,gocognit
-func run(ctx context.Context, args []string, stdout io.Writer, termCh <-chan os.Signal) ReturnCode {
+func runWithPrevious(ctx context.Context, args []string, stdout io.Writer, termCh <-chan os.Signal, previous *collector.Collector) (ReturnCode, *collector.Collector) {
 	conf, logger, rc := initializeConfigAndLogger(args, stdout)
 	if rc != ReturnCodeNoError {
-		return rc
+		return rc, nil
 	}
 
 	// initialize the root context with a cancel function
@@ -93,7 +130,25 @@ func run(ctx context.Context, args []string, stdout io.Writer, termCh <-chan os.
 	logger.LogAttrs(ctx, slog.LevelDebug, "config", slog.String("config", conf.String()))
 
 	if conf.VerifyConfig {
-		return ReturnCodeOK
+		return verifyConfig(conf, stdout), nil
+	}
+
+	if conf.DescribePreset {
+		return describePreset(conf.Presets[conf.Preset], stdout), nil
+	}
+
+	if conf.ConfigTestLines != "" {
+		return testLines(conf, stdout), nil
+	}
+
+	if conf.SelfTest {
+		if err := selfTest(conf); err != nil {
+			logger.LogAttrs(ctx, slog.LevelError, "self-test failed", slog.Any("error", err))
+
+			return ReturnCodeError, nil
+		}
+
+		logger.LogAttrs(ctx, slog.LevelInfo, "self-test passed")
 	}
 
 	_, err := memlimit.SetGoMemLimitWithOpts(
@@ -105,11 +160,21 @@ func run(ctx context.Context, args []string, stdout io.Writer, termCh <-chan os.
 
 	syslogMessageBuffer := make(chan syslog.Message, conf.BufferSize)
 
-	syslogServer, err := syslog.New(ctx, logger, conf.Syslog.ListenAddress, syslogMessageBuffer)
+	syslogMetrics := syslog.NewMetrics()
+
+	syslogServer, err := syslog.New(ctx, logger, conf.Syslog.ListenAddress, syslogMessageBuffer,
+		syslog.WithKeepTimestamp(conf.Syslog.KeepTimestamp),
+		syslog.WithKeepTag(conf.Syslog.KeepTag),
+		syslog.WithTLS(conf.Syslog.TLSCertFile, conf.Syslog.TLSKeyFile, conf.Syslog.TLSClientCAFile),
+		syslog.WithMaxMessageSize(conf.Syslog.MaxMessageSize),
+		syslog.WithGzipFrames(conf.Syslog.GzipFrames),
+		syslog.WithSocketPermissions(fs.FileMode(conf.Syslog.SocketMode), conf.Syslog.SocketOwner, conf.Syslog.SocketGroup),
+		syslog.WithMetrics(syslogMetrics),
+	)
 	if err != nil {
 		logger.LogAttrs(ctx, slog.LevelError, "error creating syslog server", slog.Any("error", err))
 
-		return ReturnCodeError
+		return ReturnCodeError, nil
 	}
 
 	go func() {
@@ -118,35 +183,95 @@ func run(ctx context.Context, args []string, stdout io.Writer, termCh <-chan os.
 		cancel(syslogServer.Start())
 	}()
 
-	prometheusCollector, err := collector.New(ctx, logger, conf.Presets[conf.Preset], conf.WorkerCount, syslogMessageBuffer)
+	if conf.ResetOnReload {
+		previous = nil
+	}
+
+	prometheusCollector, err := collector.New(ctx, logger, conf.Presets[conf.Preset], conf.WorkerCount, syslogMessageBuffer,
+		collector.WithBucketSets(conf.BucketSets),
+		collector.WithTenants(conf.Tenants.LineIndex, tenants(conf)),
+		collector.WithMaxLinesPerSecond(conf.Input.MaxLinesPerSecond),
+		collector.WithDelimiter(conf.Input.Delimiter),
+		collector.WithWorkerMetrics(conf.Telemetry.Workers),
+		collector.WithPerMetricMetrics(conf.Telemetry.PerMetric),
+		collector.WithPrevious(previous),
+	)
 	if err != nil {
 		logger.LogAttrs(ctx, slog.LevelError, "error creating collector", slog.Any("error", err))
 
-		return ReturnCodeError
+		return ReturnCodeError, nil
 	}
 
-	reg := setupPrometheusRegistry(conf, logger, prometheusCollector)
-	server := setupServer(conf, logger, reg)
+	reg, err := setupPrometheusRegistry(conf, logger, prometheusCollector)
+	if err == nil {
+		err = register(reg, "syslog", syslogMetrics)
+	}
+
+	if err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "error registering metrics", slog.Any("error", err))
+
+		_ = syslogServer.Close(ctx)
+
+		return ReturnCodeError, nil
+	}
+
+	server := setupServer(conf, logger, reg, prometheusCollector)
+
+	listeners, err := listenWeb(ctx, conf.Web.ListenAddress, conf.Web.ReusePort)
+	if err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "error creating HTTP listener", slog.Any("error", err))
+
+		_ = syslogServer.Close(ctx)
+
+		return ReturnCodeError, nil
+	}
 
 	wg := &sync.WaitGroup{}
 	defer wg.Wait()
 
-	wg.Go(func() {
-		var err error
+	if !conf.Push.URL.IsEmpty() {
+		pusher := push.New(logger, conf.Push.URL.String(), conf.Push.Job, reg,
+			push.WithInterval(conf.Push.Interval),
+			push.WithGrouping(conf.Push.Grouping),
+		)
 
-		if conf.Web.TLSCertFile != "" && conf.Web.TLSKeyFile != "" {
-			logger.InfoContext(ctx, "starting HTTPS server", slog.String("address", conf.Web.ListenAddress))
-			err = server.ListenAndServeTLS(conf.Web.TLSCertFile, conf.Web.TLSKeyFile)
-		} else {
-			logger.InfoContext(ctx, "starting HTTP server", slog.String("address", conf.Web.ListenAddress))
+		wg.Go(func() {
+			logger.InfoContext(ctx, "pushing metrics to pushgateway", slog.String("url", conf.Push.URL.String()))
 
-			err = server.ListenAndServe()
-		}
+			pusher.Run(ctx)
+		})
+	}
 
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			cancel(err)
-		}
-	})
+	if conf.Input.IdleWarningThreshold > 0 {
+		wg.Go(func() {
+			watchIdle(ctx, logger, prometheusCollector, conf.Input)
+		})
+	}
+
+	if conf.WatchConfig {
+		wg.Go(func() {
+			watchConfig(ctx, logger, args, conf.WatchConfigInterval, cancel)
+		})
+	}
+
+	for _, listener := range listeners {
+		wg.Go(func() {
+			var err error
+
+			if conf.Web.TLSCertFile != "" && conf.Web.TLSKeyFile != "" {
+				logger.InfoContext(ctx, "starting HTTPS server", listenerAttrs(listener)...)
+				err = server.ServeTLS(listener, conf.Web.TLSCertFile, conf.Web.TLSKeyFile)
+			} else {
+				logger.InfoContext(ctx, "starting HTTP server", listenerAttrs(listener)...)
+
+				err = server.Serve(listener)
+			}
+
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				cancel(err)
+			}
+		})
+	}
 
 	for {
 		select {
@@ -167,6 +292,18 @@ func run(ctx context.Context, args []string, stdout io.Writer, termCh <-chan os.
 				slog.String("address", conf.Syslog.ListenAddress),
 			)
 
+			drainCtx, drainCancel := context.WithTimeout(context.Background(), shutdownDrainTimeout)
+
+			//nolint:contextcheck
+			drained, dropped := prometheusCollector.Drain(drainCtx, logger, syslogMessageBuffer)
+
+			drainCancel()
+
+			logger.LogAttrs(ctx, slog.LevelInfo, "drained syslog message buffer",
+				slog.Int("drained", drained),
+				slog.Int("dropped", dropped),
+			)
+
 			serverShutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 			//nolint:contextcheck
@@ -181,26 +318,28 @@ func run(ctx context.Context, args []string, stdout io.Writer, termCh <-chan os.
 			err = context.Cause(ctx)
 			if err != nil {
 				if errors.Is(err, context.Canceled) {
-					return ReturnCodeOK
+					return ReturnCodeOK, nil
 				}
 
 				if errors.Is(err, ErrReload) {
-					return ReturnCodeReload
+					return ReturnCodeReload, prometheusCollector
 				}
 
 				logger.ErrorContext(ctx, err.Error())
 
-				return ReturnCodeError
+				return ReturnCodeError, nil
 			}
 
-			return ReturnCodeOK
+			return ReturnCodeOK, nil
 		case sig := <-termCh:
 			logger.LogAttrs(ctx, slog.LevelInfo, "receiving signal: "+sig.String())
 
-			switch sig {
-			case syscall.SIGHUP:
+			switch {
+			case slices.Contains(conf.Signal.Reload, signalName(sig)):
 				logger.LogAttrs(ctx, slog.LevelInfo, "reloading configuration")
 				cancel(ErrReload)
+			case sig == syscall.SIGUSR1 || sig == syscall.SIGUSR2 || sig == syscall.SIGHUP:
+				logger.LogAttrs(ctx, slog.LevelWarn, "ignoring signal, not configured to trigger a reload: "+sig.String())
 			default:
 				cancel(nil)
 			}
@@ -208,42 +347,134 @@ func run(ctx context.Context, args []string, stdout io.Writer, termCh <-chan os.
 	}
 }
 
-func setupPrometheusRegistry(conf config.Config, logger *slog.Logger, prometheusCollector *collector.Collector) *prometheus.Registry {
+// signalName returns the name of the signals which can be configured to trigger a reload, e.g. SIGHUP.
+func signalName(sig os.Signal) string {
+	switch sig {
+	case syscall.SIGHUP:
+		return "SIGHUP"
+	case syscall.SIGUSR1:
+		return "SIGUSR1"
+	case syscall.SIGUSR2:
+		return "SIGUSR2"
+	default:
+		return sig.String()
+	}
+}
+
+// setupPrometheusRegistry registers all collectors except the syslog metrics on a new registry.
+// It returns an error if metrics conflict, e.g. a preset metric named like a built-in metric.
+func setupPrometheusRegistry(conf config.Config, logger *slog.Logger, prometheusCollector *collector.Collector) (*prometheus.Registry, error) {
 	prometheus.DefaultGatherer = nil   // Disable default gatherer to avoid conflicts with custom registry
 	prometheus.DefaultRegisterer = nil // Disable default registerer to avoid conflicts with custom registry
 
 	reg := prometheus.NewRegistry()
-	reg.MustRegister(
-		collectors.NewGoCollector(),
-		collectors.NewBuildInfoCollector(),
-		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
-		versioncollector.NewCollector("access_log_exporter"),
-		prometheusCollector,
+
+	if err := register(reg, "version", versioncollector.NewCollector("access_log_exporter")); err != nil {
+		return nil, err
+	}
+
+	if err := register(reg, "preset", prometheusCollector); err != nil {
+		return nil, err
+	}
+
+	if conf.Telemetry.Config {
+		if err := register(reg, "config telemetry", config.Collectors()...); err != nil {
+			return nil, err
+		}
+	}
+
+	var builtinReg prometheus.Registerer = reg
+	if conf.Metrics.BuiltinNamespace != "" {
+		builtinReg = prometheus.WrapRegistererWithPrefix(conf.Metrics.BuiltinNamespace+"_", reg)
+	}
+
+	if conf.Telemetry.Runtime {
+		err := register(builtinReg, "runtime",
+			collectors.NewGoCollector(),
+			collectors.NewBuildInfoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	nginxTLSConfig, err := nginx.NewTLSConfig(
+		conf.Nginx.ScrapeCAFile, conf.Nginx.ScrapeCertFile, conf.Nginx.ScrapeKeyFile, conf.Nginx.ScrapeInsecureSkipVerify,
 	)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // describes the failing nginx scrape option
+	}
 
-	if !conf.Nginx.ScrapeURL.IsEmpty() {
-		reg.MustRegister(nginx.New(logger, conf.Nginx.ScrapeURL.String(), nginx.WithTimeout(conf.Nginx.ScrapeTimeout)))
+	nginxOptions := []nginx.Option{
+		nginx.WithTimeout(conf.Nginx.ScrapeTimeout),
+		nginx.WithBasicAuth(conf.Nginx.ScrapeUsername, conf.Nginx.ScrapePassword),
+		nginx.WithTLSConfig(nginxTLSConfig),
+		nginx.WithCacheDuration(conf.Nginx.CacheDuration),
+	}
+
+	if scrapeTargets := conf.Nginx.ScrapeTargets(); len(scrapeTargets) > 0 {
+		err := register(reg, "nginx", nginx.New(logger, scrapeTargets, nginxOptions...))
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return reg
+	if !conf.Nginx.PlusAPIURL.IsEmpty() {
+		err := register(reg, "nginx plus", nginx.NewPlus(logger, conf.Nginx.PlusAPIURL.String(), nginxOptions...))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return reg, nil
+}
+
+// register registers the collectors on reg. Unlike [prometheus.Registerer.MustRegister], it returns an error naming
+// the kind of the conflicting collectors instead of panicking. The error of the registry names the conflicting metric.
+func register(reg prometheus.Registerer, name string, cs ...prometheus.Collector) error {
+	for _, c := range cs {
+		if err := reg.Register(c); err != nil {
+			return fmt.Errorf("could not register %s metrics: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// tenants resolves the presets of the configured tenants.
+func tenants(conf config.Config) []collector.Tenant {
+	tenants := make([]collector.Tenant, 0, len(conf.Tenants.Presets))
+
+	for _, tenant := range conf.Tenants.Presets {
+		tenants = append(tenants, collector.Tenant{
+			Preset:    conf.Presets[tenant.Preset],
+			Value:     tenant.Value,
+			Namespace: tenant.Namespace,
+		})
+	}
+
+	return tenants
 }
 
 // setupServer initializes the HTTP server with the given configuration and logger.
-func setupServer(conf config.Config, logger *slog.Logger, reg *prometheus.Registry) *http.Server {
+func setupServer(conf config.Config, logger *slog.Logger, reg *prometheus.Registry, prometheusCollector *collector.Collector) *http.Server {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /health", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
+	mux.HandleFunc("GET /-/ready", readyHandler(prometheusCollector, conf.Web, time.Now))
 
-	mux.Handle("GET /metrics", promhttp.InstrumentMetricHandler(reg, promhttp.HandlerFor(
+	mux.Handle("GET /metrics", protobufNegotiation(conf.Metrics.Protobuf, promhttp.InstrumentMetricHandler(reg, promhttp.HandlerFor(
 		prometheus.Gatherers{reg},
 		promhttp.HandlerOpts{
-			ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
-			ErrorHandling:     promhttp.ContinueOnError,
-			Registry:          reg,
-			EnableOpenMetrics: true,
+			ErrorLog:                            slog.NewLogLogger(logger.Handler(), slog.LevelError),
+			ErrorHandling:                       promhttp.ContinueOnError,
+			Registry:                            reg,
+			EnableOpenMetrics:                   true,
+			EnableOpenMetricsTextCreatedSamples: conf.Metrics.CreatedTimestamps,
 		},
-	)))
+	))))
 
 	// Start debug listener if enabled
 	if conf.Debug.Enable {
@@ -253,10 +484,10 @@ func setupServer(conf config.Config, logger *slog.Logger, reg *prometheus.Regist
 		mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
 		mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
 		mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+		mux.HandleFunc("GET /-/trace", traceHandler(logger, prometheusCollector))
 	}
 
 	server := &http.Server{
-		Addr:              conf.Web.ListenAddress,
 		ReadHeaderTimeout: 3 * time.Second,
 		ReadTimeout:       3 * time.Second,
 		WriteTimeout:      10 * time.Second,
@@ -267,6 +498,363 @@ func setupServer(conf config.Config, logger *slog.Logger, reg *prometheus.Regist
 	return server
 }
 
+// protobufNegotiation rewrites the Accept header of metric requests to force or disable the protobuf format,
+// see [config.Metrics.Protobuf]. In auto mode, promhttp negotiates the format as requested by the scraper.
+func protobufNegotiation(mode string, next http.Handler) http.Handler {
+	switch mode {
+	case config.ProtobufForce:
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("Accept", string(expfmt.NewFormat(expfmt.TypeProtoDelim)))
+			next.ServeHTTP(w, r)
+		})
+	case config.ProtobufDisable:
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accept := strings.Split(r.Header.Get("Accept"), ",")
+			accept = slices.DeleteFunc(accept, func(mediaType string) bool {
+				return strings.HasPrefix(strings.TrimSpace(mediaType), "application/vnd.google.protobuf")
+			})
+
+			r.Header.Set("Accept", strings.Join(accept, ","))
+			next.ServeHTTP(w, r)
+		})
+	default:
+		return next
+	}
+}
+
+// readyHandler reports whether log messages are flowing.
+// It returns 503 if no log message was received within the stale threshold. A threshold of 0 disables the check.
+// If a maximum error ratio is set, it also returns 503 once the ratio of lines failing to parse since the previous request
+// exceeded it for longer than the grace period.
+func readyHandler(prometheusCollector *collector.Collector, web config.Web, now func() time.Time) http.HandlerFunc {
+	var parseErrors errorRatio
+
+	return func(w http.ResponseWriter, _ *http.Request) {
+		if web.StaleThreshold > 0 {
+			if age := now().Sub(prometheusCollector.LastReceived()); age > web.StaleThreshold {
+				http.Error(w, fmt.Sprintf("no log message received for %s", age.Truncate(time.Second)), http.StatusServiceUnavailable)
+
+				return
+			}
+		}
+
+		if web.ReadyMaxErrorRatio > 0 {
+			parsed, failed := prometheusCollector.ParseStats()
+			checked := now()
+
+			ratio, since, exceeded := parseErrors.check(parsed, failed, web.ReadyMaxErrorRatio, checked)
+			if duration := checked.Sub(since); exceeded && duration > web.ReadyErrorGracePeriod {
+				http.Error(w, fmt.Sprintf("%.0f%% of log lines failed to parse for %s", ratio*100, duration.Truncate(time.Second)), http.StatusServiceUnavailable)
+
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// errorRatio tracks the ratio of lines failing to parse between two readiness checks.
+type errorRatio struct {
+	exceededSince time.Time
+	ratio         float64
+	parsed        uint64
+	failed        uint64
+	mu            sync.Mutex
+}
+
+// check returns the ratio of lines failing to parse since the previous check and,
+// if it exceeds maxRatio, since when it does so without interruption.
+// Checks without parsed lines in between keep the previous state.
+func (e *errorRatio) check(parsed, failed uint64, maxRatio float64, now time.Time) (float64, time.Time, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// The counters start from scratch with each collector, e.g. after a reload.
+	if parsed < e.parsed {
+		e.parsed, e.failed = 0, 0
+	}
+
+	parsedDelta := parsed - e.parsed
+	failedDelta := failed - e.failed
+
+	if parsedDelta == 0 {
+		return e.ratio, e.exceededSince, !e.exceededSince.IsZero()
+	}
+
+	e.parsed, e.failed = parsed, failed
+	e.ratio = float64(failedDelta) / float64(parsedDelta)
+
+	if e.ratio <= maxRatio {
+		e.exceededSince = time.Time{}
+
+		return e.ratio, e.exceededSince, false
+	}
+
+	if e.exceededSince.IsZero() {
+		e.exceededSince = now
+	}
+
+	return e.ratio, e.exceededSince, true
+}
+
+// watchIdle logs a warning while no log message was received within the idle warning threshold,
+// at most once per idle warning interval, until ctx is done.
+func watchIdle(ctx context.Context, logger *slog.Logger, prometheusCollector *collector.Collector, input config.Input) {
+	warning := idleWarning{threshold: input.IdleWarningThreshold, interval: input.IdleWarningInterval}
+
+	ticker := time.NewTicker(min(input.IdleWarningThreshold, input.IdleWarningInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			warning.check(ctx, logger, prometheusCollector.LastReceived(), now)
+		}
+	}
+}
+
+// idleWarning rate limits the warnings about missing log messages.
+type idleWarning struct {
+	warned    time.Time
+	threshold time.Duration
+	interval  time.Duration
+}
+
+// check logs a warning if the last log message was received longer than the threshold ago,
+// unless a warning was already logged within the interval. It reports whether a warning was logged.
+func (i *idleWarning) check(ctx context.Context, logger *slog.Logger, lastReceived, now time.Time) bool {
+	age := now.Sub(lastReceived)
+	if age <= i.threshold {
+		i.warned = time.Time{}
+
+		return false
+	}
+
+	if !i.warned.IsZero() && now.Sub(i.warned) < i.interval {
+		return false
+	}
+
+	i.warned = now
+
+	logger.LogAttrs(ctx, slog.LevelWarn, "no log message received",
+		slog.Duration("age", age.Truncate(time.Second)),
+		slog.Time("last_received", lastReceived),
+	)
+
+	return true
+}
+
+// traceHandler captures the parse results of the next incoming lines and returns them as JSON.
+// The number of lines can be set with the count query parameter, the maximum wait time with the timeout query parameter.
+// If the timeout is reached, the lines captured so far are returned.
+func traceHandler(logger *slog.Logger, prometheusCollector *collector.Collector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		count := defaultTraceCount
+
+		if countParam := r.URL.Query().Get("count"); countParam != "" {
+			var err error
+
+			count, err = strconv.Atoi(countParam)
+			if err != nil || count <= 0 || count > maxTraceCount {
+				http.Error(w, fmt.Sprintf("count must be a number between 1 and %d", maxTraceCount), http.StatusBadRequest)
+
+				return
+			}
+		}
+
+		timeout := defaultTraceTimeout
+
+		if timeoutParam := r.URL.Query().Get("timeout"); timeoutParam != "" {
+			var err error
+
+			timeout, err = time.ParseDuration(timeoutParam)
+			if err != nil || timeout <= 0 {
+				http.Error(w, "timeout must be a positive duration", http.StatusBadRequest)
+
+				return
+			}
+		}
+
+		// The trace may outlast the write timeout of the server.
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 10*time.Second))
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		lines, err := prometheusCollector.Trace(ctx, count)
+		if errors.Is(err, collector.ErrTraceInProgress) {
+			http.Error(w, err.Error(), http.StatusConflict)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(lines); err != nil {
+			logger.LogAttrs(r.Context(), slog.LevelError, "error writing trace response", slog.Any("error", err))
+		}
+	}
+}
+
+// watchConfig polls the config files every interval and triggers a reload by cancelling ctx with [ErrReload]
+// once a change is stable, until ctx is done. Polling also detects the symlink swap of a mounted Kubernetes ConfigMap.
+// A changed configuration failing to load keeps the running configuration until the files change again.
+func watchConfig(ctx context.Context, logger *slog.Logger, args []string, interval time.Duration, cancel context.CancelCauseFunc) {
+	paths := config.Files(args)
+	watcher := configWatcher{loaded: configFileStates(paths)}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			states := configFileStates(paths)
+			if !watcher.check(states) {
+				continue
+			}
+
+			if _, err := setupConfiguration(args, io.Discard); err != nil {
+				logger.LogAttrs(ctx, slog.LevelError, "config file changed, but failed to load, keeping the running configuration",
+					slog.Any("files", paths),
+					slog.Any("error", err),
+				)
+
+				watcher.loaded = states
+				watcher.pending = nil
+
+				continue
+			}
+
+			logger.LogAttrs(ctx, slog.LevelInfo, "config file changed, reloading configuration",
+				slog.Any("files", paths),
+			)
+			cancel(ErrReload)
+
+			return
+		}
+	}
+}
+
+// configFileState is the modification time and size of a config file. A missing file has a zero state.
+type configFileState struct {
+	modTime int64
+	size    int64
+}
+
+func configFileStates(paths []string) []configFileState {
+	states := make([]configFileState, len(paths))
+
+	for i, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			states[i] = configFileState{modTime: info.ModTime().UnixNano(), size: info.Size()}
+		}
+	}
+
+	return states
+}
+
+// configWatcher debounces the changes of the config files, since editors and ConfigMap updates
+// may write a file in several steps.
+type configWatcher struct {
+	loaded  []configFileState
+	pending []configFileState
+}
+
+// check reports whether the config files changed since they were loaded and didn't change since the previous check.
+// Changes are ignored while a file is missing, e.g. in the middle of a replacement.
+func (w *configWatcher) check(states []configFileState) bool {
+	if slices.Equal(states, w.loaded) || slices.Contains(states, configFileState{}) {
+		w.pending = nil
+
+		return false
+	}
+
+	if !slices.Equal(states, w.pending) {
+		w.pending = states
+
+		return false
+	}
+
+	return true
+}
+
+// listenWeb opens a listener for each configured web listen address.
+// Addresses starting with unix:// are bound as unix domain sockets, addresses starting with systemd://
+// use a socket passed by systemd socket activation, all others are bound as TCP.
+func listenWeb(ctx context.Context, addresses []string, reusePort bool) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(addresses))
+
+	for _, address := range addresses {
+		listener, err := listenWebAddress(ctx, address, reusePort)
+		if err != nil {
+			for _, listener := range listeners {
+				_ = listener.Close()
+			}
+
+			return nil, fmt.Errorf("could not listen on '%s': %w", address, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
+// listenerAttrs returns the log attributes for the resolved address of a listener.
+// For TCP listeners, the port is included, which is chosen by the operating system if the configured port is 0.
+func listenerAttrs(listener net.Listener) []any {
+	attrs := []any{slog.String("address", listener.Addr().String())}
+
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		attrs = append(attrs, slog.Int("port", addr.Port))
+	}
+
+	return attrs
+}
+
+func listenWebAddress(ctx context.Context, address string, reusePort bool) (net.Listener, error) {
+	if name, ok := strings.CutPrefix(address, "systemd://"); ok {
+		return systemd.Listener(name) //nolint:wrapcheck // wrapped by caller
+	}
+
+	var listenConf net.ListenConfig
+
+	network := "tcp"
+	if socketPath, ok := strings.CutPrefix(address, "unix://"); ok {
+		network = "unix"
+		address = socketPath
+	} else if reusePort {
+		listenConf.Control = setReusePort
+	}
+
+	return listenConf.Listen(ctx, network, address) //nolint:wrapcheck // wrapped by caller
+}
+
+// setReusePort sets SO_REUSEPORT on a socket, so several processes can bind the same port,
+// e.g. the old and the new instance during a blue/green restart.
+func setReusePort(_, _ string, conn syscall.RawConn) error {
+	var sockErr error
+
+	err := conn.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err //nolint:wrapcheck // wrapped by caller
+	}
+
+	if sockErr != nil {
+		return fmt.Errorf("could not set SO_REUSEPORT: %w", sockErr)
+	}
+
+	return nil
+}
+
 // initializeConfigAndLogger handles configuration parsing and logger setup.
 func initializeConfigAndLogger(args []string, stdout io.Writer) (config.Config, *slog.Logger, ReturnCode) {
 	conf, err := setupConfiguration(args, stdout)
@@ -310,6 +898,413 @@ func setupConfiguration(args []string, logWriter io.Writer) (config.Config, erro
 	return conf, nil
 }
 
+// describePreset prints a table of the field indices used by each metric of the preset.
+func describePreset(preset config.Preset, writer io.Writer) ReturnCode {
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(table, "METRIC\tKIND\tNAME\tINDEX")
+
+	for _, metric := range preset.Metrics {
+		if metric.ValueIndex != nil {
+			_, _ = fmt.Fprintf(table, "%s\tvalue\t-\t%d\n", metric.Name, *metric.ValueIndex)
+		}
+
+		// Metrics of json presets select fields by name instead of index.
+		if metric.ValueField != "" {
+			_, _ = fmt.Fprintf(table, "%s\tvalue\t-\t%s\n", metric.Name, metric.ValueField)
+		}
+
+		if metric.RatioIndices != nil {
+			_, _ = fmt.Fprintf(table, "%s\tratio\tnumerator\t%d\n", metric.Name, metric.RatioIndices[0])
+			_, _ = fmt.Fprintf(table, "%s\tratio\tdenominator\t%d\n", metric.Name, metric.RatioIndices[1])
+		}
+
+		for _, label := range metric.Labels {
+			if label.Field != "" {
+				_, _ = fmt.Fprintf(table, "%s\tlabel\t%s\t%s\n", metric.Name, label.Name, label.Field)
+
+				continue
+			}
+
+			_, _ = fmt.Fprintf(table, "%s\tlabel\t%s\t%d\n", metric.Name, label.Name, label.LineIndex)
+		}
+
+		if metric.Upstream.Enabled {
+			_, _ = fmt.Fprintf(table, "%s\tupstream\taddr\t%d\n", metric.Name, metric.Upstream.AddrLineIndex)
+
+			if metric.Upstream.StatusLineIndex != nil {
+				_, _ = fmt.Fprintf(table, "%s\tupstream\tstatus\t%d\n", metric.Name, *metric.Upstream.StatusLineIndex)
+			}
+		}
+	}
+
+	if err := table.Flush(); err != nil {
+		return ReturnCodeError
+	}
+
+	return ReturnCodeOK
+}
+
+// verifyConfig prints a summary of all presets and the configuration warnings.
+// It returns ReturnCodeWarning if there are any warnings.
+func verifyConfig(conf config.Config, writer io.Writer) ReturnCode {
+	for _, name := range slices.Sorted(maps.Keys(conf.Presets)) {
+		active := ""
+		if name == conf.Preset {
+			active = " (active)"
+		}
+
+		_, _ = fmt.Fprintf(writer, "preset '%s'%s: %d metrics\n", name, active, len(conf.Presets[name].Metrics))
+	}
+
+	warnings := config.Warnings(conf)
+	for _, warning := range warnings {
+		_, _ = fmt.Fprintf(writer, "warning: %s\n", warning)
+	}
+
+	if !verifySamples(conf, writer) {
+		return ReturnCodeError
+	}
+
+	if len(warnings) != 0 {
+		return ReturnCodeWarning
+	}
+
+	_, _ = fmt.Fprintln(writer, "configuration is valid")
+
+	return ReturnCodeOK
+}
+
+// verifySamples parses the sample lines of each preset and prints an error for each metric failing to parse one,
+// e.g. because valueIndex points to a non-numeric field. It reports whether all samples parsed.
+func verifySamples(conf config.Config, writer io.Writer) bool {
+	valid := true
+
+	for _, name := range slices.Sorted(maps.Keys(conf.Presets)) {
+		preset := conf.Presets[name]
+		if len(preset.Samples) == 0 {
+			continue
+		}
+
+		prometheusCollector, err := collector.New(context.Background(), slog.New(slog.DiscardHandler), preset, 0, nil,
+			collector.WithBucketSets(conf.BucketSets),
+			collector.WithDelimiter(conf.Input.Delimiter),
+		)
+		if err != nil {
+			_, _ = fmt.Fprintf(writer, "error: preset '%s': %v\n", name, err)
+			valid = false
+
+			continue
+		}
+
+		for i, sample := range preset.Samples {
+			traceLine, err := prometheusCollector.Explain(sample)
+			if err != nil {
+				_, _ = fmt.Fprintf(writer, "error: preset '%s', sample %d: %v\n", name, i, err)
+				valid = false
+
+				continue
+			}
+
+			for _, result := range traceLine.Metrics {
+				if result.Error != "" {
+					_, _ = fmt.Fprintf(writer, "error: preset '%s', sample %d, metric '%s': %s\n", name, i, result.Metric, result.Error)
+					valid = false
+				}
+			}
+		}
+
+		prometheusCollector.Close()
+	}
+
+	return valid
+}
+
+// testLines feeds the lines of conf.ConfigTestLines to the active preset and prints the resulting metrics.
+// If conf.ConfigTestExpected is set, it compares the metrics with the expected ones instead and prints a diff on mismatch.
+// Lines failing to parse are printed, but don't fail the test, since the expected metrics cover them.
+func testLines(conf config.Config, writer io.Writer) ReturnCode {
+	lines, err := os.ReadFile(conf.ConfigTestLines)
+	if err != nil {
+		_, _ = fmt.Fprintf(writer, "error: %v\n", err)
+
+		return ReturnCodeError
+	}
+
+	prometheusCollector, err := collector.New(context.Background(), slog.New(slog.DiscardHandler), conf.Presets[conf.Preset], 0, nil,
+		collector.WithBucketSets(conf.BucketSets),
+		collector.WithDelimiter(conf.Input.Delimiter),
+		collector.WithTenants(conf.Tenants.LineIndex, tenants(conf)),
+	)
+	if err != nil {
+		_, _ = fmt.Fprintf(writer, "error: preset '%s': %v\n", conf.Preset, err)
+
+		return ReturnCodeError
+	}
+
+	defer prometheusCollector.Close()
+
+	var actual string
+
+	if conf.ConfigTestFormat == config.ConfigTestFormatJSONL {
+		actual, err = explainLines(prometheusCollector, string(lines))
+	} else {
+		for i, line := range strings.Split(string(lines), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+
+			if err = prometheusCollector.Feed(line); err != nil {
+				_, _ = fmt.Fprintf(writer, "error: line %d: %v\n", i+1, err)
+			}
+		}
+
+		actual, err = presetExposition(prometheusCollector)
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintf(writer, "error: %v\n", err)
+
+		return ReturnCodeError
+	}
+
+	if conf.ConfigTestExpected == "" {
+		_, _ = io.WriteString(writer, actual)
+
+		return ReturnCodeOK
+	}
+
+	expected, err := os.ReadFile(conf.ConfigTestExpected)
+	if err != nil {
+		_, _ = fmt.Fprintf(writer, "error: %v\n", err)
+
+		return ReturnCodeError
+	}
+
+	if diff := diffLines(string(expected), actual); diff != "" {
+		_, _ = fmt.Fprintf(writer, "metrics don't match %s:\n%s", conf.ConfigTestExpected, diff)
+
+		return ReturnCodeError
+	}
+
+	_, _ = fmt.Fprintln(writer, "metrics match")
+
+	return ReturnCodeOK
+}
+
+// observation is a line of the jsonl output of --config-test-lines: the parse result of a metric for the line with the given number.
+type observation struct {
+	metric.TraceResult
+
+	Line int `json:"line"`
+}
+
+// explainLines returns the parse result of each metric for each line as JSON lines, see [collector.Collector.Explain].
+// Skipped metrics are omitted. Lines failing to parse, e.g. invalid JSON in a json preset, have an error only.
+func explainLines(prometheusCollector *collector.Collector, lines string) (string, error) {
+	var buf strings.Builder
+
+	encoder := json.NewEncoder(&buf)
+
+	for i, line := range strings.Split(lines, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		explained, err := prometheusCollector.Explain(line)
+		if err != nil {
+			if err = encoder.Encode(observation{TraceResult: metric.TraceResult{Error: err.Error()}, Line: i + 1}); err != nil {
+				return "", fmt.Errorf("error encoding observation: %w", err)
+			}
+
+			continue
+		}
+
+		for _, result := range explained.Metrics {
+			if result.Skipped {
+				continue
+			}
+
+			if err = encoder.Encode(observation{TraceResult: result, Line: i + 1}); err != nil {
+				return "", fmt.Errorf("error encoding observation: %w", err)
+			}
+		}
+	}
+
+	return buf.String(), nil
+}
+
+// presetExposition returns the metrics of the preset in the Prometheus text format.
+func presetExposition(prometheusCollector *collector.Collector) (string, error) {
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(prometheusCollector.PresetMetrics()); err != nil {
+		return "", fmt.Errorf("error registering metrics: %w", err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		return "", fmt.Errorf("error gathering metrics: %w", err)
+	}
+
+	var buf strings.Builder
+
+	encoder := expfmt.NewEncoder(&buf, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if err = encoder.Encode(family); err != nil {
+			return "", fmt.Errorf("error encoding metrics: %w", err)
+		}
+	}
+
+	return buf.String(), nil
+}
+
+// diffLines returns the lines of expected missing in actual prefixed by "-", and the lines of actual missing in expected
+// prefixed by "+". Since the exposition is sorted, the order of lines is ignored. It returns an empty string on a match.
+func diffLines(expected, actual string) string {
+	expectedLines := strings.Split(strings.TrimSpace(expected), "\n")
+	actualLines := strings.Split(strings.TrimSpace(actual), "\n")
+
+	var diff strings.Builder
+
+	for _, line := range expectedLines {
+		if !slices.Contains(actualLines, line) {
+			_, _ = fmt.Fprintf(&diff, "- %s\n", line)
+		}
+	}
+
+	for _, line := range actualLines {
+		if !slices.Contains(expectedLines, line) {
+			_, _ = fmt.Fprintf(&diff, "+ %s\n", line)
+		}
+	}
+
+	return diff.String()
+}
+
+// selfTest feeds the samples of the active preset, or a synthetic line if there are none, through a separate collector.
+// It returns an error if no metric records an observation, e.g. because of wrong field indices.
+func selfTest(conf config.Config) error {
+	preset := conf.Presets[conf.Preset]
+
+	prometheusCollector, err := collector.New(context.Background(), slog.New(slog.DiscardHandler), preset, 0, nil,
+		collector.WithBucketSets(conf.BucketSets),
+		collector.WithDelimiter(conf.Input.Delimiter),
+	)
+	if err != nil {
+		return fmt.Errorf("preset '%s': %w", conf.Preset, err)
+	}
+
+	defer prometheusCollector.Close()
+
+	lines := preset.Samples
+	if len(lines) == 0 {
+		lines = []string{syntheticLine(preset, conf.Input.Delimiter)}
+	}
+
+	errs := make([]error, 0, len(lines))
+
+	for _, line := range lines {
+		if err = prometheusCollector.Feed(line); err != nil {
+			errs = append(errs, fmt.Errorf("line %q: %w", line, err))
+		}
+	}
+
+	reg := prometheus.NewRegistry()
+	if err = reg.Register(prometheusCollector); err != nil {
+		return fmt.Errorf("error registering metrics: %w", err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		return fmt.Errorf("error gathering metrics: %w", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "log_metric_observations_total" {
+			continue
+		}
+
+		for _, observations := range family.GetMetric() {
+			if observations.GetCounter().GetValue() > 0 {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("preset '%s' produced no metric from %d lines: %w", conf.Preset, len(lines), errors.Join(errs...))
+}
+
+// syntheticLine returns a log line for the preset, in which each field used by a metric is 1.
+// Presets with a formatIndex get the format of the first metric with a format.
+func syntheticLine(preset config.Preset, delimiter string) string {
+	if preset.Format == config.PresetFormatJSON {
+		fields := make(map[string]string)
+
+		for _, metric := range preset.Metrics {
+			if metric.ValueField != "" {
+				fields[metric.ValueField] = "1"
+			}
+
+			for _, label := range metric.Labels {
+				if label.Field != "" {
+					fields[label.Field] = "1"
+				}
+			}
+		}
+
+		line, _ := json.Marshal(fields) //nolint:errchkjson // map of strings
+
+		return string(line)
+	}
+
+	var maxIndex uint
+
+	for _, metric := range preset.Metrics {
+		for _, index := range []*uint{metric.ValueIndex, metric.RequireNonEmptyIndex, metric.Upstream.StatusLineIndex} {
+			if index != nil {
+				maxIndex = max(maxIndex, *index)
+			}
+		}
+
+		if metric.RatioIndices != nil {
+			maxIndex = max(maxIndex, metric.RatioIndices[0], metric.RatioIndices[1])
+		}
+
+		if metric.Upstream.Enabled {
+			maxIndex = max(maxIndex, metric.Upstream.AddrLineIndex)
+		}
+
+		for _, label := range metric.Labels {
+			maxIndex = max(maxIndex, label.LineIndex)
+		}
+	}
+
+	if preset.FormatIndex != nil {
+		maxIndex = max(maxIndex, *preset.FormatIndex)
+	}
+
+	fields := make([]string, maxIndex+1)
+	for i := range fields {
+		fields[i] = "1"
+	}
+
+	if preset.FormatIndex != nil {
+		for _, metric := range preset.Metrics {
+			if metric.Format != "" {
+				fields[*preset.FormatIndex] = metric.Format
+
+				break
+			}
+		}
+	}
+
+	if delimiter == "" {
+		delimiter = "\t"
+	}
+
+	return strings.Join(fields, delimiter)
+}
+
 func printVersion(writer io.Writer) {
 	//goland:noinspection GoBoolExpressions
 	if version.Version == "" {
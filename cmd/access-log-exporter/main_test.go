@@ -2,10 +2,33 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/jkroepke/access-log-exporter/internal/collector"
+	"github.com/jkroepke/access-log-exporter/internal/config"
+	"github.com/jkroepke/access-log-exporter/internal/metric"
+	"github.com/jkroepke/access-log-exporter/internal/syslog"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/nettest"
 )
 
 func TestHelpFlag(t *testing.T) {
@@ -124,3 +147,1468 @@ func TestVerifyConfig(t *testing.T) {
 	}, stdout, nil)
 	require.Equal(t, ReturnCodeOK, returnCode, stdout)
 }
+
+func TestDescribePreset(t *testing.T) {
+	t.Parallel()
+
+	stdout := &bytes.Buffer{}
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	moduleRoot, err := findModuleRoot(wd)
+	require.NoError(t, err)
+
+	returnCode := run(t.Context(), []string{
+		"access-log-exporter",
+		"--config=" + moduleRoot + "/packaging/etc/access-log-exporter/config.yaml",
+		"--preset=simple",
+		"--describe-preset",
+	}, stdout, nil)
+	require.Equal(t, ReturnCodeOK, returnCode, stdout)
+	require.Equal(t, `METRIC                         KIND   NAME    INDEX
+http_requests_total            label  host    0
+http_requests_total            label  method  1
+http_requests_total            label  status  2
+http_requests_completed_total  value  -       3
+http_requests_completed_total  label  host    0
+http_requests_completed_total  label  method  1
+http_requests_completed_total  label  status  2
+http_request_size_bytes        value  -       5
+http_request_size_bytes        label  host    0
+http_request_size_bytes        label  method  1
+http_request_size_bytes        label  status  2
+http_response_size_bytes       value  -       6
+http_response_size_bytes       label  host    0
+http_response_size_bytes       label  method  1
+http_response_size_bytes       label  status  2
+http_request_duration_seconds  value  -       4
+http_request_duration_seconds  label  host    0
+http_request_duration_seconds  label  method  1
+http_request_duration_seconds  label  status  2
+`, stdout.String())
+}
+
+func TestVerifyConfigWarnings(t *testing.T) {
+	t.Parallel()
+
+	stdout := &bytes.Buffer{}
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+preset: simple
+presets:
+  empty:
+    metrics: []
+  simple:
+    metrics:
+      - name: "http_requests_total"
+        type: "counter"
+        help: "The total number of client requests."
+        buckets: [0.1, 1]
+`), 0o600))
+
+	returnCode := run(t.Context(), []string{
+		"access-log-exporter",
+		"--config=" + configFile,
+		"--verify-config",
+	}, stdout, nil)
+	require.Equal(t, ReturnCodeWarning, returnCode, stdout)
+	require.Equal(t, `preset 'empty': 0 metrics
+preset 'simple' (active): 1 metrics
+warning: preset 'empty': preset does not define any metrics
+warning: preset 'simple', metric 'http_requests_total': buckets are ignored for counter metrics
+`, stdout.String())
+}
+
+func TestVerifyConfigSamples(t *testing.T) {
+	t.Parallel()
+
+	stdout := &bytes.Buffer{}
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+preset: simple
+presets:
+  simple:
+    samples:
+      - "example.com\tGET\t200\t512"
+      - "example.com\tGET\t200\t-"
+      - "example.com\tGET\t200\tHTTP/1.1"
+    metrics:
+      - name: "http_response_size_bytes"
+        type: "counter"
+        help: "The total size of responses."
+        valueIndex: 3
+        labels:
+          - name: "host"
+            lineIndex: 0
+`), 0o600))
+
+	returnCode := run(t.Context(), []string{
+		"access-log-exporter",
+		"--config=" + configFile,
+		"--verify-config",
+	}, stdout, nil)
+	require.Equal(t, ReturnCodeError, returnCode, stdout)
+	require.Equal(t, `preset 'simple' (active): 1 metrics
+error: preset 'simple', sample 2, metric 'http_response_size_bytes': failed to parse value "HTTP/1.1": strconv.ParseFloat: parsing "HTTP/1.1": invalid syntax
+`, stdout.String())
+}
+
+func TestConfigTestLines(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+preset: simple
+presets:
+  simple:
+    metrics:
+      - name: "http_response_size_bytes"
+        type: "counter"
+        help: "The total size of responses."
+        valueIndex: 1
+        labels:
+          - name: "host"
+            lineIndex: 0
+`), 0o600))
+
+	linesFile := filepath.Join(dir, "lines.txt")
+	require.NoError(t, os.WriteFile(linesFile, []byte("example.com\t512\nexample.com\t256\nexample.org\tHTTP/1.1\n"), 0o600))
+
+	expected := `# HELP http_response_size_bytes The total size of responses.
+# TYPE http_response_size_bytes counter
+http_response_size_bytes{host="example.com"} 768
+`
+
+	for _, tc := range []struct {
+		name       string
+		expected   string
+		returnCode ReturnCode
+		output     string
+	}{
+		{
+			name:       "print",
+			returnCode: ReturnCodeOK,
+			output:     expected,
+		},
+		{
+			name:       "match",
+			expected:   expected,
+			returnCode: ReturnCodeOK,
+			output:     "metrics match\n",
+		},
+		{
+			name:       "mismatch",
+			expected:   strings.Replace(expected, "768", "512", 1),
+			returnCode: ReturnCodeError,
+			output: "metrics don't match " + filepath.Join(dir, "mismatch.prom") + `:
+- http_response_size_bytes{host="example.com"} 512
++ http_response_size_bytes{host="example.com"} 768
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			stdout := &bytes.Buffer{}
+
+			args := []string{
+				"access-log-exporter",
+				"--config=" + configFile,
+				"--config-test-lines=" + linesFile,
+			}
+
+			if tc.expected != "" {
+				expectedFile := filepath.Join(dir, tc.name+".prom")
+				require.NoError(t, os.WriteFile(expectedFile, []byte(tc.expected), 0o600))
+
+				args = append(args, "--config-test-expected="+expectedFile)
+			}
+
+			returnCode := run(t.Context(), args, stdout, nil)
+			require.Equal(t, tc.returnCode, returnCode, stdout)
+			require.Equal(t, `error: line 3: metric http_response_size_bytes: failed to set metric http_response_size_bytes with value "HTTP/1.1": failed to parse value "HTTP/1.1": strconv.ParseFloat: parsing "HTTP/1.1": invalid syntax
+`+tc.output, stdout.String())
+		})
+	}
+}
+
+func TestConfigTestLinesJSONL(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+preset: simple
+presets:
+  simple:
+    metrics:
+      - name: "http_requests_total"
+        type: "counter"
+        help: "The total number of client requests."
+        labels:
+          - name: "host"
+            lineIndex: 0
+      - name: "http_response_size_bytes"
+        type: "counter"
+        help: "The total size of responses."
+        valueIndex: 1
+        labels:
+          - name: "host"
+            lineIndex: 0
+`), 0o600))
+
+	linesFile := filepath.Join(dir, "lines.txt")
+	require.NoError(t, os.WriteFile(linesFile, []byte("example.com\t512\n\nexample.org\tHTTP/1.1\n"), 0o600))
+
+	expected := `{"labels":{"host":"example.com"},"metric":"http_requests_total","line":1}
+{"labels":{"host":"example.com"},"metric":"http_response_size_bytes","value":"512","line":1}
+{"labels":{"host":"example.org"},"metric":"http_requests_total","line":3}
+{"metric":"http_response_size_bytes","error":"failed to parse value \"HTTP/1.1\": strconv.ParseFloat: parsing \"HTTP/1.1\": invalid syntax","line":3}
+`
+
+	stdout := &bytes.Buffer{}
+
+	returnCode := run(t.Context(), []string{
+		"access-log-exporter",
+		"--config=" + configFile,
+		"--config-test-lines=" + linesFile,
+		"--config-test-format=jsonl",
+	}, stdout, nil)
+	require.Equal(t, ReturnCodeOK, returnCode, stdout)
+	require.Equal(t, expected, stdout.String())
+
+	// The output can be used as snapshot like the text format.
+	expectedFile := filepath.Join(dir, "expected.jsonl")
+	require.NoError(t, os.WriteFile(expectedFile, []byte(expected), 0o600))
+
+	stdout.Reset()
+
+	returnCode = run(t.Context(), []string{
+		"access-log-exporter",
+		"--config=" + configFile,
+		"--config-test-lines=" + linesFile,
+		"--config-test-format=jsonl",
+		"--config-test-expected=" + expectedFile,
+	}, stdout, nil)
+	require.Equal(t, ReturnCodeOK, returnCode, stdout)
+	require.Equal(t, "metrics match\n", stdout.String())
+}
+
+func TestSelfTest(t *testing.T) {
+	t.Parallel()
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	moduleRoot, err := findModuleRoot(wd)
+	require.NoError(t, err)
+
+	conf, err := config.New([]string{
+		"access-log-exporter",
+		"--config=" + moduleRoot + "/packaging/etc/access-log-exporter/config.yaml",
+	}, io.Discard)
+	require.NoError(t, err)
+
+	// The built-in presets have no samples, so they are tested with a synthetic line.
+	for name := range conf.Presets {
+		conf.Preset = name
+
+		require.NoError(t, selfTest(conf), name)
+	}
+}
+
+func TestSelfTestBrokenPreset(t *testing.T) {
+	t.Parallel()
+
+	stdout := &bytes.Buffer{}
+
+	// valueIndex points to the method instead of the response size.
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+preset: broken
+presets:
+  broken:
+    samples:
+      - "example.com\tGET\t512"
+    metrics:
+      - name: "http_response_size_bytes"
+        type: "counter"
+        help: "The total size of responses."
+        valueIndex: 1
+        labels:
+          - name: "host"
+            lineIndex: 0
+`), 0o600))
+
+	returnCode := run(t.Context(), []string{
+		"access-log-exporter",
+		"--config=" + configFile,
+		"--self-test",
+	}, stdout, nil)
+	require.Equal(t, ReturnCodeError, returnCode, stdout)
+	require.Contains(t, stdout.String(), "self-test failed")
+	require.Contains(t, stdout.String(), `preset 'broken' produced no metric from 1 lines`)
+	require.Contains(t, stdout.String(), `failed to parse value \"GET\"`)
+}
+
+func TestRegistryConflict(t *testing.T) {
+	t.Parallel()
+
+	stdout := &bytes.Buffer{}
+
+	syslogSocket, err := nettest.LocalPath()
+	require.NoError(t, err)
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+preset: simple
+presets:
+  simple:
+    metrics:
+      - name: "go_goroutines"
+        type: "gauge"
+        help: "Conflicts with the runtime metric."
+        valueIndex: 0
+`), 0o600))
+
+	returnCode := run(t.Context(), []string{
+		"access-log-exporter",
+		"--config=" + configFile,
+		"--syslog.listen-address=unix://" + syslogSocket,
+		"--web.listen-address=127.0.0.1:0",
+	}, stdout, nil)
+	require.Equal(t, ReturnCodeError, returnCode, stdout)
+	require.Contains(t, stdout.String(), "could not register runtime metrics")
+	require.Contains(t, stdout.String(), `fqName: \"go_goroutines\"`)
+	require.NoFileExists(t, syslogSocket)
+}
+
+func TestBuiltinNamespace(t *testing.T) {
+	t.Parallel()
+
+	messageCh := make(chan syslog.Message)
+	close(messageCh)
+
+	logger := slog.New(slog.DiscardHandler)
+
+	prometheusCollector, err := collector.New(t.Context(), logger, config.Preset{}, 1, messageCh)
+	require.NoError(t, err)
+
+	t.Cleanup(prometheusCollector.Close)
+
+	conf := config.Defaults
+	conf.Metrics.BuiltinNamespace = "access_log_exporter"
+
+	reg, err := setupPrometheusRegistry(conf, logger, prometheusCollector)
+	require.NoError(t, err)
+
+	metricFamilies, err := reg.Gather()
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(metricFamilies))
+	for _, metricFamily := range metricFamilies {
+		names = append(names, metricFamily.GetName())
+	}
+
+	require.Contains(t, names, "access_log_exporter_go_goroutines")
+	require.Contains(t, names, "access_log_exporter_process_start_time_seconds")
+	require.NotContains(t, names, "go_goroutines")
+}
+
+func TestTelemetry(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		disable func(telemetry *config.Telemetry)
+		metrics []string
+	}{
+		{
+			name:    "runtime",
+			disable: func(telemetry *config.Telemetry) { telemetry.Runtime = false },
+			metrics: []string{"go_goroutines", "go_build_info", "process_start_time_seconds"},
+		},
+		{
+			name:    "config",
+			disable: func(telemetry *config.Telemetry) { telemetry.Config = false },
+			metrics: []string{"access_log_exporter_config_load_duration_seconds", "access_log_exporter_config_bytes"},
+		},
+		{
+			name:    "workers",
+			disable: func(telemetry *config.Telemetry) { telemetry.Workers = false },
+			metrics: []string{"log_worker_panics_total", "log_worker_processed_total"},
+		},
+		{
+			name:    "per metric",
+			disable: func(telemetry *config.Telemetry) { telemetry.PerMetric = false },
+			metrics: []string{"log_metric_observations_total", "log_series_quarantined_total", "log_value_regexp_mismatches_total"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			gatherNames := func(conf config.Config) []string {
+				t.Helper()
+
+				logger := slog.New(slog.DiscardHandler)
+				messageCh := make(chan syslog.Message)
+
+				prometheusCollector, err := collector.New(t.Context(), logger, config.Preset{
+					Metrics: []config.Metric{
+						{
+							Name: "http_requests_total",
+							Type: "counter",
+							Help: "The total number of client requests.",
+						},
+					},
+				}, 1, messageCh,
+					collector.WithWorkerMetrics(conf.Telemetry.Workers),
+					collector.WithPerMetricMetrics(conf.Telemetry.PerMetric),
+				)
+				require.NoError(t, err)
+
+				close(messageCh)
+				prometheusCollector.Close()
+
+				reg, err := setupPrometheusRegistry(conf, logger, prometheusCollector)
+				require.NoError(t, err)
+
+				metricFamilies, err := reg.Gather()
+				require.NoError(t, err)
+
+				names := make([]string, 0, len(metricFamilies))
+				for _, metricFamily := range metricFamilies {
+					names = append(names, metricFamily.GetName())
+				}
+
+				return names
+			}
+
+			names := gatherNames(config.Defaults)
+			for _, name := range tc.metrics {
+				require.Contains(t, names, name)
+			}
+
+			conf := config.Defaults
+			tc.disable(&conf.Telemetry)
+
+			names = gatherNames(conf)
+			for _, name := range tc.metrics {
+				require.NotContains(t, names, name)
+			}
+
+			require.Contains(t, names, "log_parse_errors_total")
+		})
+	}
+}
+
+func TestCreatedTimestamps(t *testing.T) {
+	t.Parallel()
+
+	for _, enabled := range []bool{true, false} {
+		t.Run(strconv.FormatBool(enabled), func(t *testing.T) {
+			t.Parallel()
+
+			logger := slog.New(slog.DiscardHandler)
+
+			prometheusCollector, err := collector.New(t.Context(), logger, config.Preset{
+				Metrics: []config.Metric{
+					{
+						Name: "http_requests_total",
+						Type: "counter",
+						Help: "The total number of client requests.",
+					},
+				},
+			}, 0, nil)
+			require.NoError(t, err)
+
+			t.Cleanup(prometheusCollector.Close)
+
+			require.NoError(t, prometheusCollector.Feed("example.com"))
+
+			conf := config.Defaults
+			conf.Metrics.CreatedTimestamps = enabled
+
+			reg, err := setupPrometheusRegistry(conf, logger, prometheusCollector)
+			require.NoError(t, err)
+
+			server := setupServer(conf, logger, reg, prometheusCollector)
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/metrics", nil)
+			req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+
+			rec := httptest.NewRecorder()
+			server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Contains(t, rec.Body.String(), "http_requests_total 1")
+
+			if enabled {
+				require.Contains(t, rec.Body.String(), "http_requests_created ")
+			} else {
+				require.NotContains(t, rec.Body.String(), "http_requests_created")
+			}
+		})
+	}
+}
+
+func TestMetricsProtobuf(t *testing.T) {
+	t.Parallel()
+
+	protobufAccept := string(expfmt.NewFormat(expfmt.TypeProtoDelim))
+
+	for _, tc := range []struct {
+		name     string
+		mode     string
+		accept   string
+		protobuf bool
+	}{
+		{name: "auto protobuf", mode: config.ProtobufAuto, accept: protobufAccept, protobuf: true},
+		{name: "auto text", mode: config.ProtobufAuto, accept: "text/plain", protobuf: false},
+		{name: "force", mode: config.ProtobufForce, accept: "text/plain", protobuf: true},
+		{name: "disable", mode: config.ProtobufDisable, accept: protobufAccept + ",text/plain;q=0.5", protobuf: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			logger := slog.New(slog.DiscardHandler)
+
+			prometheusCollector, err := collector.New(t.Context(), logger, config.Preset{
+				Metrics: []config.Metric{
+					{
+						Name: "http_requests_total",
+						Type: "counter",
+						Help: "The total number of client requests.",
+					},
+				},
+			}, 0, nil)
+			require.NoError(t, err)
+
+			t.Cleanup(prometheusCollector.Close)
+
+			require.NoError(t, prometheusCollector.Feed("example.com"))
+
+			conf := config.Defaults
+			conf.Metrics.Protobuf = tc.mode
+
+			reg, err := setupPrometheusRegistry(conf, logger, prometheusCollector)
+			require.NoError(t, err)
+
+			server := setupServer(conf, logger, reg, prometheusCollector)
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/metrics", nil)
+			req.Header.Set("Accept", tc.accept)
+
+			rec := httptest.NewRecorder()
+			server.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			format := expfmt.ResponseFormat(rec.Header())
+			if !tc.protobuf {
+				require.Equal(t, expfmt.TypeTextPlain, format.FormatType())
+				require.Contains(t, rec.Body.String(), "http_requests_total 1")
+
+				return
+			}
+
+			require.Equal(t, expfmt.TypeProtoDelim, format.FormatType())
+
+			decoder := expfmt.NewDecoder(rec.Body, format)
+
+			var found bool
+
+			for {
+				var metricFamily dto.MetricFamily
+
+				err := decoder.Decode(&metricFamily)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				require.NoError(t, err)
+
+				if metricFamily.GetName() == "http_requests_total" {
+					found = true
+
+					require.InDelta(t, 1, metricFamily.GetMetric()[0].GetCounter().GetValue(), 0)
+				}
+			}
+
+			require.True(t, found, "http_requests_total not found in protobuf body")
+		})
+	}
+}
+
+func TestMultipleWebListenAddresses(t *testing.T) {
+	t.Parallel()
+
+	termCh := make(chan os.Signal)
+	returnCodeCh := make(chan ReturnCode, 1)
+	stdout := &bytes.Buffer{}
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	moduleRoot, err := findModuleRoot(wd)
+	require.NoError(t, err)
+
+	syslogSocket, err := nettest.LocalPath()
+	require.NoError(t, err)
+
+	webSocket, err := nettest.LocalPath()
+	require.NoError(t, err)
+
+	var listenConf net.ListenConfig
+
+	listener, err := listenConf.Listen(t.Context(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	webAddress := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	go func() {
+		returnCodeCh <- run(t.Context(), []string{
+			"access-log-exporter",
+			"--config=" + moduleRoot + "/packaging/etc/access-log-exporter/config.yaml",
+			"--syslog.listen-address=unix://" + syslogSocket,
+			"--web.listen-address=" + webAddress,
+			"--web.listen-address=unix://" + webSocket,
+		}, stdout, termCh)
+	}()
+
+	unixClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+
+				return dialer.DialContext(ctx, "unix", webSocket)
+			},
+		},
+	}
+
+	for client, endpoint := range map[*http.Client]string{
+		http.DefaultClient: "http://" + webAddress + "/metrics",
+		unixClient:         "http://unix/metrics",
+	} {
+		require.EventuallyWithT(t, func(collect *assert.CollectT) {
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, endpoint, nil)
+			require.NoError(collect, err)
+
+			resp, err := client.Do(req)
+			require.NoError(collect, err)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(collect, err)
+			require.NoError(collect, resp.Body.Close())
+
+			assert.Equal(collect, http.StatusOK, resp.StatusCode)
+			assert.Contains(collect, string(body), "log_parse_errors_total")
+			assert.Contains(collect, string(body), "access_log_exporter_config_load_duration_seconds")
+			assert.Contains(collect, string(body), "access_log_exporter_config_bytes")
+		}, 5*time.Second, 50*time.Millisecond)
+	}
+
+	termCh <- syscall.SIGTERM
+
+	require.Equal(t, ReturnCodeOK, <-returnCodeCh, stdout.String())
+}
+
+func TestWebReusePort(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT is only tested on linux")
+	}
+
+	oldListeners, err := listenWeb(t.Context(), []string{"127.0.0.1:0"}, true)
+	require.NoError(t, err)
+
+	address := oldListeners[0].Addr().String()
+
+	t.Cleanup(func() {
+		_ = oldListeners[0].Close()
+	})
+
+	_, err = listenWeb(t.Context(), []string{address}, false)
+	require.ErrorIs(t, err, syscall.EADDRINUSE, "binding the port without SO_REUSEPORT")
+
+	// The new instance binds the port while the old one still serves.
+	newListeners, err := listenWeb(t.Context(), []string{address}, true)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = newListeners[0].Close()
+	})
+
+	for _, listener := range []net.Listener{oldListeners[0], newListeners[0]} {
+		server := &http.Server{
+			Handler:           http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) }),
+			ReadHeaderTimeout: time.Second,
+		}
+
+		go func() {
+			_ = server.Serve(listener)
+		}()
+
+		t.Cleanup(func() {
+			_ = server.Close()
+		})
+	}
+
+	// Requests keep succeeding after the old instance is gone.
+	require.NoError(t, oldListeners[0].Close())
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://"+address, nil)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestWebListenAddressDynamicPort(t *testing.T) {
+	t.Parallel()
+
+	termCh := make(chan os.Signal)
+	returnCodeCh := make(chan ReturnCode, 1)
+	stdout := &syncBuffer{}
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	moduleRoot, err := findModuleRoot(wd)
+	require.NoError(t, err)
+
+	syslogSocket, err := nettest.LocalPath()
+	require.NoError(t, err)
+
+	go func() {
+		returnCodeCh <- run(t.Context(), []string{
+			"access-log-exporter",
+			"--config=" + moduleRoot + "/packaging/etc/access-log-exporter/config.yaml",
+			"--log.format=json",
+			"--syslog.listen-address=unix://" + syslogSocket,
+			"--web.listen-address=127.0.0.1:0",
+		}, stdout, termCh)
+	}()
+
+	var port int
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		for line := range strings.Lines(stdout.String()) {
+			var entry struct {
+				Msg  string `json:"msg"`
+				Port int    `json:"port"`
+			}
+
+			if json.Unmarshal([]byte(line), &entry) == nil && entry.Msg == "starting HTTP server" {
+				port = entry.Port
+			}
+		}
+
+		assert.NotZero(collect, port)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://127.0.0.1:"+strconv.Itoa(port)+"/health", nil)
+		require.NoError(collect, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(collect, err)
+		require.NoError(collect, resp.Body.Close())
+
+		assert.Equal(collect, http.StatusOK, resp.StatusCode)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	termCh <- syscall.SIGTERM
+
+	require.Equal(t, ReturnCodeOK, <-returnCodeCh, stdout.String())
+}
+
+// syncBuffer is a [bytes.Buffer] safe for concurrent use, to read the log output while run is writing to it.
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p) //nolint:wrapcheck
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+func TestBufferSizeZero(t *testing.T) {
+	t.Parallel()
+
+	termCh := make(chan os.Signal)
+	returnCodeCh := make(chan ReturnCode, 1)
+	stdout := &syncBuffer{}
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	moduleRoot, err := findModuleRoot(wd)
+	require.NoError(t, err)
+
+	syslogSocket, err := nettest.LocalPath()
+	require.NoError(t, err)
+
+	webSocket, err := nettest.LocalPath()
+	require.NoError(t, err)
+
+	go func() {
+		returnCodeCh <- run(t.Context(), []string{
+			"access-log-exporter",
+			"--config=" + moduleRoot + "/packaging/etc/access-log-exporter/config.yaml",
+			"--buffer-size=0",
+			"--worker=1",
+			"--syslog.listen-address=unix://" + syslogSocket,
+			"--web.listen-address=unix://" + webSocket,
+		}, stdout, termCh)
+	}()
+
+	var dialer net.Dialer
+
+	var syslogClient net.Conn
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		syslogClient, err = dialer.DialContext(t.Context(), "unixgram", syslogSocket)
+		require.NoError(collect, err)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	t.Cleanup(func() {
+		_ = syslogClient.Close()
+	})
+
+	for range 10 {
+		_, err = syslogClient.Write([]byte("<190>Aug 15 20:16:01 nginx: example.com\tGET\t200\tOK\t0.1\t100\t200"))
+		require.NoError(t, err)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", webSocket)
+			},
+		},
+	}
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://unix/metrics", nil)
+		require.NoError(collect, err)
+
+		resp, err := client.Do(req)
+		require.NoError(collect, err)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(collect, err)
+		require.NoError(collect, resp.Body.Close())
+
+		assert.Contains(collect, string(body), `http_requests_total{host="example.com",method="GET",status="200"} 10`)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	termCh <- syscall.SIGTERM
+
+	require.Equal(t, ReturnCodeOK, <-returnCodeCh, stdout.String())
+}
+
+func TestSyslogKeepTag(t *testing.T) {
+	t.Parallel()
+
+	termCh := make(chan os.Signal)
+	returnCodeCh := make(chan ReturnCode, 1)
+	stdout := &syncBuffer{}
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+preset: sources
+presets:
+  sources:
+    metrics:
+      - name: "http_requests_total"
+        type: "counter"
+        help: "The total number of client requests."
+        labels:
+          - name: "source"
+            lineIndex: 0
+          - name: "host"
+            lineIndex: 1
+`), 0o600))
+
+	syslogSocket, err := nettest.LocalPath()
+	require.NoError(t, err)
+
+	webSocket, err := nettest.LocalPath()
+	require.NoError(t, err)
+
+	go func() {
+		returnCodeCh <- run(t.Context(), []string{
+			"access-log-exporter",
+			"--config=" + configFile,
+			"--syslog.keep-tag",
+			"--syslog.listen-address=unix://" + syslogSocket,
+			"--web.listen-address=unix://" + webSocket,
+		}, stdout, termCh)
+	}()
+
+	var dialer net.Dialer
+
+	var syslogClient net.Conn
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		syslogClient, err = dialer.DialContext(t.Context(), "unixgram", syslogSocket)
+		require.NoError(collect, err)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	t.Cleanup(func() {
+		_ = syslogClient.Close()
+	})
+
+	for _, message := range []string{
+		"<190>Aug 15 20:16:01 nginx: example.com",
+		"<190>Aug 15 20:16:01 nginx: example.com",
+		"<190>Aug 15 20:16:01 apache[1234]: example.com",
+	} {
+		_, err = syslogClient.Write([]byte(message))
+		require.NoError(t, err)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", webSocket)
+			},
+		},
+	}
+
+	require.EventuallyWithT(t, func(collect *assert.CollectT) {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://unix/metrics", nil)
+		require.NoError(collect, err)
+
+		resp, err := client.Do(req)
+		require.NoError(collect, err)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(collect, err)
+		require.NoError(collect, resp.Body.Close())
+
+		assert.Contains(collect, string(body), `http_requests_total{host="example.com",source="nginx"} 2`)
+		assert.Contains(collect, string(body), `http_requests_total{host="example.com",source="apache"} 1`)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	termCh <- syscall.SIGTERM
+
+	require.Equal(t, ReturnCodeOK, <-returnCodeCh, stdout.String())
+}
+
+func TestReloadSignal(t *testing.T) {
+	t.Parallel()
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	moduleRoot, err := findModuleRoot(wd)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name       string
+		signal     os.Signal
+		returnCode ReturnCode
+	}{
+		{name: "configured reload signal", signal: syscall.SIGUSR2, returnCode: ReturnCodeReload},
+		{name: "unconfigured signal", signal: syscall.SIGHUP, returnCode: ReturnCodeOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			termCh := make(chan os.Signal)
+			returnCodeCh := make(chan ReturnCode, 1)
+			stdout := &syncBuffer{}
+
+			syslogSocket, err := nettest.LocalPath()
+			require.NoError(t, err)
+
+			webSocket, err := nettest.LocalPath()
+			require.NoError(t, err)
+
+			go func() {
+				returnCodeCh <- run(t.Context(), []string{
+					"access-log-exporter",
+					"--config=" + moduleRoot + "/packaging/etc/access-log-exporter/config.yaml",
+					"--syslog.listen-address=unix://" + syslogSocket,
+					"--web.listen-address=unix://" + webSocket,
+					"--signal.reload=SIGUSR2",
+				}, stdout, termCh)
+			}()
+
+			termCh <- tc.signal
+
+			// SIGHUP is not configured to trigger a reload and ignored, so the exporter needs to be stopped.
+			if tc.returnCode != ReturnCodeReload {
+				termCh <- syscall.SIGTERM
+			}
+
+			require.Equal(t, tc.returnCode, <-returnCodeCh, stdout.String())
+		})
+	}
+}
+
+func TestReloadKeepsUnchangedMetrics(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name        string
+		args        []string
+		afterReload string
+	}{
+		{
+			name:        "default",
+			afterReload: `http_requests_total{host="example.com"} 3`,
+		},
+		{
+			name:        "reset on reload",
+			args:        []string{"--reset-on-reload"},
+			afterReload: `http_requests_total{host="example.com"} 1`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			termCh := make(chan os.Signal)
+			returnCodeCh := make(chan ReturnCode, 1)
+			stdout := &syncBuffer{}
+
+			requestsMetric := `
+      - name: "http_requests_total"
+        type: "counter"
+        help: "The total number of client requests."
+        labels:
+          - name: "host"
+            lineIndex: 0
+`
+
+			configFile := filepath.Join(t.TempDir(), "config.yaml")
+			require.NoError(t, os.WriteFile(configFile, []byte(`
+preset: test
+presets:
+  test:
+    metrics:`+requestsMetric+`
+      - name: "http_methods_total"
+        type: "counter"
+        help: "The total number of client requests per method."
+        labels:
+          - name: "method"
+            lineIndex: 1
+`), 0o600))
+
+			syslogSocket, err := nettest.LocalPath()
+			require.NoError(t, err)
+
+			webSocket, err := nettest.LocalPath()
+			require.NoError(t, err)
+
+			go func() {
+				returnCodeCh <- execute(append([]string{
+					"access-log-exporter",
+					"--config=" + configFile,
+					"--syslog.listen-address=unix://" + syslogSocket,
+					"--web.listen-address=unix://" + webSocket,
+				}, tc.args...), stdout, termCh)
+			}()
+
+			var dialer net.Dialer
+
+			// The syslog socket is recreated on reload, so dial for each line.
+			sendLine := func(line string) {
+				require.EventuallyWithT(t, func(collect *assert.CollectT) {
+					syslogClient, err := dialer.DialContext(t.Context(), "unixgram", syslogSocket)
+					require.NoError(collect, err)
+
+					defer syslogClient.Close()
+
+					_, err = syslogClient.Write([]byte("<190>Aug 15 20:16:01 nginx: " + line))
+					require.NoError(collect, err)
+				}, 5*time.Second, 50*time.Millisecond)
+			}
+
+			client := &http.Client{
+				Transport: &http.Transport{
+					DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+						return dialer.DialContext(ctx, "unix", webSocket)
+					},
+				},
+			}
+
+			requireMetrics := func(contains, notContains string) {
+				require.EventuallyWithT(t, func(collect *assert.CollectT) {
+					req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://unix/metrics", nil)
+					require.NoError(collect, err)
+
+					resp, err := client.Do(req)
+					require.NoError(collect, err)
+
+					body, err := io.ReadAll(resp.Body)
+					require.NoError(collect, err)
+					require.NoError(collect, resp.Body.Close())
+
+					assert.Contains(collect, string(body), contains)
+					assert.NotContains(collect, string(body), notContains)
+				}, 5*time.Second, 50*time.Millisecond)
+			}
+
+			sendLine("example.com\tGET")
+			sendLine("example.com\tGET")
+			requireMetrics(`http_requests_total{host="example.com"} 2`, `http_methods_total{method="GET"} 1`)
+			requireMetrics(`http_methods_total{method="GET"} 2`, `http_requests_total{host="example.com"} 1`)
+
+			require.NoError(t, os.WriteFile(configFile, []byte(`
+preset: test
+presets:
+  test:
+    metrics:`+requestsMetric), 0o600))
+
+			termCh <- syscall.SIGHUP
+
+			// Series of removed metrics disappear after the reload.
+			requireMetrics(`log_metric_observations_total{metric="http_requests_total"}`, `http_methods_total`)
+
+			sendLine("example.com\tGET")
+			requireMetrics(tc.afterReload, `http_methods_total`)
+
+			termCh <- syscall.SIGTERM
+
+			require.Equal(t, ReturnCodeOK, <-returnCodeCh, stdout.String())
+		})
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	t.Parallel()
+
+	stdout := &syncBuffer{}
+	termCh := make(chan os.Signal)
+	returnCodeCh := make(chan int, 1)
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	writePreset := func(name string) {
+		require.NoError(t, os.WriteFile(configFile, []byte(`
+preset: `+name+`
+presets:
+  `+name+`:
+    metrics:
+      - name: "`+name+`_requests_total"
+        type: "counter"
+        help: "The total number of client requests."
+`), 0o600))
+	}
+
+	writePreset("before")
+
+	syslogSocket, err := nettest.LocalPath()
+	require.NoError(t, err)
+
+	webSocket, err := nettest.LocalPath()
+	require.NoError(t, err)
+
+	go func() {
+		returnCodeCh <- execute([]string{
+			"access-log-exporter",
+			"--config=" + configFile,
+			"--syslog.listen-address=unix://" + syslogSocket,
+			"--web.listen-address=unix://" + webSocket,
+			"--watch-config",
+			"--watch-config-interval=50ms",
+		}, stdout, termCh)
+	}()
+
+	var dialer net.Dialer
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", webSocket)
+			},
+		},
+	}
+
+	requireMetric := func(contains string) {
+		require.EventuallyWithT(t, func(collect *assert.CollectT) {
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://unix/metrics", nil)
+			require.NoError(collect, err)
+
+			resp, err := client.Do(req)
+			require.NoError(collect, err)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(collect, err)
+			require.NoError(collect, resp.Body.Close())
+
+			assert.Contains(collect, string(body), contains)
+		}, 5*time.Second, 50*time.Millisecond)
+	}
+
+	requireMetric(`log_metric_observations_total{metric="before_requests_total"}`)
+
+	// An invalid config file keeps the running configuration.
+	require.NoError(t, os.WriteFile(configFile, []byte("preset: [\n"), 0o600))
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(stdout.String(), "failed to load, keeping the running configuration")
+	}, 5*time.Second, 50*time.Millisecond)
+
+	requireMetric(`log_metric_observations_total{metric="before_requests_total"}`)
+
+	// The run loop re-enters with the preset of the changed config file, without a signal.
+	writePreset("after_change")
+
+	requireMetric(`log_metric_observations_total{metric="after_change_requests_total"}`)
+	require.Contains(t, stdout.String(), "config file changed, reloading configuration")
+	require.Equal(t, 1, strings.Count(stdout.String(), "failed to load"), "the invalid file is not retried on every check")
+
+	termCh <- syscall.SIGTERM
+
+	require.Equal(t, ReturnCodeOK, <-returnCodeCh, stdout.String())
+}
+
+func TestConfigWatcher(t *testing.T) {
+	t.Parallel()
+
+	loaded := []configFileState{{modTime: 1, size: 100}}
+	changed := []configFileState{{modTime: 2, size: 50}}
+	settled := []configFileState{{modTime: 3, size: 120}}
+
+	watcher := configWatcher{loaded: loaded}
+
+	require.False(t, watcher.check(loaded), "unchanged files")
+
+	// A change triggers a reload once it's unchanged for one check.
+	require.False(t, watcher.check(changed))
+	require.False(t, watcher.check(settled), "changed again within the interval")
+	require.True(t, watcher.check(settled))
+
+	// A missing file, e.g. in the middle of a replacement, is not reloaded.
+	watcher = configWatcher{loaded: loaded}
+
+	require.False(t, watcher.check([]configFileState{{}}))
+	require.False(t, watcher.check([]configFileState{{}}))
+}
+
+func TestTraceHandler(t *testing.T) {
+	t.Parallel()
+
+	messageCh := make(chan syslog.Message)
+	logger := slog.New(slog.DiscardHandler)
+
+	prometheusCollector, err := collector.New(t.Context(), logger, config.Preset{
+		Metrics: []config.Metric{
+			{
+				Name:       "http_request_duration_seconds",
+				Type:       "histogram",
+				ValueIndex: new(uint(2)),
+				Labels: []config.Label{
+					{Name: "host", LineIndex: 0},
+					{Name: "method", LineIndex: 1},
+				},
+			},
+		},
+	}, 1, messageCh)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(traceHandler(logger, prometheusCollector))
+
+	t.Cleanup(func() {
+		server.Close()
+		close(messageCh)
+		prometheusCollector.Close()
+	})
+
+	type response struct {
+		body []byte
+		err  error
+	}
+
+	responseCh := make(chan response, 1)
+
+	go func() {
+		resp, err := http.Get(server.URL + "?count=2") //nolint:noctx // test
+		if err != nil {
+			responseCh <- response{err: err}
+
+			return
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		responseCh <- response{body: body, err: err}
+	}()
+
+	// Feed lines until the trace has captured enough of them.
+	var resp response
+
+	for resp.body == nil && resp.err == nil {
+		select {
+		case messageCh <- syslog.Message{Line: "example.com\tGET\t0.5"}:
+			time.Sleep(10 * time.Millisecond)
+		case resp = <-responseCh:
+		}
+	}
+
+	require.NoError(t, resp.err)
+
+	var lines []collector.TraceLine
+
+	require.NoError(t, json.Unmarshal(resp.body, &lines))
+	require.Len(t, lines, 2)
+
+	for _, line := range lines {
+		require.Equal(t, "example.com\tGET\t0.5", line.Line)
+		require.Equal(t, []metric.TraceResult{
+			{
+				Metric: "http_request_duration_seconds",
+				Labels: map[string]string{"host": "example.com", "method": "GET"},
+				Value:  "0.5",
+			},
+		}, line.Metrics)
+	}
+}
+
+func TestReadyHandlerStaleThreshold(t *testing.T) {
+	t.Parallel()
+
+	messageCh := make(chan syslog.Message)
+
+	prometheusCollector, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), config.Preset{}, 1, messageCh)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		close(messageCh)
+		prometheusCollector.Close()
+	})
+
+	started := prometheusCollector.LastReceived()
+
+	messageCh <- syslog.Message{Line: "example.com\tGET\t200"}
+
+	require.Eventually(t, func() bool {
+		return prometheusCollector.LastReceived().After(started)
+	}, time.Second, time.Millisecond)
+
+	clock := time.Now()
+
+	handler := readyHandler(prometheusCollector, config.Web{StaleThreshold: time.Minute}, func() time.Time {
+		return clock
+	})
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/-/ready", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	clock = clock.Add(2 * time.Minute)
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/-/ready", nil))
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "no log message received")
+}
+
+func TestReadyHandlerErrorRatio(t *testing.T) {
+	t.Parallel()
+
+	prometheusCollector, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), config.Preset{
+		Metrics: []config.Metric{
+			{
+				Name:   "http_requests_total",
+				Type:   "counter",
+				Labels: []config.Label{{Name: "status", LineIndex: 2}},
+			},
+		},
+	}, 0, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(prometheusCollector.Close)
+
+	clock := time.Now()
+
+	handler := readyHandler(prometheusCollector, config.Web{ReadyMaxErrorRatio: 0.5, ReadyErrorGracePeriod: time.Minute}, func() time.Time {
+		return clock
+	})
+
+	ready := func(lines ...string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		for _, line := range lines {
+			_ = prometheusCollector.Feed(line)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/-/ready", nil))
+
+		return recorder
+	}
+
+	// Lines without status field fail to parse. A burst within the grace period is tolerated.
+	require.Equal(t, http.StatusOK, ready("example.com\tGET", "example.com\tGET", "example.com\tGET\t200").Code)
+
+	clock = clock.Add(30 * time.Second)
+	require.Equal(t, http.StatusOK, ready("example.com\tGET").Code)
+
+	clock = clock.Add(time.Minute)
+
+	recorder := ready("example.com\tGET")
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "100% of log lines failed to parse for 1m30s")
+
+	// Once the errors are gone, the endpoint recovers.
+	clock = clock.Add(10 * time.Second)
+	require.Equal(t, http.StatusOK, ready("example.com\tGET\t200", "example.com\tGET\t200").Code)
+}
+
+func TestIdleWarning(t *testing.T) {
+	t.Parallel()
+
+	var logs bytes.Buffer
+
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	warning := idleWarning{threshold: 5 * time.Minute, interval: time.Minute}
+
+	lastReceived := time.Now()
+	clock := lastReceived
+
+	warnings := 0
+
+	// Checking every 10 seconds for 10 minutes warns once per interval, once the threshold is exceeded.
+	for range 60 {
+		clock = clock.Add(10 * time.Second)
+
+		if warning.check(t.Context(), logger, lastReceived, clock) {
+			warnings++
+		}
+	}
+
+	require.Equal(t, 5, warnings)
+	require.Equal(t, 5, strings.Count(logs.String(), `msg="no log message received"`))
+	require.Contains(t, logs.String(), "age=5m10s")
+
+	// Traffic resets the warning, so the next idle period warns immediately after exceeding the threshold.
+	lastReceived = clock
+
+	require.False(t, warning.check(t.Context(), logger, lastReceived, clock.Add(time.Minute)))
+	require.True(t, warning.check(t.Context(), logger, lastReceived, clock.Add(5*time.Minute+time.Second)))
+}
@@ -2,29 +2,126 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/jkroepke/access-log-exporter/internal/config"
+	"github.com/jkroepke/access-log-exporter/internal/config/types"
 	"github.com/jkroepke/access-log-exporter/internal/metric"
 	"github.com/jkroepke/access-log-exporter/internal/syslog"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-func New(ctx context.Context, logger *slog.Logger, preset config.Preset, workerCount int, messageCh <-chan syslog.Message) (*Collector, error) {
-	var (
-		err       error
-		userAgent bool
-	)
+// New creates a collector for the metrics of the given preset.
+// Log lines received from messageCh are processed by workerCount workers. If messageCh is nil, no workers are started
+// and lines must be passed to [Collector.Feed] instead.
+func New(ctx context.Context, logger *slog.Logger, preset config.Preset, workerCount int, messageCh <-chan syslog.Message, opts ...Option) (*Collector, error) {
+	metricConfigs := preset.Metrics
+
+	var jsonFields []string
+
+	if preset.Format == config.PresetFormatJSON {
+		if preset.FormatIndex != nil {
+			return nil, errors.New("formatIndex is not supported in json presets")
+		}
 
-	metrics := make([]*metric.Metric, len(preset.Metrics))
-	for i, metricConfig := range preset.Metrics {
-		metrics[i], err = metric.New(metricConfig)
+		var err error
+
+		metricConfigs, jsonFields, err = resolveJSONFields(preset.Metrics)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	collector := &Collector{
+		wg:               &sync.WaitGroup{},
+		configs:          metricConfigs,
+		jsonFields:       jsonFields,
+		jsonLines:        preset.Format == config.PresetFormatJSON,
+		maxFields:        preset.MaxFields,
+		formatIndex:      preset.FormatIndex,
+		delimiter:        "\t",
+		workerMetrics:    true,
+		perMetricMetrics: true,
+		metricLogParseError: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "log_parse_errors_total",
+			Help: "Total number of parse errors",
+		}),
+		metricLogLastReceived: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "log_last_received_timestamp_seconds",
+			Help: "Timestamp of the last received log message in seconds since epoch",
+		}),
+		metricLogTooManyFields: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "log_lines_too_many_fields_total",
+			Help: "Total number of log lines skipped because they exceed the maximum number of fields",
+		}),
+		metricLogEmptyLines: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "log_empty_lines_total",
+			Help: "Total number of log lines skipped because the message is empty, e.g. due to a misconfigured log_format",
+		}),
+		metricObservations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "log_metric_observations_total",
+			Help: "Total number of observations recorded per configured metric",
+		}, []string{"metric"}),
+		metricSeriesQuarantined: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "log_series_quarantined_total",
+			Help: "Total number of label sets quarantined after repeated value parse failures per configured metric",
+		}, []string{"metric"}),
+		metricValueRegexpMismatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "log_value_regexp_mismatches_total",
+			Help: "Total number of log lines skipped because valueRegexp did not match per configured metric",
+		}, []string{"metric"}),
+		metricWorkerPanics: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "log_worker_panics_total",
+			Help: "Total number of panics recovered while processing log lines",
+		}),
+		metricWorkerProcessed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "log_worker_processed_total",
+			Help: "Total number of log lines processed per worker",
+		}, []string{"worker"}),
+		metricRateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "log_lines_rate_limited_total",
+			Help: "Total number of log lines dropped because they exceed the maximum number of lines per second",
+		}),
+		metricSyslogDrained: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "syslog_messages_drained_on_shutdown_total",
+			Help: "Total number of buffered syslog messages processed during shutdown or reload",
+		}),
+		metricSyslogDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "syslog_messages_dropped_on_shutdown_total",
+			Help: "Total number of buffered syslog messages dropped during shutdown or reload because draining timed out",
+		}),
+		metricParseSuccessRatio: prometheus.NewDesc(
+			"log_parse_success_ratio",
+			"Ratio of log lines parsed successfully since the start or the last reload",
+			nil, nil,
+		),
+	}
+
+	for _, opt := range opts {
+		opt(collector)
+	}
+
+	collector.metricNames = metricNames(metricConfigs, collector.tenantConfigs)
+
+	if collector.previous != nil {
+		collector.inheritCounters(collector.previous)
+	}
+
+	var userAgent bool
+
+	collector.metrics = make([]*metric.Metric, len(metricConfigs))
+	for i, metricConfig := range metricConfigs {
+		met, err := collector.newMetric(metricConfig)
 		if err != nil {
 			return nil, fmt.Errorf("could not create metric '%s': %w", metricConfig.Name, err)
 		}
 
+		collector.metrics[i] = met
+
 		for _, label := range metricConfig.Labels {
 			if label.UserAgent {
 				userAgent = true
@@ -32,47 +129,223 @@ func New(ctx context.Context, logger *slog.Logger, preset config.Preset, workerC
 		}
 	}
 
+	// Drop the reference, so the previous collector can be garbage collected.
+	collector.previous = nil
+
+	if collector.tenantIndex != nil {
+		if err := collector.newTenantMetrics(); err != nil {
+			return nil, err
+		}
+	}
+
 	if userAgent {
 		logger.WarnContext(ctx, "The user agent parser is currently experimental and changed in the future or may not work as expected. "+
 			"Please report any issues you encounter.")
 	}
 
-	collector := &Collector{
-		wg:      &sync.WaitGroup{},
-		metrics: metrics,
-		metricLogParseError: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: "log_parse_errors_total",
-			Help: "Total number of parse errors",
-		}),
-		metricLogLastReceived: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: "log_last_received_timestamp_seconds",
-			Help: "Timestamp of the last received log message in seconds since epoch",
-		}),
+	if preset.FormatIndex != nil {
+		collector.formats, collector.unformatted = groupMetricsByFormat(preset.Metrics, collector.metrics)
 	}
 
-	collector.lineHandlerWorkers(ctx, logger, workerCount, messageCh)
+	// Treat the start as the last reception to give the pipeline time to deliver the first message.
+	collector.lastReceived.Store(time.Now().UnixNano())
+
+	// Without a message channel, the collector is driven by Feed only.
+	if messageCh != nil {
+		collector.lineHandlerWorkers(ctx, logger, workerCount, messageCh)
+	}
 
 	return collector, nil
 }
 
+// newMetric creates the metric for metricConfig, or reuses the metric of the previous collector
+// if its configuration is unchanged, see [WithPrevious].
+func (c *Collector) newMetric(metricConfig config.Metric) (*metric.Metric, error) {
+	if met, ok := c.previousMetric(metricConfig); ok {
+		return met, nil
+	}
+
+	//nolint:wrapcheck
+	return metric.New(metricConfig,
+		metric.WithBucketSets(c.bucketSets),
+		metric.WithObservationCounter(c.metricObservations.WithLabelValues(metricConfig.Name)),
+		metric.WithQuarantineCounter(c.metricSeriesQuarantined.WithLabelValues(metricConfig.Name)),
+		metric.WithValueRegexpMismatchCounter(c.metricValueRegexpMismatches.WithLabelValues(metricConfig.Name)),
+	)
+}
+
+// groupMetricsByFormat returns the metrics applied to lines of each log format.
+// Metrics without a format apply to all lines, including lines of unknown formats.
+func groupMetricsByFormat(configs []config.Metric, metrics []*metric.Metric) (map[string][]*metric.Metric, []*metric.Metric) {
+	formats := make(map[string][]*metric.Metric)
+	unformatted := make([]*metric.Metric, 0, len(metrics))
+
+	for _, metricConfig := range configs {
+		if metricConfig.Format != "" {
+			formats[metricConfig.Format] = nil
+		}
+	}
+
+	for i, metricConfig := range configs {
+		if metricConfig.Format == "" {
+			unformatted = append(unformatted, metrics[i])
+		}
+
+		for format := range formats {
+			if metricConfig.Format == "" || metricConfig.Format == format {
+				formats[format] = append(formats[format], metrics[i])
+			}
+		}
+	}
+
+	return formats, unformatted
+}
+
+// WithDelimiter sets the delimiter between the fields of a log line. The default is a tab.
+// Delimiters with multiple characters are matched as a whole, like [strings.Split]. An empty delimiter is ignored.
+func WithDelimiter(delimiter string) Option {
+	return func(c *Collector) {
+		if delimiter != "" {
+			c.delimiter = delimiter
+		}
+	}
+}
+
+// WithWorkerMetrics enables or disables the collection of log_worker_panics_total and log_worker_processed_total.
+// They are enabled by default.
+func WithWorkerMetrics(enabled bool) Option {
+	return func(c *Collector) {
+		c.workerMetrics = enabled
+	}
+}
+
+// WithPerMetricMetrics enables or disables the collection of the self-metrics labeled by configured metric,
+// e.g. log_metric_observations_total. They are enabled by default.
+func WithPerMetricMetrics(enabled bool) Option {
+	return func(c *Collector) {
+		c.perMetricMetrics = enabled
+	}
+}
+
+// WithBucketSets sets the named bucket sets histograms may reference by bucketSet.
+func WithBucketSets(bucketSets map[string]types.Float64Slice) Option {
+	return func(c *Collector) {
+		c.bucketSets = bucketSets
+	}
+}
+
+// WithMaxLinesPerSecond limits the number of processed lines per second. Excess lines are dropped
+// and counted in log_lines_rate_limited_total. A rate of 0 or below disables the limit.
+func WithMaxLinesPerSecond(rate float64) Option {
+	return func(c *Collector) {
+		if rate > 0 {
+			c.rateLimiter = newRateLimiter(rate)
+		}
+	}
+}
+
 // Describe implements the prometheus.Collector interface.
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	c.metricLogParseError.Describe(ch)
 	c.metricLogLastReceived.Describe(ch)
+	c.metricLogTooManyFields.Describe(ch)
+	c.metricLogEmptyLines.Describe(ch)
+	c.metricRateLimited.Describe(ch)
+	c.metricSyslogDrained.Describe(ch)
+	c.metricSyslogDropped.Describe(ch)
+	ch <- c.metricParseSuccessRatio
 
-	for _, met := range c.metrics {
-		met.Describe(ch)
+	if c.perMetricMetrics {
+		c.metricObservations.Describe(ch)
+		c.metricSeriesQuarantined.Describe(ch)
+		c.metricValueRegexpMismatches.Describe(ch)
 	}
+
+	if c.workerMetrics {
+		c.metricWorkerPanics.Describe(ch)
+		c.metricWorkerProcessed.Describe(ch)
+	}
+
+	c.PresetMetrics().Describe(ch)
 }
 
 // Collect implements the prometheus.Collector interface.
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	c.metricLogParseError.Collect(ch)
 	c.metricLogLastReceived.Collect(ch)
+	c.metricLogTooManyFields.Collect(ch)
+	c.metricLogEmptyLines.Collect(ch)
+	c.metricRateLimited.Collect(ch)
+	c.metricSyslogDrained.Collect(ch)
+	c.metricSyslogDropped.Collect(ch)
+	c.collectParseSuccessRatio(ch)
 
-	for _, met := range c.metrics {
+	if c.perMetricMetrics {
+		c.metricObservations.Collect(ch)
+		c.metricSeriesQuarantined.Collect(ch)
+		c.metricValueRegexpMismatches.Collect(ch)
+	}
+
+	if c.workerMetrics {
+		c.metricWorkerPanics.Collect(ch)
+		c.metricWorkerProcessed.Collect(ch)
+	}
+
+	c.PresetMetrics().Collect(ch)
+}
+
+// presetMetrics collects the configured metrics of a [Collector] without its self-metrics.
+type presetMetrics struct {
+	c *Collector
+}
+
+// PresetMetrics returns a collector for the metrics configured by the preset and the tenants only,
+// e.g. to compare them with a snapshot. Unlike the self-metrics, they don't depend on the time or the workers.
+func (c *Collector) PresetMetrics() prometheus.Collector {
+	return presetMetrics{c: c}
+}
+
+func (p presetMetrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, met := range p.c.metrics {
+		met.Describe(ch)
+	}
+
+	for _, met := range p.c.tenantMetrics {
+		met.Describe(ch)
+	}
+}
+
+func (p presetMetrics) Collect(ch chan<- prometheus.Metric) {
+	for _, met := range p.c.metrics {
 		met.Collect(ch)
 	}
+
+	for _, met := range p.c.tenantMetrics {
+		met.Collect(ch)
+	}
+}
+
+// LastReceived returns the time of the last received log message or the creation time of the collector
+// if no message has been received yet.
+func (c *Collector) LastReceived() time.Time {
+	return time.Unix(0, c.lastReceived.Load())
+}
+
+// ParseStats returns the number of lines parsed since the collector was created and how many of them failed to parse.
+// Lines dropped before parsing, e.g. by the rate limit, are not included.
+func (c *Collector) ParseStats() (uint64, uint64) {
+	return c.linesParsed.Load(), c.linesFailed.Load()
+}
+
+// collectParseSuccessRatio computes log_parse_success_ratio from the [Collector.ParseStats] on each scrape.
+// It's omitted until the first line is parsed, since the ratio is undefined without lines.
+func (c *Collector) collectParseSuccessRatio(ch chan<- prometheus.Metric) {
+	parsed, failed := c.ParseStats()
+	if parsed == 0 {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.metricParseSuccessRatio, prometheus.GaugeValue, 1-float64(failed)/float64(parsed))
 }
 
 // Close stops the collector and waits for all workers to finish.
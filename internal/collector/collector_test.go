@@ -1,14 +1,24 @@
 package collector_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/jkroepke/access-log-exporter/internal/collector"
 	"github.com/jkroepke/access-log-exporter/internal/config"
 	"github.com/jkroepke/access-log-exporter/internal/syslog"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 	"github.com/stretchr/testify/require"
 )
 
@@ -32,6 +42,714 @@ func TestCollectorExposesLastReceivedMetric(t *testing.T) {
 	}, time.Second, 10*time.Millisecond)
 }
 
+func TestCollectorSkipsLinesWithTooManyFields(t *testing.T) {
+	t.Parallel()
+
+	messageCh := make(chan syslog.Message)
+
+	preset := newTestPreset()
+	preset.MaxFields = 20
+
+	col, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), preset, 1, messageCh)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		close(messageCh)
+		col.Close()
+	})
+
+	fields := make([]string, 200)
+	for i := range fields {
+		fields[i] = strconv.Itoa(i)
+	}
+
+	messageCh <- syslog.Message{Line: strings.Join(fields, "\t")}
+
+	expected := `
+# HELP log_lines_too_many_fields_total Total number of log lines skipped because they exceed the maximum number of fields
+# TYPE log_lines_too_many_fields_total counter
+log_lines_too_many_fields_total 1
+`
+
+	require.Eventually(t, func() bool {
+		return testutil.CollectAndCompare(col, strings.NewReader(expected), "log_lines_too_many_fields_total") == nil
+	}, time.Second, 10*time.Millisecond)
+
+	require.Zero(t, testutil.CollectAndCount(col, "http_requests_total"))
+}
+
+func TestCollectorCountsEmptyLines(t *testing.T) {
+	t.Parallel()
+
+	messageCh := make(chan syslog.Message)
+
+	col, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), newTestPreset(), 1, messageCh)
+	require.NoError(t, err)
+
+	// The payload of "<190>Aug 15 20:16:01 nginx: " is empty after stripping the header.
+	messageCh <- syslog.Message{Line: ""}
+	messageCh <- syslog.Message{Line: "example.com\tGET\t200"}
+
+	close(messageCh)
+	col.Close()
+
+	expected := `
+# HELP log_empty_lines_total Total number of log lines skipped because the message is empty, e.g. due to a misconfigured log_format
+# TYPE log_empty_lines_total counter
+log_empty_lines_total 1
+# HELP log_parse_errors_total Total number of parse errors
+# TYPE log_parse_errors_total counter
+log_parse_errors_total 0
+`
+
+	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(expected), "log_empty_lines_total", "log_parse_errors_total"))
+	require.Equal(t, 1, testutil.CollectAndCount(col, "http_requests_total"))
+}
+
+func TestCollectorCountsProcessedLinesPerWorker(t *testing.T) {
+	t.Parallel()
+
+	const workerCount = 4
+
+	messageCh := make(chan syslog.Message)
+
+	col, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), newTestPreset(), workerCount, messageCh)
+	require.NoError(t, err)
+
+	for range 100 {
+		messageCh <- syslog.Message{Line: "example.com\tGET\t200"}
+	}
+
+	close(messageCh)
+	col.Close()
+
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(col))
+
+	metricFamilies, err := reg.Gather()
+	require.NoError(t, err)
+
+	idx := slices.IndexFunc(metricFamilies, func(mf *dto.MetricFamily) bool {
+		return mf.GetName() == "log_worker_processed_total"
+	})
+	require.NotEqual(t, -1, idx)
+
+	workers := make([]string, 0, workerCount)
+
+	var processed float64
+
+	for _, m := range metricFamilies[idx].GetMetric() {
+		workers = append(workers, m.GetLabel()[0].GetValue())
+		processed += m.GetCounter().GetValue()
+	}
+
+	require.ElementsMatch(t, []string{"0", "1", "2", "3"}, workers)
+	require.InDelta(t, 100, processed, 0)
+}
+
+func TestCollectorCountsMetricObservations(t *testing.T) {
+	t.Parallel()
+
+	messageCh := make(chan syslog.Message)
+
+	preset := newTestPreset()
+	preset.Metrics = append(preset.Metrics, config.Metric{
+		Name:       "http_response_size_bytes",
+		Type:       "counter",
+		Help:       "The total size of responses.",
+		ValueIndex: new(uint(3)),
+	})
+
+	col, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), preset, 1, messageCh)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		close(messageCh)
+		col.Close()
+	})
+
+	// The response size is only observed if the value is present.
+	messageCh <- syslog.Message{Line: "example.com\tGET\t200\t512"}
+	messageCh <- syslog.Message{Line: "example.com\tGET\t200\t-"}
+	messageCh <- syslog.Message{Line: "example.com\tGET\t200\t-"}
+
+	expected := `
+# HELP log_metric_observations_total Total number of observations recorded per configured metric
+# TYPE log_metric_observations_total counter
+log_metric_observations_total{metric="http_requests_total"} 3
+log_metric_observations_total{metric="http_response_size_bytes"} 1
+`
+
+	require.Eventually(t, func() bool {
+		return testutil.CollectAndCompare(col, strings.NewReader(expected), "log_metric_observations_total") == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCollectorRecoversFromPanics(t *testing.T) {
+	t.Parallel()
+
+	messageCh := make(chan syslog.Message)
+
+	// A replacement without a string to match dereferences a nil pointer while parsing.
+	preset := newTestPreset()
+	preset.Metrics[0].Labels[0].Replacements = []config.Replacement{
+		{StringReplacer: strings.NewReplacer("example.com", "example.org")},
+	}
+
+	col, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), preset, 1, messageCh)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		close(messageCh)
+		col.Close()
+	})
+
+	// With a single worker, the second message is only received if the worker survived the first panic.
+	messageCh <- syslog.Message{Line: "example.com\tGET\t200"}
+	messageCh <- syslog.Message{Line: "example.com\tGET\t200"}
+
+	expected := `
+# HELP log_worker_panics_total Total number of panics recovered while processing log lines
+# TYPE log_worker_panics_total counter
+log_worker_panics_total 2
+`
+
+	require.Eventually(t, func() bool {
+		return testutil.CollectAndCompare(col, strings.NewReader(expected), "log_worker_panics_total") == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCollectorFeed(t *testing.T) {
+	t.Parallel()
+
+	preset := newTestPreset()
+	preset.MaxFields = 5
+
+	col, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), preset, 0, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(col.Close)
+
+	require.NoError(t, col.Feed("example.com\tGET\t200"))
+	require.NoError(t, col.Feed("example.com\tGET\t200"))
+	require.NoError(t, col.Feed("example.com\tPOST\t201"))
+	require.ErrorIs(t, col.Feed("example.com\tGET\t200\t1\t2\t3"), collector.ErrTooManyFields)
+	require.Error(t, col.Feed("example.com"))
+
+	expected := `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{host="example.com",method="GET",status="200"} 2
+http_requests_total{host="example.com",method="POST",status="201"} 1
+# HELP log_parse_errors_total Total number of parse errors
+# TYPE log_parse_errors_total counter
+log_parse_errors_total 1
+`
+
+	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(expected), "http_requests_total", "log_parse_errors_total"))
+}
+
+func TestCollectorParseSuccessRatio(t *testing.T) {
+	t.Parallel()
+
+	col, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), newTestPreset(), 0, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(col.Close)
+
+	// Without parsed lines, the ratio is omitted.
+	require.Zero(t, testutil.CollectAndCount(col, "log_parse_success_ratio"))
+
+	require.NoError(t, col.Feed("example.com\tGET\t200"))
+	require.NoError(t, col.Feed("example.com\tGET\t200"))
+	require.NoError(t, col.Feed("example.com\tPOST\t201"))
+	require.Error(t, col.Feed("example.com"))
+
+	expected := `
+# HELP log_parse_success_ratio Ratio of log lines parsed successfully since the start or the last reload
+# TYPE log_parse_success_ratio gauge
+log_parse_success_ratio 0.75
+`
+
+	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(expected), "log_parse_success_ratio"))
+}
+
+func TestCollectorDelimiter(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name      string
+		delimiter string
+		line      string
+	}{
+		{name: "pipe", delimiter: "|", line: "example.com|GET|200"},
+		{name: "space", delimiter: " ", line: "example.com GET 200"},
+		{name: "multiple characters", delimiter: " | ", line: "example.com | GET | 200"},
+		{name: "multibyte rune", delimiter: "¦", line: "example.com¦GET¦200"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			preset := newTestPreset()
+			preset.MaxFields = 3
+
+			col, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), preset, 0, nil, collector.WithDelimiter(tc.delimiter))
+			require.NoError(t, err)
+
+			t.Cleanup(col.Close)
+
+			require.NoError(t, col.Feed(tc.line))
+			require.ErrorIs(t, col.Feed(tc.line+tc.delimiter+"1"), collector.ErrTooManyFields)
+
+			expected := `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{host="example.com",method="GET",status="200"} 1
+`
+
+			require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(expected), "http_requests_total"))
+		})
+	}
+}
+
+func TestCollectorJSON(t *testing.T) {
+	t.Parallel()
+
+	tabPreset := newTestPreset()
+	tabPreset.Metrics = append(tabPreset.Metrics, config.Metric{
+		Name:       "http_request_duration_seconds",
+		Type:       "histogram",
+		Help:       "The time spent on processing the request.",
+		ValueIndex: new(uint(3)),
+		Buckets:    []float64{0.1, 1},
+		Labels: []config.Label{
+			{Name: "host", LineIndex: 0},
+		},
+	})
+
+	jsonPreset := config.Preset{
+		Format: config.PresetFormatJSON,
+		Metrics: []config.Metric{
+			{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+				Labels: []config.Label{
+					{Name: "host", Field: "host"},
+					{Name: "method", Field: "method"},
+					{Name: "status", Field: "status"},
+				},
+			},
+			{
+				Name:       "http_request_duration_seconds",
+				Type:       "histogram",
+				Help:       "The time spent on processing the request.",
+				ValueField: "request_time",
+				Buckets:    []float64{0.1, 1},
+				Labels: []config.Label{
+					{Name: "host", Field: "host"},
+				},
+			},
+		},
+	}
+
+	tabCollector, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), tabPreset, 0, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(tabCollector.Close)
+
+	jsonCollector, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), jsonPreset, 0, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(jsonCollector.Close)
+
+	require.NoError(t, tabCollector.Feed("a\tGET\t200\t0.05"))
+	require.NoError(t, tabCollector.Feed("a\tPOST\t201\t0.5"))
+	require.NoError(t, tabCollector.Feed("b\tGET\t200\t-"))
+
+	require.NoError(t, jsonCollector.Feed(`{"host":"a","method":"GET","status":"200","request_time":"0.05"}`))
+	// Numbers are kept as their JSON representation, unknown fields are ignored.
+	require.NoError(t, jsonCollector.Feed(`{"host":"a","method":"POST","status":201,"request_time":0.5,"referer":"-"}`))
+	// Missing fields are empty, so the value is skipped like "-".
+	require.NoError(t, jsonCollector.Feed(`{"method":"GET","host":"b","status":"200"}`))
+	require.Error(t, jsonCollector.Feed(`host=a method=GET`))
+
+	expected, err := testutil.CollectAndFormat(tabCollector, expfmt.TypeTextPlain, "http_requests_total", "http_request_duration_seconds")
+	require.NoError(t, err)
+
+	actual, err := testutil.CollectAndFormat(jsonCollector, expfmt.TypeTextPlain, "http_requests_total", "http_request_duration_seconds")
+	require.NoError(t, err)
+
+	require.NotEmpty(t, expected)
+	require.Equal(t, string(expected), string(actual))
+
+	// The line which isn't a JSON object is counted as parse error.
+	require.NoError(t, testutil.CollectAndCompare(jsonCollector, strings.NewReader(`
+# HELP log_parse_errors_total Total number of parse errors
+# TYPE log_parse_errors_total counter
+log_parse_errors_total 1
+`), "log_parse_errors_total"))
+}
+
+func TestCollectorJSONErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name   string
+		preset config.Preset
+		err    string
+	}{
+		{
+			name: "label without field",
+			preset: config.Preset{
+				Format: config.PresetFormatJSON,
+				Metrics: []config.Metric{
+					{Name: "http_requests_total", Type: "counter", Labels: []config.Label{{Name: "host", LineIndex: 0}}},
+				},
+			},
+			err: "could not create metric 'http_requests_total': label 'host' requires a field in json presets",
+		},
+		{
+			name: "valueIndex",
+			preset: config.Preset{
+				Format: config.PresetFormatJSON,
+				Metrics: []config.Metric{
+					{Name: "http_request_duration_seconds", Type: "histogram", ValueIndex: new(uint(1))},
+				},
+			},
+			err: "could not create metric 'http_request_duration_seconds': valueIndex is not supported in json presets, use valueField instead",
+		},
+		{
+			name: "bucketOverrides",
+			preset: config.Preset{
+				Format: config.PresetFormatJSON,
+				Metrics: []config.Metric{
+					{
+						Name:            "http_request_duration_seconds",
+						Type:            "histogram",
+						ValueField:      "request_time",
+						BucketOverrides: []config.BucketOverride{{LineIndex: 1, Values: []string{"500"}, Buckets: []float64{1}}},
+						Labels:          []config.Label{{Name: "status", Field: "status"}},
+					},
+				},
+			},
+			err: "could not create metric 'http_request_duration_seconds': bucketOverrides is not supported in json presets",
+		},
+		{
+			name: "dropIfLabelMatches",
+			preset: config.Preset{
+				Format: config.PresetFormatJSON,
+				Metrics: []config.Metric{
+					{
+						Name:               "http_requests_total",
+						Type:               "counter",
+						DropIfLabelMatches: []config.LabelMatch{{LabelIndex: 1, Regexp: regexp.MustCompile("^/health$")}},
+						Labels:             []config.Label{{Name: "path", Field: "path"}},
+					},
+				},
+			},
+			err: "could not create metric 'http_requests_total': dropIfLabelMatches is not supported in json presets",
+		},
+		{
+			name: "valueExpression with fields",
+			preset: config.Preset{
+				Format: config.PresetFormatJSON,
+				Metrics: []config.Metric{
+					{
+						Name:            "http_response_size_bytes",
+						Type:            "counter",
+						ValueField:      "bytes",
+						ValueExpression: "value / fields[2]",
+					},
+				},
+			},
+			err: "could not create metric 'http_response_size_bytes': fields in valueExpression are not supported in json presets, only value",
+		},
+		{
+			name: "formatIndex",
+			preset: config.Preset{
+				Format:      config.PresetFormatJSON,
+				FormatIndex: new(uint(0)),
+			},
+			err: "formatIndex is not supported in json presets",
+		},
+		{
+			name: "field without json format",
+			preset: config.Preset{
+				Metrics: []config.Metric{
+					{Name: "http_requests_total", Type: "counter", Labels: []config.Label{{Name: "host", Field: "host"}}},
+				},
+			},
+			err: "could not create metric 'http_requests_total': label 'host': field requires a preset with format json",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), tc.preset, 0, nil)
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestCollectorRateLimit(t *testing.T) {
+	t.Parallel()
+
+	col, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), newTestPreset(), 0, nil,
+		collector.WithMaxLinesPerSecond(1),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(col.Close)
+
+	var dropped int
+
+	for range 100 {
+		err := col.Feed("example.com\tGET\t200")
+		if errors.Is(err, collector.ErrRateLimited) {
+			dropped++
+
+			continue
+		}
+
+		require.NoError(t, err)
+	}
+
+	// The bucket holds a single token, which refills within a second. Feeding 100 lines
+	// should take far less, so nearly all lines beyond the first are dropped.
+	require.GreaterOrEqual(t, dropped, 90)
+
+	expected := fmt.Sprintf(`
+# HELP log_lines_rate_limited_total Total number of log lines dropped because they exceed the maximum number of lines per second
+# TYPE log_lines_rate_limited_total counter
+log_lines_rate_limited_total %d
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{host="example.com",method="GET",status="200"} %d
+`, dropped, 100-dropped)
+
+	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(expected), "log_lines_rate_limited_total", "http_requests_total"))
+}
+
+func TestCollectorFormats(t *testing.T) {
+	t.Parallel()
+
+	preset := config.Preset{
+		FormatIndex: new(uint(0)),
+		Metrics: []config.Metric{
+			{
+				Name: "log_lines_total",
+				Type: "counter",
+				Help: "The total number of log lines.",
+			},
+			{
+				Name:   "http_requests_total",
+				Type:   "counter",
+				Help:   "The total number of client requests.",
+				Format: "access",
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 1,
+					},
+				},
+			},
+			{
+				Name:       "mail_messages_size_bytes_total",
+				Type:       "counter",
+				Help:       "The total size of sent mail messages.",
+				Format:     "mail",
+				ValueIndex: new(uint(2)),
+				Labels: []config.Label{
+					{
+						Name:      "recipient_domain",
+						LineIndex: 1,
+					},
+				},
+			},
+		},
+	}
+
+	col, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), preset, 0, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(col.Close)
+
+	require.NoError(t, col.Feed("access\texample.com"))
+	require.NoError(t, col.Feed("access\texample.com"))
+	require.NoError(t, col.Feed("mail\texample.org\t1024"))
+	require.NoError(t, col.Feed("unknown\texample.net"))
+
+	expected := `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{host="example.com"} 2
+# HELP log_lines_total The total number of log lines.
+# TYPE log_lines_total counter
+log_lines_total 4
+# HELP mail_messages_size_bytes_total The total size of sent mail messages.
+# TYPE mail_messages_size_bytes_total counter
+mail_messages_size_bytes_total{recipient_domain="example.org"} 1024
+`
+
+	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(expected), "http_requests_total", "log_lines_total", "mail_messages_size_bytes_total"))
+}
+
+func TestCollectorTenants(t *testing.T) {
+	t.Parallel()
+
+	tenantPreset := config.Preset{
+		Metrics: []config.Metric{
+			{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+				Labels: []config.Label{
+					{
+						Name:      "status",
+						LineIndex: 1,
+					},
+				},
+			},
+		},
+	}
+
+	col, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), config.Preset{
+		Metrics: []config.Metric{
+			{
+				Name: "log_lines_total",
+				Type: "counter",
+				Help: "The total number of log lines.",
+			},
+		},
+	}, 0, nil, collector.WithTenants(0, []collector.Tenant{
+		{Value: "shop", Namespace: "shop", Preset: tenantPreset},
+		{Value: "blog", Namespace: "blog", Preset: tenantPreset},
+	}))
+	require.NoError(t, err)
+
+	t.Cleanup(col.Close)
+
+	require.NoError(t, col.Feed("shop\t200"))
+	require.NoError(t, col.Feed("shop\t500"))
+	require.NoError(t, col.Feed("blog\t200"))
+	require.NoError(t, col.Feed("unknown\t200"))
+
+	expected := `
+# HELP blog_http_requests_total The total number of client requests.
+# TYPE blog_http_requests_total counter
+blog_http_requests_total{status="200"} 1
+# HELP log_lines_total The total number of log lines.
+# TYPE log_lines_total counter
+log_lines_total 1
+# HELP shop_http_requests_total The total number of client requests.
+# TYPE shop_http_requests_total counter
+shop_http_requests_total{status="200"} 1
+shop_http_requests_total{status="500"} 1
+# HELP log_metric_observations_total Total number of observations recorded per configured metric
+# TYPE log_metric_observations_total counter
+log_metric_observations_total{metric="blog_http_requests_total"} 1
+log_metric_observations_total{metric="log_lines_total"} 1
+log_metric_observations_total{metric="shop_http_requests_total"} 2
+`
+
+	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(expected),
+		"blog_http_requests_total", "log_lines_total", "shop_http_requests_total", "log_metric_observations_total"))
+
+	_, err = collector.New(t.Context(), slog.New(slog.DiscardHandler), config.Preset{}, 0, nil, collector.WithTenants(0, []collector.Tenant{
+		{Value: "shop", Namespace: "shop", Preset: config.Preset{FormatIndex: new(uint(1))}},
+	}))
+	require.EqualError(t, err, "tenant 'shop': format and formatIndex are not supported in tenant presets")
+}
+
+func TestCollectorTenantsReload(t *testing.T) {
+	t.Parallel()
+
+	tenantPreset := config.Preset{
+		Metrics: []config.Metric{
+			{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+			},
+		},
+	}
+
+	previous, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), config.Preset{}, 0, nil, collector.WithTenants(0, []collector.Tenant{
+		{Value: "shop", Namespace: "shop", Preset: tenantPreset},
+		{Value: "blog", Namespace: "blog", Preset: tenantPreset},
+	}))
+	require.NoError(t, err)
+
+	t.Cleanup(previous.Close)
+
+	require.NoError(t, previous.Feed("shop"))
+	require.NoError(t, previous.Feed("blog"))
+
+	col, err := collector.New(t.Context(), slog.New(slog.DiscardHandler), config.Preset{}, 0, nil,
+		collector.WithPrevious(previous),
+		collector.WithTenants(0, []collector.Tenant{
+			{Value: "shop", Namespace: "shop", Preset: tenantPreset},
+		}),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(col.Close)
+
+	// The series of the removed tenant are gone, the series of the remaining tenant keep counting.
+	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(`
+# HELP log_metric_observations_total Total number of observations recorded per configured metric
+# TYPE log_metric_observations_total counter
+log_metric_observations_total{metric="shop_http_requests_total"} 1
+`), "log_metric_observations_total"))
+}
+
+func TestCollectorDrain(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(t.Context())
+
+	messageCh := make(chan syslog.Message, 10)
+
+	col, err := collector.New(ctx, slog.New(slog.DiscardHandler), newTestPreset(), 1, messageCh)
+	require.NoError(t, err)
+
+	// Stop the workers first, so the buffered messages are left to Drain.
+	cancel()
+	col.Close()
+
+	for range 3 {
+		messageCh <- syslog.Message{Line: "example.com\tGET\t200"}
+	}
+
+	drained, dropped := col.Drain(t.Context(), slog.New(slog.DiscardHandler), messageCh)
+	require.Equal(t, 3, drained)
+	require.Zero(t, dropped)
+
+	messageCh <- syslog.Message{Line: "example.com\tGET\t200"}
+	messageCh <- syslog.Message{Line: "example.com\tGET\t200"}
+
+	// An expired context drops everything left in the buffer.
+	drained, dropped = col.Drain(ctx, slog.New(slog.DiscardHandler), messageCh)
+	require.Zero(t, drained)
+	require.Equal(t, 2, dropped)
+
+	expected := `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{host="example.com",method="GET",status="200"} 3
+# HELP syslog_messages_drained_on_shutdown_total Total number of buffered syslog messages processed during shutdown or reload
+# TYPE syslog_messages_drained_on_shutdown_total counter
+syslog_messages_drained_on_shutdown_total 3
+# HELP syslog_messages_dropped_on_shutdown_total Total number of buffered syslog messages dropped during shutdown or reload because draining timed out
+# TYPE syslog_messages_dropped_on_shutdown_total counter
+syslog_messages_dropped_on_shutdown_total 2
+`
+
+	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(expected), "http_requests_total",
+		"syslog_messages_drained_on_shutdown_total", "syslog_messages_dropped_on_shutdown_total"))
+}
+
 func newTestPreset() config.Preset {
 	return config.Preset{
 		Metrics: []config.Metric{
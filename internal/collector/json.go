@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jkroepke/access-log-exporter/internal/config"
+)
+
+// resolveJSONFields maps the field names referenced by the metrics of a json preset to field indices.
+// Field 0 is the raw line, so the default requireNonEmptyIndex always passes. The referenced fields follow
+// in order of first use. The returned metric configurations use these indices, so the metrics are unaware of JSON.
+func resolveJSONFields(metrics []config.Metric) ([]config.Metric, []string, error) {
+	resolved := make([]config.Metric, len(metrics))
+	fields := make([]string, 0)
+
+	index := func(field string) uint {
+		i := slices.Index(fields, field)
+		if i == -1 {
+			fields = append(fields, field)
+			i = len(fields) - 1
+		}
+
+		return uint(i) + 1
+	}
+
+	for i, metricConfig := range metrics {
+		if err := validateJSONMetric(metricConfig); err != nil {
+			return nil, nil, fmt.Errorf("could not create metric '%s': %w", metricConfig.Name, err)
+		}
+
+		if metricConfig.ValueField != "" {
+			metricConfig.ValueIndex = new(index(metricConfig.ValueField))
+			metricConfig.ValueField = ""
+		}
+
+		metricConfig.Labels = slices.Clone(metricConfig.Labels)
+		for j, label := range metricConfig.Labels {
+			metricConfig.Labels[j].LineIndex = index(label.Field)
+			metricConfig.Labels[j].Field = ""
+		}
+
+		resolved[i] = metricConfig
+	}
+
+	return resolved, fields, nil
+}
+
+// validateJSONMetric ensures a metric of a json preset selects its fields by name only.
+func validateJSONMetric(metricConfig config.Metric) error {
+	switch {
+	case metricConfig.ValueIndex != nil:
+		return errors.New("valueIndex is not supported in json presets, use valueField instead")
+	case metricConfig.ValueRegexp != nil:
+		return errors.New("valueRegexp is not supported in json presets")
+	case metricConfig.RatioIndices != nil:
+		return errors.New("ratioIndices is not supported in json presets")
+	case metricConfig.RequireNonEmptyIndex != nil:
+		return errors.New("requireNonEmptyIndex is not supported in json presets")
+	case metricConfig.Upstream.Enabled:
+		return errors.New("upstream is not supported in json presets")
+	case metricConfig.GaugeWhen != nil:
+		return errors.New("gaugeWhen is not supported in json presets")
+	case metricConfig.ExemplarLabelIndex != nil:
+		return errors.New("exemplarLabelIndex is not supported in json presets")
+	case len(metricConfig.BucketOverrides) != 0:
+		return errors.New("bucketOverrides is not supported in json presets")
+	case len(metricConfig.DropIfLabelMatches) != 0:
+		return errors.New("dropIfLabelMatches is not supported in json presets")
+	case strings.Contains(metricConfig.ValueExpression, "fields"):
+		return errors.New("fields in valueExpression are not supported in json presets, only value")
+	}
+
+	for _, label := range metricConfig.Labels {
+		if label.Field == "" {
+			return fmt.Errorf("label '%s' requires a field in json presets", label.Name)
+		}
+	}
+
+	return nil
+}
+
+// splitJSONFields decodes a JSON object and returns the raw line followed by the values of c.jsonFields,
+// reusing the fields slice. Strings are unquoted, missing fields and null are empty,
+// other values like numbers are kept as their JSON representation.
+func (c *Collector) splitJSONFields(fields []string, line string) ([]string, error) {
+	var object map[string]json.RawMessage
+
+	if err := json.Unmarshal([]byte(line), &object); err != nil {
+		return fields[:0], fmt.Errorf("failed to decode JSON line: %w", err)
+	}
+
+	if c.maxFields > 0 && len(object) > c.maxFields {
+		return fields[:0], ErrTooManyFields
+	}
+
+	fields = append(fields[:0], line)
+
+	for _, name := range c.jsonFields {
+		raw, ok := object[name]
+
+		switch {
+		case !ok, string(raw) == "null":
+			fields = append(fields, "")
+		case len(raw) != 0 && raw[0] == '"':
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return fields, fmt.Errorf("failed to decode JSON field '%s': %w", name, err)
+			}
+
+			fields = append(fields, value)
+		default:
+			fields = append(fields, string(raw))
+		}
+	}
+
+	return fields, nil
+}
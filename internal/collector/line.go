@@ -6,9 +6,21 @@ import (
 	"fmt"
 	"log/slog"
 	"runtime"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/jkroepke/access-log-exporter/internal/metric"
 	"github.com/jkroepke/access-log-exporter/internal/syslog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// ErrTooManyFields is returned by [Collector.Feed] if a line exceeds the maximum number of fields.
+	ErrTooManyFields = errors.New("line exceeds the maximum number of fields")
+	// ErrRateLimited is returned by [Collector.Feed] if a line exceeds the maximum number of lines per second.
+	ErrRateLimited = errors.New("line exceeds the maximum number of lines per second")
 )
 
 // lineHandlerWorkers starts several workers that will handle incoming
@@ -20,9 +32,18 @@ func (c *Collector) lineHandlerWorkers(ctx context.Context, logger *slog.Logger,
 		workerCount = runtime.NumCPU()
 	}
 
-	for range workerCount {
+	// Drop the series of workers which no longer exist, e.g. after a reload with fewer workers.
+	for worker := workerCount; ; worker++ {
+		if !c.metricWorkerProcessed.DeleteLabelValues(strconv.Itoa(worker)) {
+			break
+		}
+	}
+
+	for worker := range workerCount {
+		processed := c.metricWorkerProcessed.WithLabelValues(strconv.Itoa(worker))
+
 		c.wg.Go(func() {
-			c.lineHandlerWorker(ctx, logger, messageCh)
+			c.lineHandlerWorker(ctx, logger, messageCh, processed)
 		})
 	}
 
@@ -30,12 +51,10 @@ func (c *Collector) lineHandlerWorkers(ctx context.Context, logger *slog.Logger,
 }
 
 // lineHandlerWorker is a worker that will read messages from the message channel
-// and call the lineHandler method to process them.
-// It will log any errors that occur during parsing and increment the metricLogParseError.
+// and call the handleMessage method to process them.
 // The worker will stop when the context is done or when the message channel is closed.
-func (c *Collector) lineHandlerWorker(ctx context.Context, logger *slog.Logger, messageCh <-chan syslog.Message) {
-	var err error
-
+// Each handled message increments processed, which exposes an uneven distribution of work across workers.
+func (c *Collector) lineHandlerWorker(ctx context.Context, logger *slog.Logger, messageCh <-chan syslog.Message, processed prometheus.Counter) {
 	fields := make([]string, 0, 16)
 
 	for {
@@ -47,31 +66,152 @@ func (c *Collector) lineHandlerWorker(ctx context.Context, logger *slog.Logger,
 				return
 			}
 
-			c.metricLogLastReceived.SetToCurrentTime()
+			fields = c.handleMessage(ctx, logger, msg, fields)
 
-			fields = splitLineFields(fields, msg.Line)
+			processed.Inc()
+		}
+	}
+}
 
-			err = c.lineHandler(fields)
-			if err != nil {
-				logger.LogAttrs(
-					ctx, slog.LevelDebug, "error parsing metric",
-					slog.Any("err", err),
-					slog.String("line", msg.Line),
-				)
+// Drain processes the messages left in messageCh after the workers stopped, e.g. on shutdown or reload.
+// Draining stops once messageCh is empty or ctx is done. Messages left at that point are dropped.
+// Both are counted and returned, so the loss of a restart is visible.
+// The sender must stop writing to messageCh before, otherwise Drain may return before all messages are processed.
+func (c *Collector) Drain(ctx context.Context, logger *slog.Logger, messageCh chan syslog.Message) (int, int) {
+	fields := make([]string, 0, 16)
+	drained := 0
 
-				c.metricLogParseError.Inc()
-			}
+	for {
+		if ctx.Err() != nil {
+			dropped := len(messageCh)
+			c.metricSyslogDropped.Add(float64(dropped))
+
+			return drained, dropped
+		}
+
+		select {
+		case msg := <-messageCh:
+			fields = c.handleMessage(ctx, logger, msg, fields)
 
-			msg.Release()
+			c.metricSyslogDrained.Inc()
+
+			drained++
+		default:
+			return drained, 0
 		}
 	}
 }
 
+// handleMessage calls the processLine method for a single message.
+// It will log any errors that occur during parsing.
+// A panic during processing is recovered, logged and counted, so the worker keeps processing the next message.
+// The fields slice is reused between calls to avoid allocations and returned for the next call.
+func (c *Collector) handleMessage(ctx context.Context, logger *slog.Logger, msg syslog.Message, fields []string) []string {
+	defer msg.Release()
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.LogAttrs(
+				ctx, slog.LevelError, "recovered from panic while processing log line",
+				slog.Any("panic", r),
+				slog.String("line", msg.Line),
+				slog.String("stack", string(debug.Stack())),
+			)
+
+			c.metricWorkerPanics.Inc()
+		}
+	}()
+
+	fields, err := c.processLine(msg.Line, fields)
+
+	switch {
+	case err == nil, errors.Is(err, ErrRateLimited):
+	case errors.Is(err, ErrTooManyFields):
+		logger.LogAttrs(
+			ctx, slog.LevelDebug, "skipping line with too many fields",
+			slog.Int("max_fields", c.maxFields),
+			slog.String("line", msg.Line),
+		)
+	default:
+		logger.LogAttrs(
+			ctx, slog.LevelDebug, "error parsing metric",
+			slog.Any("err", err),
+			slog.String("line", msg.Line),
+		)
+	}
+
+	return fields
+}
+
+// Feed processes a single log line synchronously in the calling goroutine, split into fields by the delimiter,
+// see [WithDelimiter]. It's the entry point for driving the collector without a syslog server, e.g. when embedding
+// the parsing engine into another service. Feed is safe for concurrent use.
+//
+// Empty lines are skipped and counted in log_empty_lines_total.
+// Lines exceeding the maximum number of fields return [ErrTooManyFields],
+// lines exceeding the maximum number of lines per second return [ErrRateLimited].
+// Parse errors are returned and counted in log_parse_errors_total.
+func (c *Collector) Feed(line string) error {
+	_, err := c.processLine(line, make([]string, 0, 16))
+
+	return err
+}
+
+// processLine splits a single line into fields and calls the lineHandler method to process it.
+// It increments the metricLogParseError if parsing fails.
+// The fields slice is reused to avoid allocations and returned for the next call.
+func (c *Collector) processLine(line string, fields []string) ([]string, error) {
+	now := time.Now()
+	c.lastReceived.Store(now.UnixNano())
+	c.metricLogLastReceived.Set(float64(now.UnixNano()) / 1e9)
+
+	// A valid syslog message may carry no payload after the header, e.g. if log_format is empty.
+	if line == "" {
+		c.metricLogEmptyLines.Inc()
+
+		return fields, nil
+	}
+
+	if c.rateLimiter != nil && !c.rateLimiter.allow(now) {
+		c.metricRateLimited.Inc()
+
+		return fields, ErrRateLimited
+	}
+
+	fields, err := c.splitFields(fields, line)
+
+	switch {
+	case errors.Is(err, ErrTooManyFields):
+		c.metricLogTooManyFields.Inc()
+
+		return fields, err
+	case err != nil:
+		c.metricLogParseError.Inc()
+		c.linesParsed.Add(1)
+		c.linesFailed.Add(1)
+
+		return fields, err
+	}
+
+	err = c.lineHandler(fields)
+
+	c.traceLine(line, fields)
+
+	c.linesParsed.Add(1)
+
+	if err != nil {
+		c.metricLogParseError.Inc()
+		c.linesFailed.Add(1)
+	}
+
+	return fields, err
+}
+
 // lineHandler processes a single line of log data.
 func (c *Collector) lineHandler(line []string) error {
 	errs := make([]error, 0)
 
-	for _, met := range c.metrics {
+	for _, met := range c.metricsFor(line) {
 		err := met.Parse(line)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("metric %s: %w", met.Name(), err))
@@ -85,16 +225,61 @@ func (c *Collector) lineHandler(line []string) error {
 	return nil
 }
 
-func splitLineFields(fields []string, line string) []string {
+// metricsFor returns the metrics to apply to a line. Lines of a tenant get the metrics of that tenant, see [WithTenants].
+// If the preset defines a formatIndex, these are the metrics of the format named by that field. Otherwise, all metrics apply.
+func (c *Collector) metricsFor(line []string) []*metric.Metric {
+	if c.tenantIndex != nil && *c.tenantIndex < uint(len(line)) {
+		if metrics, ok := c.tenants[line[*c.tenantIndex]]; ok {
+			return metrics
+		}
+	}
+
+	if c.formatIndex == nil {
+		return c.metrics
+	}
+
+	if *c.formatIndex < uint(len(line)) {
+		if metrics, ok := c.formats[line[*c.formatIndex]]; ok {
+			return metrics
+		}
+	}
+
+	return c.unformatted
+}
+
+// splitFields splits line into fields, either as JSON object if the preset has the json format or by the delimiter.
+func (c *Collector) splitFields(fields []string, line string) ([]string, error) {
+	if c.jsonLines {
+		return c.splitJSONFields(fields, line)
+	}
+
+	// Count the fields before splitting to avoid allocations for runaway log formats.
+	if c.maxFields > 0 && strings.Count(line, c.delimiter) >= c.maxFields {
+		return fields, ErrTooManyFields
+	}
+
+	return splitLineFields(fields, line, c.delimiter), nil
+}
+
+// splitLineFields splits line by delimiter into fields, reusing the fields slice.
+func splitLineFields(fields []string, line, delimiter string) []string {
 	fields = fields[:0]
 
 	for {
-		index := strings.IndexByte(line, '\t')
+		var index int
+
+		// Single byte delimiters are the common case, IndexByte is considerably faster.
+		if len(delimiter) == 1 {
+			index = strings.IndexByte(line, delimiter[0])
+		} else {
+			index = strings.Index(line, delimiter)
+		}
+
 		if index == -1 {
 			return append(fields, line)
 		}
 
 		fields = append(fields, line[:index])
-		line = line[index+1:]
+		line = line[index+len(delimiter):]
 	}
 }
@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket allowing up to rate lines per second.
+// The bucket holds at most one second worth of tokens, which bounds bursts after idle periods.
+type rateLimiter struct {
+	last   time.Time
+	rate   float64
+	tokens float64
+	mu     sync.Mutex
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		tokens: max(rate, 1),
+		last:   time.Now(),
+	}
+}
+
+// allow reports whether a line may be processed now and consumes a token if so.
+func (r *rateLimiter) allow(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tokens = min(r.tokens+now.Sub(r.last).Seconds()*r.rate, max(r.rate, 1))
+	r.last = now
+
+	if r.tokens < 1 {
+		return false
+	}
+
+	r.tokens--
+
+	return true
+}
@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/jkroepke/access-log-exporter/internal/config"
+	"github.com/jkroepke/access-log-exporter/internal/metric"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithPrevious carries the series over from the collector of the previous configuration, e.g. on a reload.
+// Metrics with an unchanged configuration keep their series, the built-in counters keep counting.
+// Metrics which were removed or changed start from scratch. A nil collector is ignored.
+func WithPrevious(previous *Collector) Option {
+	return func(c *Collector) {
+		c.previous = previous
+	}
+}
+
+// inheritCounters takes over the built-in counters of the previous collector.
+// Per-metric series of metrics missing in the new configuration are removed, including those of removed tenants.
+func (c *Collector) inheritCounters(previous *Collector) {
+	c.metricLogParseError = previous.metricLogParseError
+	c.metricLogTooManyFields = previous.metricLogTooManyFields
+	c.metricLogEmptyLines = previous.metricLogEmptyLines
+	c.metricObservations = previous.metricObservations
+	c.metricSeriesQuarantined = previous.metricSeriesQuarantined
+	c.metricValueRegexpMismatches = previous.metricValueRegexpMismatches
+	c.metricWorkerPanics = previous.metricWorkerPanics
+	c.metricWorkerProcessed = previous.metricWorkerProcessed
+	c.metricRateLimited = previous.metricRateLimited
+	c.metricSyslogDrained = previous.metricSyslogDrained
+	c.metricSyslogDropped = previous.metricSyslogDropped
+
+	for _, name := range previous.metricNames {
+		if slices.Contains(c.metricNames, name) {
+			continue
+		}
+
+		c.metricObservations.DeleteLabelValues(name)
+		c.metricSeriesQuarantined.DeleteLabelValues(name)
+		c.metricValueRegexpMismatches.DeleteLabelValues(name)
+	}
+}
+
+// metricNames returns the names the per-metric counters are labeled with. These are the names of the metrics
+// of the preset and the names of the metrics of all tenants, prefixed by their namespace.
+func metricNames(configs []config.Metric, tenants []Tenant) []string {
+	names := make([]string, 0, len(configs))
+
+	for _, metricConfig := range configs {
+		names = append(names, metricConfig.Name)
+	}
+
+	for _, tenant := range tenants {
+		for _, metricConfig := range tenant.Preset.Metrics {
+			names = append(names, prometheus.BuildFQName(tenant.Namespace, "", metricConfig.Name))
+		}
+	}
+
+	return names
+}
+
+// previousMetric returns the metric of the previous collector with the same configuration as metricConfig.
+// A changed bucket set referenced by the metric counts as a changed configuration.
+func (c *Collector) previousMetric(metricConfig config.Metric) (*metric.Metric, bool) {
+	if c.previous == nil {
+		return nil, false
+	}
+
+	for i, previousConfig := range c.previous.configs {
+		if previousConfig.Name == metricConfig.Name && sameMetricConfig(previousConfig, metricConfig) &&
+			slices.Equal(c.previous.bucketSets[metricConfig.BucketSet], c.bucketSets[metricConfig.BucketSet]) {
+			return c.previous.metrics[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// sameMetricConfig reports whether both metric configurations are equal.
+// They are compared by their JSON representation, since compiled regular expressions can't be compared directly.
+func sameMetricConfig(a, b config.Metric) bool {
+	aJSON, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+
+	bJSON, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+
+	return string(aJSON) == string(bJSON)
+}
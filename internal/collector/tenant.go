@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/jkroepke/access-log-exporter/internal/config"
+	"github.com/jkroepke/access-log-exporter/internal/metric"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Tenant applies the metrics of Preset, prefixed by Namespace, to lines whose tenant field equals Value.
+type Tenant struct {
+	Preset    config.Preset
+	Value     string
+	Namespace string
+}
+
+// WithTenants routes lines to the metrics of a tenant by the value of the field at lineIndex.
+// Lines of unknown tenants are handled by the preset passed to [New].
+// The metrics of tenants always start from scratch, even if [WithPrevious] is set.
+func WithTenants(lineIndex uint, tenants []Tenant) Option {
+	return func(c *Collector) {
+		if len(tenants) == 0 {
+			return
+		}
+
+		c.tenantIndex = &lineIndex
+		c.tenantConfigs = tenants
+	}
+}
+
+// newTenantMetrics creates the metrics of all tenants, see [WithTenants].
+func (c *Collector) newTenantMetrics() error {
+	c.tenants = make(map[string][]*metric.Metric, len(c.tenantConfigs))
+
+	for _, tenant := range c.tenantConfigs {
+		if tenant.Preset.Format != "" || tenant.Preset.FormatIndex != nil {
+			return fmt.Errorf("tenant '%s': format and formatIndex are not supported in tenant presets", tenant.Value)
+		}
+
+		metrics := make([]*metric.Metric, len(tenant.Preset.Metrics))
+
+		for i, metricConfig := range tenant.Preset.Metrics {
+			name := prometheus.BuildFQName(tenant.Namespace, "", metricConfig.Name)
+
+			met, err := metric.New(metricConfig,
+				metric.WithNamespace(tenant.Namespace),
+				metric.WithBucketSets(c.bucketSets),
+				metric.WithObservationCounter(c.metricObservations.WithLabelValues(name)),
+				metric.WithQuarantineCounter(c.metricSeriesQuarantined.WithLabelValues(name)),
+				metric.WithValueRegexpMismatchCounter(c.metricValueRegexpMismatches.WithLabelValues(name)),
+			)
+			if err != nil {
+				return fmt.Errorf("could not create metric '%s' of tenant '%s': %w", metricConfig.Name, tenant.Value, err)
+			}
+
+			metrics[i] = met
+		}
+
+		c.tenants[tenant.Value] = metrics
+		c.tenantMetrics = append(c.tenantMetrics, metrics...)
+	}
+
+	// Drop the reference, the configuration is not needed anymore.
+	c.tenantConfigs = nil
+
+	return nil
+}
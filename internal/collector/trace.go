@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jkroepke/access-log-exporter/internal/metric"
+)
+
+// ErrTraceInProgress is returned by [Collector.Trace] if another trace is already capturing lines.
+var ErrTraceInProgress = errors.New("another trace is already in progress")
+
+// TraceLine is the parse result of a single log line captured by [Collector.Trace].
+type TraceLine struct {
+	Line    string               `json:"line"`
+	Metrics []metric.TraceResult `json:"metrics"`
+}
+
+// tracer captures the parse results of incoming lines until count lines are recorded.
+type tracer struct {
+	done  chan struct{}
+	lines []TraceLine
+	count int
+	mu    sync.Mutex
+}
+
+// Trace captures the parse results of the next count incoming lines.
+// It blocks until count lines have been captured or the context is done.
+// In the latter case, the lines captured so far are returned along with the context error.
+func (c *Collector) Trace(ctx context.Context, count int) ([]TraceLine, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("trace count must be greater than zero, got %d", count)
+	}
+
+	t := &tracer{
+		done:  make(chan struct{}),
+		lines: make([]TraceLine, 0, count),
+		count: count,
+	}
+
+	if !c.tracer.CompareAndSwap(nil, t) {
+		return nil, ErrTraceInProgress
+	}
+
+	var err error
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		c.tracer.CompareAndSwap(t, nil)
+
+		err = ctx.Err()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.lines, err
+}
+
+// traceLine records the parse results of a line if a trace is active.
+func (c *Collector) traceLine(line string, fields []string) {
+	t := c.tracer.Load()
+	if t == nil {
+		return
+	}
+
+	results := c.traceMetrics(fields)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.lines) >= t.count {
+		return
+	}
+
+	t.lines = append(t.lines, TraceLine{Line: line, Metrics: results})
+
+	if len(t.lines) == t.count {
+		c.tracer.CompareAndSwap(t, nil)
+		close(t.done)
+	}
+}
+
+// Explain returns the parse results of a single line without updating the metrics, e.g. to check sample lines.
+func (c *Collector) Explain(line string) (TraceLine, error) {
+	fields, err := c.splitFields(make([]string, 0, 16), line)
+	if err != nil {
+		return TraceLine{}, err
+	}
+
+	return TraceLine{Line: line, Metrics: c.traceMetrics(fields)}, nil
+}
+
+// traceMetrics returns the trace results of all metrics which apply to the line.
+func (c *Collector) traceMetrics(fields []string) []metric.TraceResult {
+	metrics := c.metricsFor(fields)
+
+	results := make([]metric.TraceResult, len(metrics))
+	for i, met := range metrics {
+		results[i] = met.Trace(fields)
+	}
+
+	return results
+}
@@ -2,14 +2,53 @@ package collector
 
 import (
 	"sync"
+	"sync/atomic"
 
+	"github.com/jkroepke/access-log-exporter/internal/config"
+	"github.com/jkroepke/access-log-exporter/internal/config/types"
 	"github.com/jkroepke/access-log-exporter/internal/metric"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Collector struct {
-	metricLogParseError   prometheus.Counter
-	metricLogLastReceived prometheus.Gauge
-	wg                    *sync.WaitGroup
-	metrics               []*metric.Metric
+	metricLogParseError         prometheus.Counter
+	metricLogLastReceived       prometheus.Gauge
+	metricLogTooManyFields      prometheus.Counter
+	metricLogEmptyLines         prometheus.Counter
+	metricObservations          *prometheus.CounterVec
+	metricSeriesQuarantined     *prometheus.CounterVec
+	metricValueRegexpMismatches *prometheus.CounterVec
+	metricWorkerPanics          prometheus.Counter
+	metricWorkerProcessed       *prometheus.CounterVec
+	metricRateLimited           prometheus.Counter
+	metricSyslogDrained         prometheus.Counter
+	metricSyslogDropped         prometheus.Counter
+	metricParseSuccessRatio     *prometheus.Desc
+	rateLimiter                 *rateLimiter // Set if a maximum number of lines per second is configured
+	wg                          *sync.WaitGroup
+	tracer                      atomic.Pointer[tracer]
+	lastReceived                atomic.Int64
+	linesParsed                 atomic.Uint64 // Lines passed to the metrics, see [Collector.ParseStats]
+	linesFailed                 atomic.Uint64
+	metrics                     []*metric.Metric
+	configs                     []config.Metric
+	metricNames                 []string                      // Labels of the per-metric counters, see [metricNames]
+	bucketSets                  map[string]types.Float64Slice // Passed to each metric, see [WithBucketSets]
+	previous                    *Collector                    // Set during New only, see [WithPrevious]
+	formats                     map[string][]*metric.Metric   // Metrics per log format, if the preset defines a formatIndex
+	unformatted                 []*metric.Metric              // Metrics without a format, applied to lines of unknown formats
+	tenants                     map[string][]*metric.Metric   // Metrics per tenant, see [WithTenants]
+	tenantMetrics               []*metric.Metric              // Metrics of all tenants, in order of the tenants
+	tenantConfigs               []Tenant                      // Set during New only, see [WithTenants]
+	formatIndex                 *uint
+	tenantIndex                 *uint
+	delimiter                   string
+	jsonFields                  []string // Field names of a json preset, in order of their index, see [resolveJSONFields]
+	jsonLines                   bool     // Whether lines are JSON objects, i.e. the preset has the json format
+	workerMetrics               bool     // Whether the log_worker_ metrics are collected, see [WithWorkerMetrics]
+	perMetricMetrics            bool     // Whether the per-metric self-metrics are collected, see [WithPerMetricMetrics]
+	maxFields                   int
 }
+
+// Option configures optional behavior of a [Collector].
+type Option func(*Collector)
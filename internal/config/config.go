@@ -1,13 +1,16 @@
 package config
 
 import (
+	"bytes"
 	"encoding"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -18,19 +21,28 @@ import (
 var ErrVersion = errors.New("flag: version requested")
 
 // New loads the configuration from configuration files, command line arguments and environment variables in that order.
+// Multiple configuration files are merged in the given order, see [Config.ReadFromConfigFile].
 //
 //goland:noinspection GoMixedReceiverTypes
 func New(args []string, writer io.Writer) (Config, error) {
+	start := time.Now()
 	config := Defaults
 
+	var size int64
+
 	if !lookupVersionOrHelpArgument(args) {
-		configFilePath := lookupConfigArgument(args)
-		if err := config.ReadFromConfigFile(configFilePath); err != nil {
-			if errors.Is(err, io.EOF) {
-				err = ErrEmptyConfigFile
+		for _, configFilePath := range lookupConfigArguments(args) {
+			if err := config.ReadFromConfigFile(configFilePath); err != nil {
+				if errors.Is(err, io.EOF) {
+					err = ErrEmptyConfigFile
+				}
+
+				return Config{}, err
 			}
 
-			return Config{}, err
+			if info, err := os.Stat(configFilePath); err == nil {
+				size += info.Size()
+			}
 		}
 	}
 
@@ -38,33 +50,169 @@ func New(args []string, writer io.Writer) (Config, error) {
 		return Config{}, err
 	}
 
+	config.applyMetricDefaults()
+
+	if err := config.resolveBucketsFrom(); err != nil {
+		return Config{}, err
+	}
+
+	loadDuration.Set(time.Since(start).Seconds())
+	configBytes.Set(float64(size))
+
 	return config, nil
 }
 
-// ReadFromConfigFile reads the configuration from a configuration file and command line arguments.
+// applyMetricDefaults applies the global metric defaults to all preset metrics which do not define their own values.
+//
+//goland:noinspection GoMixedReceiverTypes
+func (c *Config) applyMetricDefaults() {
+	if len(c.Metrics.Buckets) == 0 {
+		return
+	}
+
+	for _, preset := range c.Presets {
+		for i, metric := range preset.Metrics {
+			if metric.Type == "histogram" && !metric.NativeHistogram && len(metric.Buckets) == 0 && metric.BucketSet == "" && metric.BucketsFrom == "" {
+				preset.Metrics[i].Buckets = c.Metrics.Buckets
+			}
+		}
+	}
+}
+
+// resolveBucketsFrom copies the buckets of the referenced metric to all preset metrics with bucketsFrom,
+// which do not define their own buckets or bucket set. References may be chained, but must not form a cycle.
+//
+//goland:noinspection GoMixedReceiverTypes
+func (c *Config) resolveBucketsFrom() error {
+	for name, preset := range c.Presets {
+		resolved := make(map[string]bool, len(preset.Metrics))
+
+		for i := range preset.Metrics {
+			if err := resolveMetricBucketsFrom(name, preset.Metrics, i, resolved); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveMetricBucketsFrom resolves the buckets of metrics[i] and, first, of the metrics it references.
+// resolved holds false for metrics being resolved, which detects cycles, and true for resolved metrics.
+func resolveMetricBucketsFrom(preset string, metrics []Metric, i int, resolved map[string]bool) error {
+	metric := &metrics[i]
+
+	if metric.BucketsFrom == "" {
+		return nil
+	}
+
+	done, visited := resolved[metric.Name]
+	if done {
+		return nil
+	}
+
+	if visited {
+		return &BucketsFromCycleError{Preset: preset, Metric: metric.Name}
+	}
+
+	resolved[metric.Name] = false
+
+	source := slices.IndexFunc(metrics, func(m Metric) bool { return m.Name == metric.BucketsFrom })
+	if source == -1 {
+		return &BucketsFromNotFoundError{Preset: preset, Metric: metric.Name, BucketsFrom: metric.BucketsFrom}
+	}
+
+	if err := resolveMetricBucketsFrom(preset, metrics, source, resolved); err != nil {
+		return err
+	}
+
+	if len(metric.Buckets) == 0 && metric.BucketSet == "" {
+		metric.Buckets = slices.Clone(metrics[source].Buckets)
+		metric.BucketSet = metrics[source].BucketSet
+	}
+
+	resolved[metric.Name] = true
+
+	return nil
+}
+
+// ReadFromConfigFile reads the configuration from a configuration file on top of the current configuration.
+// Environment variables in the file are expanded before decoding, see [expandEnv].
+// Files with the extension .json are decoded as JSON, all others as YAML.
+// Scalars and slices of the file replace the current values, while nested objects are merged field by field.
+// Maps like presets are merged by key, where an entry of the file replaces the current entry with the same key as a whole.
 //
 //goland:noinspection GoMixedReceiverTypes
 func (c *Config) ReadFromConfigFile(configFilePath string) error {
-	configFile, err := os.Open(configFilePath)
+	configFile, err := os.ReadFile(configFilePath)
 	if err != nil {
 		return fmt.Errorf("error opening config file %s: %w", configFilePath, err)
 	}
 
-	defer func() {
-		_ = configFile.Close()
-	}()
+	configFile = []byte(expandEnv(string(configFile)))
 
-	decoder := yaml.NewDecoder(configFile)
-	decoder.KnownFields(true)
+	if strings.EqualFold(filepath.Ext(configFilePath), ".json") {
+		err = c.decodeJSON(configFile)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(configFile))
+		decoder.KnownFields(true)
 
-	// Load the config file
-	if err = decoder.Decode(c); err != nil {
+		// Load the config file
+		err = decoder.Decode(c)
+	}
+
+	if err != nil {
 		return fmt.Errorf("error decoding config file %s: %w", configFilePath, err)
 	}
 
 	return nil
 }
 
+// expandEnv replaces ${VAR} and ${VAR:-default} by the value of the environment variable VAR.
+// The default applies if VAR is unset or empty. $$ yields a literal $. Any other $ is kept as is,
+// since configurations contain them in regular expressions and replacements like "$1".
+func expandEnv(config string) string {
+	if !strings.Contains(config, "$") {
+		return config
+	}
+
+	// Escape all $ not starting ${ or $$, so os.Expand keeps them.
+	var escaped strings.Builder
+
+	escaped.Grow(len(config))
+
+	for i := 0; i < len(config); i++ {
+		escaped.WriteByte(config[i])
+
+		if config[i] != '$' {
+			continue
+		}
+
+		if i+1 < len(config) && (config[i+1] == '{' || config[i+1] == '$') {
+			escaped.WriteByte(config[i+1])
+			i++
+
+			continue
+		}
+
+		escaped.WriteByte('$')
+	}
+
+	return os.Expand(escaped.String(), func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+
+		name, defaultValue, hasDefault := strings.Cut(name, ":-")
+
+		if value := os.Getenv(name); value != "" || !hasDefault {
+			return value
+		}
+
+		return defaultValue
+	})
+}
+
 // ReadFromFlagAndEnvironment reads the configuration from command line arguments and environment variables.
 //
 //goland:noinspection GoMixedReceiverTypes
@@ -103,20 +251,33 @@ func (c *Config) ReadFromFlagAndEnvironment(args []string, writer io.Writer) err
 	return nil
 }
 
-func lookupConfigArgument(args []string) string {
+// Files returns the paths of the configuration files loaded by [New] for the command line arguments.
+func Files(args []string) []string {
+	return lookupConfigArguments(args)
+}
+
+// lookupConfigArguments returns the paths of all --config arguments in the given order.
+// The flag can be repeated and each value may contain comma-separated paths.
+// Without a --config argument, it returns the paths of the environment variable or the default path.
+func lookupConfigArguments(args []string) []string {
+	var configPaths []string
+
 	for i, arg := range args {
-		if !strings.HasPrefix(arg, "--config") {
-			continue
-		}
+		configPath, ok := strings.CutPrefix(arg, "--config=")
+		if !ok {
+			// check if the argument is --config without value and look for the next argument
+			if arg != "--config" || len(args) <= i+1 {
+				continue
+			}
 
-		if configPath, ok := strings.CutPrefix(arg, "--config="); ok {
-			return configPath
+			configPath = args[i+1]
 		}
 
-		// check if the argument is --config without value and look for the next argument
-		if len(args) > i+1 {
-			return args[i+1]
-		}
+		configPaths = append(configPaths, strings.Split(configPath, ",")...)
+	}
+
+	if len(configPaths) != 0 {
+		return configPaths
 	}
 
 	defaultConfigFilePath := "config.yaml"
@@ -126,7 +287,7 @@ func lookupConfigArgument(args []string) string {
 		defaultConfigFilePath = koDataPath + "/config.yaml"
 	}
 
-	return lookupEnvOrDefault("config", defaultConfigFilePath)
+	return strings.Split(lookupEnvOrDefault("config", defaultConfigFilePath), ",")
 }
 
 func lookupVersionOrHelpArgument(args []string) bool {
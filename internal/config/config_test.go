@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"flag"
 	"io"
+	"math"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/jkroepke/access-log-exporter/internal/config"
+	"github.com/jkroepke/access-log-exporter/internal/config/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.yaml.in/yaml/v4"
 )
 
 func TestConfig(t *testing.T) {
@@ -36,7 +41,7 @@ web:
 `,
 			func() config.Config {
 				conf := config.Defaults
-				conf.Web.ListenAddress = ":9000"
+				conf.Web.ListenAddress = types.StringSlice{":9000"}
 
 				return conf
 			}(),
@@ -97,3 +102,546 @@ func TestConfigVersionFlag(t *testing.T) {
 
 	require.ErrorIs(t, err, config.ErrVersion)
 }
+
+func TestConfigMetricsBucketsFlag(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	file, err := os.CreateTemp(t.TempDir(), "access-log-exporter-*")
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, file.Close())
+	})
+
+	// language=yaml
+	_, err = file.WriteString(`
+presets:
+  test:
+    metrics:
+      - name: "http_request_duration_seconds"
+        type: "histogram"
+        valueIndex: 0
+      - name: "http_request_size_bytes"
+        type: "histogram"
+        valueIndex: 1
+        buckets: [10, 100]
+`)
+	require.NoError(t, err)
+
+	conf, err := config.New([]string{"access-log-exporter", "--config", file.Name(), "--metrics.buckets=0.1,0.5,1,5"}, &buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, types.Float64Slice{0.1, 0.5, 1, 5}, conf.Metrics.Buckets)
+	assert.Equal(t, types.Float64Slice{0.1, 0.5, 1, 5}, conf.Presets["test"].Metrics[0].Buckets)
+	assert.Equal(t, types.Float64Slice{10, 100}, conf.Presets["test"].Metrics[1].Buckets)
+
+	_, err = config.New([]string{"access-log-exporter", "--config", file.Name(), "--metrics.buckets=0.1,a"}, &buf)
+	require.ErrorContains(t, err, `failed to parse float64 from string 'a'`)
+}
+
+func TestConfigBucketSets(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	file, err := os.CreateTemp(t.TempDir(), "access-log-exporter-*")
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, file.Close())
+	})
+
+	// language=yaml
+	_, err = file.WriteString(`
+bucketSets:
+  latency: [0.1, 0.5, 1]
+presets:
+  test:
+    metrics:
+      - name: "http_request_duration_seconds"
+        type: "histogram"
+        valueIndex: 0
+        bucketSet: "latency"
+      - name: "http_upstream_connect_duration_seconds"
+        type: "histogram"
+        valueIndex: 1
+        bucketSet: "latency"
+        buckets: [10, 100]
+`)
+	require.NoError(t, err)
+
+	conf, err := config.New([]string{"access-log-exporter", "--config", file.Name(), "--metrics.buckets=5,10"}, &buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]types.Float64Slice{"latency": {0.1, 0.5, 1}}, conf.BucketSets)
+	assert.Equal(t, "latency", conf.Presets["test"].Metrics[0].BucketSet)
+	assert.Empty(t, conf.Presets["test"].Metrics[0].Buckets, "global buckets must not override a bucket set")
+	assert.Equal(t, types.Float64Slice{10, 100}, conf.Presets["test"].Metrics[1].Buckets)
+
+	roundTrip, err := yaml.Marshal(conf.BucketSets)
+	require.NoError(t, err)
+
+	var bucketSets map[string]types.Float64Slice
+
+	require.NoError(t, yaml.Unmarshal(roundTrip, &bucketSets))
+	assert.Equal(t, conf.BucketSets, bucketSets)
+}
+
+func TestConfigNginxScrapeTargets(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	file, err := os.CreateTemp(t.TempDir(), "access-log-exporter-*")
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, file.Close())
+	})
+
+	// language=yaml
+	_, err = file.WriteString(`
+nginx:
+  scrapeUris:
+    - http://10.0.0.1/stub_status
+    - unix:///var/run/nginx-status.sock
+`)
+	require.NoError(t, err)
+
+	conf, err := config.New([]string{
+		"access-log-exporter", "--config", file.Name(), "--nginx.scrape-url=http://127.0.0.1/stub_status",
+	}, &buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"http://127.0.0.1/stub_status",
+		"http://10.0.0.1/stub_status",
+		"unix:///var/run/nginx-status.sock",
+	}, conf.Nginx.ScrapeTargets())
+}
+
+func TestConfigMultipleFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	baseFile := filepath.Join(dir, "base.yaml")
+	// language=yaml
+	require.NoError(t, os.WriteFile(baseFile, []byte(`
+preset: base
+bufferSize: 500
+syslog:
+  listenAddress: "tcp://127.0.0.1:8514"
+  maxMessageSize: 8192
+web:
+  listenAddress: [":9000", ":9001"]
+presets:
+  base:
+    metrics:
+      - name: "http_requests_total"
+        type: "counter"
+  team:
+    metrics:
+      - name: "http_requests_total"
+        type: "counter"
+`), 0o600))
+
+	teamFile := filepath.Join(dir, "team.yaml")
+	// language=yaml
+	require.NoError(t, os.WriteFile(teamFile, []byte(`
+preset: team
+syslog:
+  listenAddress: "udp://127.0.0.1:8514"
+web:
+  listenAddress: [":9002"]
+presets:
+  team:
+    metrics:
+      - name: "http_response_size_bytes"
+        type: "counter"
+        valueIndex: 1
+`), 0o600))
+
+	for _, args := range [][]string{
+		{"access-log-exporter", "--config", baseFile, "--config=" + teamFile},
+		{"access-log-exporter", "--config=" + baseFile + "," + teamFile},
+	} {
+		conf, err := config.New(args, io.Discard)
+		require.NoError(t, err)
+
+		// scalars and slices of later files take precedence
+		assert.Equal(t, "team", conf.Preset)
+		assert.Equal(t, uint(500), conf.BufferSize)
+		assert.Equal(t, "udp://127.0.0.1:8514", conf.Syslog.ListenAddress)
+		assert.Equal(t, 8192, conf.Syslog.MaxMessageSize)
+		assert.Equal(t, types.StringSlice{":9002"}, conf.Web.ListenAddress)
+
+		// presets are merged by key, later files replace a preset as a whole
+		require.Len(t, conf.Presets, 2)
+		assert.Equal(t, "http_requests_total", conf.Presets["base"].Metrics[0].Name)
+		require.Len(t, conf.Presets["team"].Metrics, 1)
+		assert.Equal(t, "http_response_size_bytes", conf.Presets["team"].Metrics[0].Name)
+	}
+}
+
+func TestConfigEnvironmentInterpolation(t *testing.T) {
+	t.Setenv("ACCESS_LOG_EXPORTER_TEST_LISTEN", ":9000")
+	t.Setenv("ACCESS_LOG_EXPORTER_TEST_EMPTY", "")
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	// language=yaml
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+web:
+  listenAddress: ["${ACCESS_LOG_EXPORTER_TEST_LISTEN}"]
+syslog:
+  listenAddress: "${ACCESS_LOG_EXPORTER_TEST_UNSET:-udp://127.0.0.1:8514}"
+nginx:
+  scrapeUri: "${ACCESS_LOG_EXPORTER_TEST_EMPTY:-http://127.0.0.1/stub_status}"
+push:
+  job: "price_$$5_${ACCESS_LOG_EXPORTER_TEST_UNSET}"
+presets:
+  test:
+    metrics:
+      - name: "http_requests_total"
+        type: "counter"
+        labels:
+          - name: "host"
+            lineIndex: 0
+            replacements:
+              - regexp: "^(www)\\.example\\.com$"
+                replacement: "$1"
+`), 0o600))
+
+	conf, err := config.New([]string{"access-log-exporter", "--config", configFile}, io.Discard)
+	require.NoError(t, err)
+
+	assert.Equal(t, types.StringSlice{":9000"}, conf.Web.ListenAddress)
+	assert.Equal(t, "udp://127.0.0.1:8514", conf.Syslog.ListenAddress)
+	assert.Equal(t, "http://127.0.0.1/stub_status", conf.Nginx.ScrapeURL.String())
+	assert.Equal(t, "price_$5_", conf.Push.Job)
+
+	// $ without braces is kept, e.g. in regular expressions and replacements.
+	replacement := conf.Presets["test"].Metrics[0].Labels[0].Replacements[0]
+	assert.Equal(t, "$1", replacement.Replacement)
+	assert.Equal(t, `^(www)\.example\.com$`, replacement.Regexp.String())
+}
+
+func TestConfigJSONFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	yamlFile := filepath.Join(dir, "config.yaml")
+	// language=yaml
+	require.NoError(t, os.WriteFile(yamlFile, []byte(`
+preset: test
+log:
+  level: debug
+web:
+  listenAddress: [":9000"]
+  staleThreshold: 5m
+nginx:
+  scrapeUri: "http://127.0.0.1/stub_status"
+  scrapeTimeout: 2s
+presets:
+  test:
+    metrics:
+      - name: "http_response_size_bytes"
+        type: "histogram"
+        valueIndex: 1
+        buckets: [100, 1000]
+        seriesTTL: 1h
+        labels:
+          - name: "host"
+            lineIndex: 0
+            replacements:
+              - string: "www."
+                replacement: ""
+              - regexp: "^(.+)\\.example\\.com$"
+                replacement: "$1"
+          - name: "size"
+            lineIndex: 1
+            ranges:
+              - value: "small"
+                max: 1024
+              - value: "large"
+                max: .inf
+      - name: "http_request_duration_seconds"
+        type: "histogram"
+        valueIndex: 2
+        buckets:
+          exponential:
+            start: 0.005
+            factor: 2
+            count: 4
+      - name: "http_upstream_duration_seconds"
+        type: "histogram"
+        valueIndex: 3
+        buckets: "0.1,1,10"
+`), 0o600))
+
+	jsonFile := filepath.Join(dir, "config.json")
+	// language=json
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{
+  "preset": "test",
+  "log": {"level": "debug"},
+  "web": {"listenAddress": [":9000"], "staleThreshold": "5m"},
+  "nginx": {"scrapeUri": "http://127.0.0.1/stub_status", "scrapeTimeout": "2s"},
+  "presets": {
+    "test": {
+      "metrics": [
+        {
+          "name": "http_response_size_bytes",
+          "type": "histogram",
+          "valueIndex": 1,
+          "buckets": [100, 1000],
+          "seriesTTL": "1h",
+          "labels": [
+            {
+              "name": "host",
+              "lineIndex": 0,
+              "replacements": [
+                {"string": "www.", "replacement": ""},
+                {"regexp": "^(.+)\\.example\\.com$", "replacement": "$1"}
+              ]
+            },
+            {
+              "name": "size",
+              "lineIndex": 1,
+              "ranges": [{"value": "small", "max": 1024}, {"value": "large", "max": "+Inf"}]
+            }
+          ]
+        },
+        {
+          "name": "http_request_duration_seconds",
+          "type": "histogram",
+          "valueIndex": 2,
+          "buckets": {"exponential": {"start": 0.005, "factor": 2, "count": 4}}
+        },
+        {
+          "name": "http_upstream_duration_seconds",
+          "type": "histogram",
+          "valueIndex": 3,
+          "buckets": "0.1,1,10"
+        }
+      ]
+    }
+  }
+}`), 0o600))
+
+	yamlConf, err := config.New([]string{"access-log-exporter", "--config", yamlFile}, io.Discard)
+	require.NoError(t, err)
+
+	jsonConf, err := config.New([]string{"access-log-exporter", "--config", jsonFile}, io.Discard)
+	require.NoError(t, err)
+
+	assert.Equal(t, yamlConf, jsonConf)
+
+	metrics := jsonConf.Presets["test"].Metrics
+	assert.Equal(t, types.Float64Slice{0.005, 0.01, 0.02, 0.04}, metrics[1].Buckets)
+	assert.Equal(t, types.Float64Slice{0.1, 1, 10}, metrics[2].Buckets)
+
+	replacement := jsonConf.Presets["test"].Metrics[0].Labels[0].Replacements[0]
+	require.NotNil(t, replacement.StringReplacer)
+	assert.Equal(t, "example.com", replacement.StringReplacer.Replace("www.example.com"))
+
+	t.Run("unknown field", func(t *testing.T) {
+		t.Parallel()
+
+		invalidFile := filepath.Join(t.TempDir(), "config.json")
+		require.NoError(t, os.WriteFile(invalidFile, []byte(`{"web": {"listenAdress": [":9000"]}}`), 0o600))
+
+		_, err := config.New([]string{"access-log-exporter", "--config", invalidFile}, io.Discard)
+		require.ErrorContains(t, err, `unknown field "listenAdress"`)
+	})
+}
+
+func TestConfigBucketsFrom(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name string
+		// language=yaml
+		metrics string
+		err     error
+	}{
+		{
+			name: "chained",
+			metrics: `
+      - name: "http_upstream_header_duration_seconds"
+        type: "histogram"
+        bucketsFrom: "http_upstream_connect_duration_seconds"
+      - name: "http_upstream_connect_duration_seconds"
+        type: "histogram"
+        bucketsFrom: "http_request_duration_seconds"
+      - name: "http_request_duration_seconds"
+        type: "histogram"
+        buckets: [0.1, 0.5, 1]
+`,
+		},
+		{
+			name: "missing reference",
+			metrics: `
+      - name: "http_upstream_header_duration_seconds"
+        type: "histogram"
+        bucketsFrom: "http_request_duration_seconds"
+`,
+			err: &config.BucketsFromNotFoundError{},
+		},
+		{
+			name: "cycle",
+			metrics: `
+      - name: "http_upstream_header_duration_seconds"
+        type: "histogram"
+        bucketsFrom: "http_upstream_connect_duration_seconds"
+      - name: "http_upstream_connect_duration_seconds"
+        type: "histogram"
+        bucketsFrom: "http_upstream_header_duration_seconds"
+`,
+			err: &config.BucketsFromCycleError{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+
+			file, err := os.CreateTemp(t.TempDir(), "access-log-exporter-*")
+			require.NoError(t, err)
+
+			t.Cleanup(func() {
+				require.NoError(t, file.Close())
+			})
+
+			_, err = file.WriteString("presets:\n  test:\n    metrics:\n" + tc.metrics)
+			require.NoError(t, err)
+
+			conf, err := config.New([]string{"access-log-exporter", "--config", file.Name(), "--metrics.buckets=5,10"}, &buf)
+			if tc.err != nil {
+				require.ErrorIs(t, err, config.ErrValidation)
+				require.IsType(t, tc.err, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			for _, metric := range conf.Presets["test"].Metrics {
+				assert.Equal(t, types.Float64Slice{0.1, 0.5, 1}, metric.Buckets, metric.Name)
+			}
+		})
+	}
+}
+
+func TestConfigLabelRanges(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	file, err := os.CreateTemp(t.TempDir(), "access-log-exporter-*")
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, file.Close())
+	})
+
+	// language=yaml
+	_, err = file.WriteString(`
+presets:
+  test:
+    metrics:
+      - name: "http_responses_total"
+        type: "counter"
+        labels:
+          - name: "size"
+            lineIndex: 0
+            ranges:
+              - { max: 1024, value: "small" }
+              - { max: .inf, value: "large" }
+`)
+	require.NoError(t, err)
+
+	conf, err := config.New([]string{"access-log-exporter", "--config", file.Name(), "--preset", "test"}, &buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, []config.LabelRange{
+		{Max: 1024, Value: "small"},
+		{Max: math.Inf(1), Value: "large"},
+	}, conf.Presets["test"].Metrics[0].Labels[0].Ranges)
+
+	// The catch-all range must not break the JSON encoding of the configuration, e.g. for the debug log.
+	assert.Contains(t, conf.String(), `"ranges":[{"max":1024,"value":"small"},{"max":"+Inf","value":"large"}]`)
+}
+
+func TestConfigInputDelimiterFlag(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	file, err := os.CreateTemp(t.TempDir(), "access-log-exporter-*")
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, file.Close())
+	})
+
+	// language=yaml
+	_, err = file.WriteString(`
+preset: simple
+`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "\t", config.Defaults.Input.Delimiter)
+
+	conf, err := config.New([]string{"access-log-exporter", "--config", file.Name()}, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "\t", conf.Input.Delimiter)
+
+	conf, err = config.New([]string{"access-log-exporter", "--config", file.Name(), "--input.delimiter=|"}, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "|", conf.Input.Delimiter)
+}
+
+func TestConfigLoadMetrics(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	file, err := os.CreateTemp(t.TempDir(), "access-log-exporter-*")
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, file.Close())
+	})
+
+	// language=yaml
+	_, err = file.WriteString(`
+presets:
+  test:
+    metrics:
+      - name: "http_requests_total"
+        type: "counter"
+        labels:
+          - name: "host"
+            lineIndex: 0
+          - name: "method"
+            lineIndex: 1
+      - name: "http_request_duration_seconds"
+        type: "histogram"
+        valueIndex: 2
+        buckets: [0.1, 0.5, 1, 5]
+        labels:
+          - name: "host"
+            lineIndex: 0
+`)
+	require.NoError(t, err)
+
+	_, err = config.New([]string{"access-log-exporter", "--config", file.Name()}, &buf)
+	require.NoError(t, err)
+
+	for _, collector := range config.Collectors() {
+		assert.Positive(t, testutil.ToFloat64(collector))
+	}
+}
@@ -3,26 +3,52 @@ package config
 import (
 	"log/slog"
 	"time"
+
+	"github.com/jkroepke/access-log-exporter/internal/config/types"
 )
 
 //nolint:gochecknoglobals
 var Defaults = Config{
-	ConfigFile:  "config.yaml",
-	BufferSize:  1000,
-	WorkerCount: 0,
-	Preset:      "simple",
-	Debug:       Debug{},
+	ConfigFile:          "config.yaml",
+	BufferSize:          1000,
+	WorkerCount:         0,
+	Preset:              "simple",
+	WatchConfigInterval: time.Second,
+	ConfigTestFormat:    ConfigTestFormatText,
+	Debug:               Debug{},
 	Log: Log{
 		Format: "console",
 		Level:  slog.LevelInfo,
 	},
 	Web: Web{
-		ListenAddress: ":4040",
+		ListenAddress:         types.StringSlice{":4040"},
+		ReadyErrorGracePeriod: time.Minute,
 	},
 	Syslog: Syslog{
-		ListenAddress: "udp://[::]:8514",
+		ListenAddress:  "udp://[::]:8514",
+		MaxMessageSize: 4096,
 	},
 	Nginx: Nginx{
 		ScrapeTimeout: time.Second,
 	},
+	Push: Push{
+		Job:      "access_log_exporter",
+		Interval: 15 * time.Second,
+	},
+	Signal: Signal{
+		Reload: types.StringSlice{"SIGHUP"},
+	},
+	Telemetry: Telemetry{
+		Runtime:   true,
+		Config:    true,
+		Workers:   true,
+		PerMetric: true,
+	},
+	Input: Input{
+		Delimiter:           "\t",
+		IdleWarningInterval: time.Minute,
+	},
+	Metrics: Metrics{
+		Protobuf: ProtobufAuto,
+	},
 }
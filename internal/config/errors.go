@@ -1,5 +1,283 @@
 package config
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
-var ErrRequired = errors.New("required")
+var (
+	ErrRequired = errors.New("required")
+	// ErrValidation is the parent of all errors returned by [Validate].
+	// Use [errors.Is] to check whether an error is a validation error, and [errors.As] to access the details.
+	ErrValidation = errors.New("configuration validation error")
+)
+
+// PresetNotFoundError is returned if the selected preset is not defined in the configuration.
+type PresetNotFoundError struct {
+	Preset string
+}
+
+func (e *PresetNotFoundError) Error() string {
+	return fmt.Sprintf("preset '%s' not found in configuration", e.Preset)
+}
+
+func (e *PresetNotFoundError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// EmptyPresetError is returned if the selected preset defines no metrics, unless empty presets are allowed.
+type EmptyPresetError struct {
+	Preset string
+}
+
+func (e *EmptyPresetError) Error() string {
+	return fmt.Sprintf("preset '%s' defines no metrics, set --allow-empty-preset to allow it", e.Preset)
+}
+
+func (e *EmptyPresetError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// DuplicateMetricError is returned if a preset defines the same metric name more than once.
+type DuplicateMetricError struct {
+	Preset string
+	Metric string
+}
+
+func (e *DuplicateMetricError) Error() string {
+	return fmt.Sprintf("metric '%s' is defined multiple times in preset '%s'", e.Metric, e.Preset)
+}
+
+func (e *DuplicateMetricError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// BucketSetNotFoundError is returned if a metric references a bucket set that is not defined in the configuration.
+type BucketSetNotFoundError struct {
+	Preset    string
+	Metric    string
+	BucketSet string
+}
+
+func (e *BucketSetNotFoundError) Error() string {
+	return fmt.Sprintf("metric '%s' in preset '%s' references the undefined bucket set '%s'", e.Metric, e.Preset, e.BucketSet)
+}
+
+func (e *BucketSetNotFoundError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// BucketsFromNotFoundError is returned if a metric inherits the buckets of a metric that is not defined in its preset.
+type BucketsFromNotFoundError struct {
+	Preset      string
+	Metric      string
+	BucketsFrom string
+}
+
+func (e *BucketsFromNotFoundError) Error() string {
+	return fmt.Sprintf("metric '%s' in preset '%s' inherits the buckets of the undefined metric '%s'", e.Metric, e.Preset, e.BucketsFrom)
+}
+
+func (e *BucketsFromNotFoundError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// BucketsFromCycleError is returned if the bucketsFrom references of a preset form a cycle.
+type BucketsFromCycleError struct {
+	Preset string
+	Metric string
+}
+
+func (e *BucketsFromCycleError) Error() string {
+	return fmt.Sprintf("metric '%s' in preset '%s' inherits its buckets in a cycle", e.Metric, e.Preset)
+}
+
+func (e *BucketsFromCycleError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// IncompleteTLSError is returned if only one of the TLS certificate and key files is set.
+type IncompleteTLSError struct {
+	CertFile string
+	KeyFile  string
+}
+
+func (e *IncompleteTLSError) Error() string {
+	return "both TLS certificate and key files must be set to enable TLS"
+}
+
+func (e *IncompleteTLSError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// SyslogTLSWithoutTCPError is returned if TLS is configured for a syslog listener other than tcp://.
+type SyslogTLSWithoutTCPError struct {
+	ListenAddress string
+}
+
+func (e *SyslogTLSWithoutTCPError) Error() string {
+	return fmt.Sprintf("syslog TLS requires a tcp:// listen address, got '%s'", e.ListenAddress)
+}
+
+func (e *SyslogTLSWithoutTCPError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// FormatWithoutFormatIndexError is returned if a metric selects a log format, but its preset doesn't define a formatIndex.
+type FormatWithoutFormatIndexError struct {
+	Preset string
+	Metric string
+}
+
+func (e *FormatWithoutFormatIndexError) Error() string {
+	return fmt.Sprintf("metric '%s' in preset '%s' defines a format, but the preset does not define a formatIndex", e.Metric, e.Preset)
+}
+
+func (e *FormatWithoutFormatIndexError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// UnsupportedPresetFormatError is returned if a preset defines an unknown log line format.
+type UnsupportedPresetFormatError struct {
+	Preset string
+	Format string
+}
+
+func (e *UnsupportedPresetFormatError) Error() string {
+	return fmt.Sprintf("preset '%s' defines the unsupported format '%s', must be empty or json", e.Preset, e.Format)
+}
+
+func (e *UnsupportedPresetFormatError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// UnsupportedSignalError is returned if a signal can not be used to trigger a reload.
+type UnsupportedSignalError struct {
+	Signal string
+}
+
+func (e *UnsupportedSignalError) Error() string {
+	return fmt.Sprintf("signal '%s' can not be used to trigger a reload, must be one of SIGHUP, SIGUSR1 or SIGUSR2", e.Signal)
+}
+
+func (e *UnsupportedSignalError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// InvalidMaxLinesPerSecondError is returned if the maximum number of lines per second is negative.
+type InvalidMaxLinesPerSecondError struct {
+	MaxLinesPerSecond float64
+}
+
+func (e *InvalidMaxLinesPerSecondError) Error() string {
+	return fmt.Sprintf("maximum number of lines per second must not be negative, got %g", e.MaxLinesPerSecond)
+}
+
+func (e *InvalidMaxLinesPerSecondError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// ConflictingNginxScrapeError is returned if both the stub_status page and the NGINX Plus API are configured.
+// Both expose the same metrics, e.g. nginx_up.
+type ConflictingNginxScrapeError struct{}
+
+func (e *ConflictingNginxScrapeError) Error() string {
+	return "nginx scrape URL and NGINX Plus API URL are mutually exclusive"
+}
+
+func (e *ConflictingNginxScrapeError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// InvalidIdleWarningIntervalError is returned if the idle warning is enabled with an interval that is not positive.
+type InvalidIdleWarningIntervalError struct {
+	Interval time.Duration
+}
+
+func (e *InvalidIdleWarningIntervalError) Error() string {
+	return fmt.Sprintf("idle warning interval must be positive, got %s", e.Interval)
+}
+
+func (e *InvalidIdleWarningIntervalError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// InvalidWatchConfigIntervalError is returned if watching the config files is enabled with an interval that is not positive.
+type InvalidWatchConfigIntervalError struct {
+	Interval time.Duration
+}
+
+func (e *InvalidWatchConfigIntervalError) Error() string {
+	return fmt.Sprintf("watch config interval must be positive, got %s", e.Interval)
+}
+
+func (e *InvalidWatchConfigIntervalError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// InvalidReadyMaxErrorRatioError is returned if the maximum error ratio of the /-/ready endpoint is not between 0 and 1.
+type InvalidReadyMaxErrorRatioError struct {
+	Ratio float64
+}
+
+func (e *InvalidReadyMaxErrorRatioError) Error() string {
+	return fmt.Sprintf("maximum error ratio of the ready endpoint must be between 0 and 1, got %g", e.Ratio)
+}
+
+func (e *InvalidReadyMaxErrorRatioError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// UnsupportedProtobufModeError is returned if the protobuf negotiation mode of the /metrics endpoint is unknown.
+type UnsupportedProtobufModeError struct {
+	Mode string
+}
+
+func (e *UnsupportedProtobufModeError) Error() string {
+	return fmt.Sprintf("protobuf mode '%s' is not supported, must be one of auto, force or disable", e.Mode)
+}
+
+func (e *UnsupportedProtobufModeError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// UnsupportedConfigTestFormatError is returned if the output format of --config-test-lines is unknown.
+type UnsupportedConfigTestFormatError struct {
+	Format string
+}
+
+func (e *UnsupportedConfigTestFormatError) Error() string {
+	return fmt.Sprintf("config test format '%s' is not supported, must be one of text or jsonl", e.Format)
+}
+
+func (e *UnsupportedConfigTestFormatError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// DuplicateTenantError is returned if multiple tenants are routed by the same value.
+type DuplicateTenantError struct {
+	Value string
+}
+
+func (e *DuplicateTenantError) Error() string {
+	return fmt.Sprintf("tenant '%s' is defined multiple times", e.Value)
+}
+
+func (e *DuplicateTenantError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
+
+// InvalidTenantNamespaceError is returned if the namespace of a tenant is empty or used by another tenant.
+type InvalidTenantNamespaceError struct {
+	Value     string
+	Namespace string
+}
+
+func (e *InvalidTenantNamespaceError) Error() string {
+	return fmt.Sprintf("tenant '%s' requires a non-empty namespace not used by other tenants, got '%s'", e.Value, e.Namespace)
+}
+
+func (e *InvalidTenantNamespaceError) Is(target error) bool {
+	return target == ErrValidation //nolint:errorlint // sentinel comparison
+}
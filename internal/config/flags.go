@@ -2,14 +2,47 @@ package config
 
 import (
 	"flag"
+
+	"github.com/jkroepke/access-log-exporter/internal/config/types"
 )
 
+// stringSliceFlag is a [flag.Value] for [types.StringSlice] that can be repeated.
+// The first occurrence replaces the default value, further occurrences append to it.
+type stringSliceFlag struct {
+	slice *types.StringSlice
+	set   bool
+}
+
+func (f *stringSliceFlag) String() string {
+	if f.slice == nil {
+		return ""
+	}
+
+	return f.slice.String()
+}
+
+func (f *stringSliceFlag) Set(value string) error {
+	var values types.StringSlice
+	if err := values.UnmarshalText([]byte(value)); err != nil {
+		return err
+	}
+
+	if !f.set {
+		*f.slice = nil
+		f.set = true
+	}
+
+	*f.slice = append(*f.slice, values...)
+
+	return nil
+}
+
 //goland:noinspection GoMixedReceiverTypes
 func (c *Config) flagSet(flagSet *flag.FlagSet) {
 	flagSet.String(
 		"config",
 		lookupEnvOrDefault("config", "config.yaml"),
-		"path to one .yaml config file",
+		"path to a .yaml config file. Can be repeated or comma-separated to merge multiple files, later files take precedence",
 	)
 
 	flagSet.Bool(
@@ -22,14 +55,45 @@ func (c *Config) flagSet(flagSet *flag.FlagSet) {
 		&c.VerifyConfig,
 		"verify-config",
 		c.VerifyConfig,
-		"Enable this flag to check config file loads, then exit",
+		"Enable this flag to check config file loads, print a summary and exit. Exits with code 2 if there are warnings",
+	)
+
+	flagSet.BoolVar(
+		&c.DescribePreset,
+		"describe-preset",
+		c.DescribePreset,
+		"Enable this flag to print the field indices used by each metric of the selected preset and exit. Useful to debug field offsets.",
+	)
+
+	flagSet.StringVar(
+		&c.ConfigTestLines,
+		"config-test-lines",
+		c.ConfigTestLines,
+		"Path to a file of log lines to feed to the selected preset. Prints the resulting metrics and exits, "+
+			"or compares them with config-test-expected. Useful to test presets in CI.",
+	)
+
+	flagSet.StringVar(
+		&c.ConfigTestExpected,
+		"config-test-expected",
+		c.ConfigTestExpected,
+		"Path to the expected output of config-test-lines. Exits with code 1 and prints a diff on mismatch.",
+	)
+
+	flagSet.StringVar(
+		&c.ConfigTestFormat,
+		"config-test-format",
+		c.ConfigTestFormat,
+		"Output format of config-test-lines. One of text, the resulting metrics in the Prometheus text format, "+
+			"or jsonl, one JSON object with metric, labels and value per observation.",
 	)
 
 	flagSet.UintVar(
 		&c.BufferSize,
 		"buffer-size",
 		lookupEnvOrDefault("buffer_size", c.BufferSize),
-		"Size of the buffer for syslog messages. Default is 1000. Set to 0 to disable buffering.",
+		"Size of the buffer for syslog messages. Default is 1000. "+
+			"Set to 0 to disable buffering, the syslog reader then blocks until a worker takes over each message.",
 	)
 
 	flagSet.IntVar(
@@ -39,6 +103,45 @@ func (c *Config) flagSet(flagSet *flag.FlagSet) {
 		"Number of workers to process syslog messages. 0 or below means number of available CPU cores.",
 	)
 
+	flagSet.BoolVar(
+		&c.ResetOnReload,
+		"reset-on-reload",
+		lookupEnvOrDefault("reset-on-reload", c.ResetOnReload),
+		"Reset all metrics on a configuration reload. "+
+			"By default, metrics with an unchanged configuration keep their series across reloads.",
+	)
+
+	flagSet.BoolVar(
+		&c.SelfTest,
+		"self-test",
+		lookupEnvOrDefault("self-test", c.SelfTest),
+		"Feed the samples of the preset, or a synthetic line, through a separate collector on startup and "+
+			"refuse to start if no metric is produced. Catches a total misconfiguration before traffic arrives.",
+	)
+
+	flagSet.BoolVar(
+		&c.WatchConfig,
+		"watch-config",
+		lookupEnvOrDefault("watch-config", c.WatchConfig),
+		"Reload the configuration when a config file changes, e.g. a mounted Kubernetes ConfigMap. "+
+			"The files are polled every watch-config-interval. A reload starts once a change is stable for one interval.",
+	)
+
+	flagSet.DurationVar(
+		&c.WatchConfigInterval,
+		"watch-config-interval",
+		lookupEnvOrDefault("watch-config-interval", c.WatchConfigInterval),
+		"Interval to poll the config files for changes, if watch-config is enabled.",
+	)
+
+	flagSet.BoolVar(
+		&c.AllowEmptyPreset,
+		"allow-empty-preset",
+		lookupEnvOrDefault("allow-empty-preset", c.AllowEmptyPreset),
+		"Allow a preset without metrics. "+
+			"By default, such a preset is rejected, since the exporter would expose no metrics from the access log.",
+	)
+
 	flagSet.StringVar(
 		&c.Preset,
 		"preset",
@@ -53,6 +156,11 @@ func (c *Config) flagSet(flagSet *flag.FlagSet) {
 	c.flagSetDebug(flagSet)
 	c.flagSetWeb(flagSet)
 	c.flagSetSyslog(flagSet)
+	c.flagSetMetrics(flagSet)
+	c.flagSetPush(flagSet)
+	c.flagSetSignal(flagSet)
+	c.flagSetInput(flagSet)
+	c.flagSetTelemetry(flagSet)
 }
 
 //goland:noinspection GoMixedReceiverTypes
@@ -79,7 +187,51 @@ func (c *Config) flagSetNginx(flagSet *flag.FlagSet) {
 		lookupEnvOrDefault("nginx.scrape-url", c.Nginx.ScrapeURL),
 		"A URI or unix domain socket path for scraping NGINX metrics. "+
 			"For NGINX, the stub_status page must be available through the URI. "+
-			"Examples: http://127.0.0.1/stub_status or unix:///var/run/nginx-status.sock",
+			"Examples: http://127.0.0.1/stub_status or unix:///var/run/nginx-status.sock. "+
+			"To scrape multiple NGINX instances, list further URLs in nginx.scrapeUris of the config file.",
+	)
+	flagSet.TextVar(
+		&c.Nginx.PlusAPIURL,
+		"nginx.plus-api-url",
+		lookupEnvOrDefault("nginx.plus-api-url", c.Nginx.PlusAPIURL),
+		"A URI of the NGINX Plus API, including the API version, for scraping NGINX Plus metrics instead of the stub_status page. "+
+			"Example: http://127.0.0.1:8080/api/9",
+	)
+	flagSet.StringVar(
+		&c.Nginx.ScrapeUsername,
+		"nginx.scrape-username",
+		lookupEnvOrDefault("nginx.scrape-username", c.Nginx.ScrapeUsername),
+		"Username for HTTP basic auth when scraping NGINX metrics.",
+	)
+	flagSet.StringVar(
+		&c.Nginx.ScrapePassword,
+		"nginx.scrape-password",
+		lookupEnvOrDefault("nginx.scrape-password", c.Nginx.ScrapePassword),
+		"Password for HTTP basic auth when scraping NGINX metrics. Prefer the environment variable over the flag to keep it out of the process list.",
+	)
+	flagSet.StringVar(
+		&c.Nginx.ScrapeCAFile,
+		"nginx.scrape-ca-file",
+		lookupEnvOrDefault("nginx.scrape-ca-file", c.Nginx.ScrapeCAFile),
+		"Path to a PEM file of CA certificates to verify an HTTPS scrape URL, e.g. of an internal CA. By default, the system roots are used.",
+	)
+	flagSet.StringVar(
+		&c.Nginx.ScrapeCertFile,
+		"nginx.scrape-cert-file",
+		lookupEnvOrDefault("nginx.scrape-cert-file", c.Nginx.ScrapeCertFile),
+		"Path to a client certificate for scraping an HTTPS scrape URL. Requires nginx.scrape-key-file.",
+	)
+	flagSet.StringVar(
+		&c.Nginx.ScrapeKeyFile,
+		"nginx.scrape-key-file",
+		lookupEnvOrDefault("nginx.scrape-key-file", c.Nginx.ScrapeKeyFile),
+		"Path to the key of the client certificate for scraping an HTTPS scrape URL. Requires nginx.scrape-cert-file.",
+	)
+	flagSet.BoolVar(
+		&c.Nginx.ScrapeInsecureSkipVerify,
+		"nginx.scrape-insecure-skip-verify",
+		lookupEnvOrDefault("nginx.scrape-insecure-skip-verify", c.Nginx.ScrapeInsecureSkipVerify),
+		"Skip the verification of the server certificate of an HTTPS scrape URL. Insecure, use nginx.scrape-ca-file instead if possible.",
 	)
 	flagSet.DurationVar(
 		&c.Nginx.ScrapeTimeout,
@@ -87,6 +239,13 @@ func (c *Config) flagSetNginx(flagSet *flag.FlagSet) {
 		lookupEnvOrDefault("nginx.scrape-timeout", c.Nginx.ScrapeTimeout),
 		"Timeout for scraping NGINX metrics.",
 	)
+	flagSet.DurationVar(
+		&c.Nginx.CacheDuration,
+		"nginx.cache-duration",
+		lookupEnvOrDefault("nginx.cache-duration", c.Nginx.CacheDuration),
+		"Reuse the last successfully scraped stub_status for this duration instead of scraping NGINX again, "+
+			"e.g. if multiple Prometheus replicas scrape the exporter. 0 disables the cache.",
+	)
 }
 
 //goland:noinspection GoMixedReceiverTypes
@@ -101,11 +260,12 @@ func (c *Config) flagSetDebug(flagSet *flag.FlagSet) {
 
 //goland:noinspection GoMixedReceiverTypes
 func (c *Config) flagSetWeb(flagSet *flag.FlagSet) {
-	flagSet.StringVar(
-		&c.Web.ListenAddress,
+	c.Web.ListenAddress = lookupEnvOrDefault("web.listen-address", c.Web.ListenAddress)
+	flagSet.Var(
+		&stringSliceFlag{slice: &c.Web.ListenAddress},
 		"web.listen-address",
-		lookupEnvOrDefault("web.listen-address", c.Web.ListenAddress),
-		"Addresses on which to expose metrics. Examples: `:4041` or `[::1]:4041` for http",
+		"Addresses on which to expose metrics. Can be repeated or comma-separated. "+
+			"Examples: `:4041`, `[::1]:4041`, unix:///path/to/socket or systemd://[name] for http",
 	)
 	flagSet.StringVar(
 		&c.Web.TLSCertFile,
@@ -119,6 +279,33 @@ func (c *Config) flagSetWeb(flagSet *flag.FlagSet) {
 		lookupEnvOrDefault("web.tls-key-file", c.Web.TLSKeyFile),
 		"Path to the TLS private key file. When set along with --web.tls-cert-file, enables HTTPS.",
 	)
+	flagSet.DurationVar(
+		&c.Web.StaleThreshold,
+		"web.stale-threshold",
+		lookupEnvOrDefault("web.stale-threshold", c.Web.StaleThreshold),
+		"The /-/ready endpoint returns 503 if no log message was received within this duration. 0 disables the check.",
+	)
+	flagSet.Float64Var(
+		&c.Web.ReadyMaxErrorRatio,
+		"web.ready-max-error-ratio",
+		lookupEnvOrDefault("web.ready-max-error-ratio", c.Web.ReadyMaxErrorRatio),
+		"The /-/ready endpoint returns 503 if the ratio of log lines failing to parse exceeds this value, e.g. 0.5, "+
+			"for longer than --web.ready-error-grace-period. 0 disables the check.",
+	)
+	flagSet.DurationVar(
+		&c.Web.ReadyErrorGracePeriod,
+		"web.ready-error-grace-period",
+		lookupEnvOrDefault("web.ready-error-grace-period", c.Web.ReadyErrorGracePeriod),
+		"Duration the ratio of log lines failing to parse may exceed --web.ready-max-error-ratio before /-/ready returns 503. "+
+			"Tolerates short error bursts, e.g. on log rotation.",
+	)
+	flagSet.BoolVar(
+		&c.Web.ReusePort,
+		"web.reuse-port",
+		lookupEnvOrDefault("web.reuse-port", c.Web.ReusePort),
+		"Set SO_REUSEPORT on TCP listen addresses, so a new instance can bind the port before the old one exits. "+
+			"Enables restarts without scrape gaps.",
+	)
 }
 
 //goland:noinspection GoMixedReceiverTypes
@@ -127,6 +314,193 @@ func (c *Config) flagSetSyslog(flagSet *flag.FlagSet) {
 		&c.Syslog.ListenAddress,
 		"syslog.listen-address",
 		lookupEnvOrDefault("syslog.listen-address", c.Syslog.ListenAddress),
-		"Addresses on which to expose syslog. Examples: udp://0.0.0.0:8514, unix:///path/to/socket.",
+		"Addresses on which to expose syslog. Examples: udp://0.0.0.0:8514, tcp://0.0.0.0:8514, unix:///path/to/socket, systemd://[name].",
+	)
+	flagSet.BoolVar(
+		&c.Syslog.KeepTimestamp,
+		"syslog.keep-timestamp",
+		lookupEnvOrDefault("syslog.keep-timestamp", c.Syslog.KeepTimestamp),
+		"Prepend the RFC3164 timestamp of the syslog header as first field of each log line. "+
+			"All lineIndex and valueIndex values shift by one.",
+	)
+	flagSet.BoolVar(
+		&c.Syslog.KeepTag,
+		"syslog.keep-tag",
+		lookupEnvOrDefault("syslog.keep-tag", c.Syslog.KeepTag),
+		"Prepend the tag of the syslog header, e.g. nginx, as first field of each log line, after the timestamp if kept. "+
+			"All lineIndex and valueIndex values shift by one.",
+	)
+	flagSet.StringVar(
+		&c.Syslog.TLSCertFile,
+		"syslog.tls-cert-file",
+		lookupEnvOrDefault("syslog.tls-cert-file", c.Syslog.TLSCertFile),
+		"Path to the TLS certificate file. When set along with --syslog.tls-key-file, enables TLS for tcp:// syslog listeners.",
+	)
+	flagSet.StringVar(
+		&c.Syslog.TLSKeyFile,
+		"syslog.tls-key-file",
+		lookupEnvOrDefault("syslog.tls-key-file", c.Syslog.TLSKeyFile),
+		"Path to the TLS private key file. When set along with --syslog.tls-cert-file, enables TLS for tcp:// syslog listeners.",
+	)
+	flagSet.StringVar(
+		&c.Syslog.TLSClientCAFile,
+		"syslog.tls-client-ca-file",
+		lookupEnvOrDefault("syslog.tls-client-ca-file", c.Syslog.TLSClientCAFile),
+		"Path to a CA certificate file. When set, syslog clients must present a certificate signed by this CA (mutual TLS).",
+	)
+	flagSet.BoolVar(
+		&c.Syslog.GzipFrames,
+		"syslog.gzip-frames",
+		lookupEnvOrDefault("syslog.gzip-frames", c.Syslog.GzipFrames),
+		"Decompress octet-counted frames of the tcp:// syslog listener which are compressed with gzip. "+
+			"Newline framing is rejected, since compressed messages may contain newlines.",
+	)
+	flagSet.IntVar(
+		&c.Syslog.MaxMessageSize,
+		"syslog.max-message-size",
+		lookupEnvOrDefault("syslog.max-message-size", c.Syslog.MaxMessageSize),
+		"Maximum size of a syslog message in bytes. Longer messages are truncated and counted in syslog_truncated_messages_total.",
+	)
+	flagSet.TextVar(
+		&c.Syslog.SocketMode,
+		"syslog.socket-mode",
+		lookupEnvOrDefault("syslog.socket-mode", c.Syslog.SocketMode),
+		"File mode of the unix:// syslog socket in octal notation, e.g. 0666. By default, the mode follows the umask.",
+	)
+	flagSet.StringVar(
+		&c.Syslog.SocketOwner,
+		"syslog.socket-owner",
+		lookupEnvOrDefault("syslog.socket-owner", c.Syslog.SocketOwner),
+		"User name or ID to own the unix:// syslog socket. By default, the socket is owned by the user of the process.",
+	)
+	flagSet.StringVar(
+		&c.Syslog.SocketGroup,
+		"syslog.socket-group",
+		lookupEnvOrDefault("syslog.socket-group", c.Syslog.SocketGroup),
+		"Group name or ID to own the unix:// syslog socket, e.g. the group of nginx. By default, the socket is owned by the group of the process.",
+	)
+}
+
+//goland:noinspection GoMixedReceiverTypes
+func (c *Config) flagSetMetrics(flagSet *flag.FlagSet) {
+	flagSet.StringVar(
+		&c.Metrics.BuiltinNamespace,
+		"metrics.builtin-namespace",
+		lookupEnvOrDefault("metrics.builtin-namespace", c.Metrics.BuiltinNamespace),
+		"Namespace to prefix the built-in go_ and process_ metrics with. "+
+			"Useful to avoid name clashes with other exporters on the same target.",
+	)
+	flagSet.TextVar(
+		&c.Metrics.Buckets,
+		"metrics.buckets",
+		lookupEnvOrDefault("metrics.buckets", c.Metrics.Buckets),
+		"Comma-separated default buckets for histogram metrics without buckets. Example: 0.1,0.5,1,5",
+	)
+	flagSet.BoolVar(
+		&c.Metrics.CreatedTimestamps,
+		"metrics.created-timestamps",
+		lookupEnvOrDefault("metrics.created-timestamps", c.Metrics.CreatedTimestamps),
+		"Expose _created samples for counters and histograms if OpenMetrics is negotiated. "+
+			"Helps to detect counter resets.",
+	)
+	flagSet.StringVar(
+		&c.Metrics.Protobuf,
+		"metrics.protobuf",
+		lookupEnvOrDefault("metrics.protobuf", c.Metrics.Protobuf),
+		"Protobuf negotiation of the /metrics endpoint. Can be one of auto, force or disable. "+
+			"force always responds with protobuf, disable never does. Useful to debug scraper interoperability.",
+	)
+}
+
+//goland:noinspection GoMixedReceiverTypes
+func (c *Config) flagSetPush(flagSet *flag.FlagSet) {
+	flagSet.TextVar(
+		&c.Push.URL,
+		"push.url",
+		lookupEnvOrDefault("push.url", c.Push.URL),
+		"URL of a Prometheus Pushgateway. If set, all metrics are pushed periodically. "+
+			"Grouping labels can be defined via config file. Example: http://127.0.0.1:9091",
+	)
+	flagSet.StringVar(
+		&c.Push.Job,
+		"push.job",
+		lookupEnvOrDefault("push.job", c.Push.Job),
+		"Job name used for pushing metrics to the Pushgateway.",
+	)
+	flagSet.DurationVar(
+		&c.Push.Interval,
+		"push.interval",
+		lookupEnvOrDefault("push.interval", c.Push.Interval),
+		"Interval for pushing metrics to the Pushgateway.",
+	)
+}
+
+//goland:noinspection GoMixedReceiverTypes
+func (c *Config) flagSetSignal(flagSet *flag.FlagSet) {
+	c.Signal.Reload = lookupEnvOrDefault("signal.reload", c.Signal.Reload)
+	flagSet.Var(
+		&stringSliceFlag{slice: &c.Signal.Reload},
+		"signal.reload",
+		"Signals which trigger a configuration reload. Can be repeated or comma-separated. "+
+			"Can be one of SIGHUP, SIGUSR1 or SIGUSR2. SIGINT and SIGTERM always trigger a shutdown.",
+	)
+}
+
+//goland:noinspection GoMixedReceiverTypes
+func (c *Config) flagSetTelemetry(flagSet *flag.FlagSet) {
+	flagSet.BoolVar(
+		&c.Telemetry.Runtime,
+		"telemetry.runtime",
+		lookupEnvOrDefault("telemetry.runtime", c.Telemetry.Runtime),
+		"Expose the go_ and process_ runtime metrics.",
+	)
+	flagSet.BoolVar(
+		&c.Telemetry.Config,
+		"telemetry.config",
+		lookupEnvOrDefault("telemetry.config", c.Telemetry.Config),
+		"Expose the access_log_exporter_config_ metrics about the last configuration load.",
+	)
+	flagSet.BoolVar(
+		&c.Telemetry.Workers,
+		"telemetry.workers",
+		lookupEnvOrDefault("telemetry.workers", c.Telemetry.Workers),
+		"Expose the log_worker_ metrics about the line handler workers.",
+	)
+	flagSet.BoolVar(
+		&c.Telemetry.PerMetric,
+		"telemetry.per-metric",
+		lookupEnvOrDefault("telemetry.per-metric", c.Telemetry.PerMetric),
+		"Expose the self-metrics labeled by configured metric, e.g. log_metric_observations_total.",
+	)
+}
+
+//goland:noinspection GoMixedReceiverTypes
+func (c *Config) flagSetInput(flagSet *flag.FlagSet) {
+	flagSet.StringVar(
+		&c.Input.Delimiter,
+		"input.delimiter",
+		lookupEnvOrDefault("input.delimiter", c.Input.Delimiter),
+		"Delimiter between the fields of a log line. Delimiters with multiple characters are matched as a whole. "+
+			"An empty delimiter falls back to a tab.",
+	)
+	flagSet.Float64Var(
+		&c.Input.MaxLinesPerSecond,
+		"input.max-lines-per-second",
+		lookupEnvOrDefault("input.max-lines-per-second", c.Input.MaxLinesPerSecond),
+		"Maximum number of log lines processed per second. Excess lines are dropped and counted in log_lines_rate_limited_total. "+
+			"0 disables the limit.",
+	)
+	flagSet.DurationVar(
+		&c.Input.IdleWarningThreshold,
+		"input.idle-warning-threshold",
+		lookupEnvOrDefault("input.idle-warning-threshold", c.Input.IdleWarningThreshold),
+		"Log a warning if no log message was received within this duration, repeated every --input.idle-warning-interval. "+
+			"0 disables the warning.",
+	)
+	flagSet.DurationVar(
+		&c.Input.IdleWarningInterval,
+		"input.idle-warning-interval",
+		lookupEnvOrDefault("input.idle-warning-interval", c.Input.IdleWarningInterval),
+		"Minimum duration between two warnings about missing log messages, see --input.idle-warning-threshold.",
 	)
 }
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//nolint:gochecknoglobals
+var (
+	durationType        = reflect.TypeFor[time.Duration]()
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+)
+
+// decodeJSON decodes a JSON configuration file into c. Durations may be given as string like in YAML, e.g. "5s".
+//
+//goland:noinspection GoMixedReceiverTypes
+func (c *Config) decodeJSON(configFile []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(configFile))
+	decoder.UseNumber()
+
+	var value any
+
+	if err := decoder.Decode(&value); err != nil {
+		return err //nolint:wrapcheck // wrapped by caller
+	}
+
+	value, err := parseJSONDurations(value, reflect.TypeOf(c))
+	if err != nil {
+		return err
+	}
+
+	configFile, err = json.Marshal(value)
+	if err != nil {
+		return err //nolint:wrapcheck // wrapped by caller
+	}
+
+	decoder = json.NewDecoder(bytes.NewReader(configFile))
+	decoder.DisallowUnknownFields()
+
+	return decoder.Decode(c) //nolint:wrapcheck // wrapped by caller
+}
+
+// parseJSONDurations replaces the duration strings of the decoded JSON value by nanoseconds, which encoding/json
+// expects for a [time.Duration]. The type t of value is followed through nested objects by the json tags of the fields.
+func parseJSONDurations(value any, t reflect.Type) (any, error) {
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		return value, nil
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var err error
+
+	switch v := value.(type) {
+	case string:
+		if t != durationType {
+			return value, nil
+		}
+
+		duration, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q: %w", v, err)
+		}
+
+		return int64(duration), nil
+	case []any:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return value, nil
+		}
+
+		for i := range v {
+			if v[i], err = parseJSONDurations(v[i], t.Elem()); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]any:
+		for key, element := range v {
+			elementType, ok := jsonElementType(t, key)
+			if !ok {
+				continue // reported as unknown field by the decoder
+			}
+
+			if v[key], err = parseJSONDurations(element, elementType); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	return value, nil
+}
+
+// jsonElementType returns the type of the map element or the struct field with the given json key.
+func jsonElementType(t reflect.Type, key string) (reflect.Type, bool) {
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Elem(), true
+	case reflect.Struct:
+		for field := range t.Fields() {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if strings.EqualFold(name, key) {
+				return field.Type, true
+			}
+		}
+	}
+
+	return nil, false
+}
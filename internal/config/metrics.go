@@ -0,0 +1,22 @@
+package config
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+//nolint:gochecknoglobals
+var (
+	loadDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "access_log_exporter_config_load_duration_seconds",
+		Help: "Duration of the last successful configuration load.",
+	})
+	configBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "access_log_exporter_config_bytes",
+		Help: "Total size of the configuration files of the last successful configuration load.",
+	})
+)
+
+// Collectors returns the metrics describing the last successful configuration load by [New].
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{loadDuration, configBytes}
+}
@@ -3,8 +3,11 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"math"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,17 +18,93 @@ import (
 var ErrEmptyConfigFile = errors.New("configuration file is empty")
 
 type Config struct {
-	Presets      Presets `json:"presets"     yaml:"presets"`
-	Nginx        Nginx   `json:"nginx"       yaml:"nginx"`
-	Web          Web     `json:"web"         yaml:"web"`
-	ConfigFile   string  `json:"config"      yaml:"config"`
-	Syslog       Syslog  `json:"syslog"      yaml:"syslog"`
-	Preset       string  `json:"preset"      yaml:"preset"`
-	Log          Log     `json:"log"         yaml:"log"`
-	WorkerCount  int     `json:"workerCount" yaml:"workerCount"`
-	BufferSize   uint    `json:"bufferSize"  yaml:"bufferSize"`
-	Debug        Debug   `json:"debug"       yaml:"debug"`
-	VerifyConfig bool    `json:"-"`
+	Presets             Presets                       `json:"presets"              yaml:"presets"`
+	BucketSets          map[string]types.Float64Slice `json:"bucketSets,omitempty" yaml:"bucketSets,omitempty"`
+	Tenants             Tenants                       `json:"tenants"              yaml:"tenants"`
+	Nginx               Nginx                         `json:"nginx"                yaml:"nginx"`
+	Web                 Web                           `json:"web"                  yaml:"web"`
+	ConfigFile          string                        `json:"config"               yaml:"config"`
+	Syslog              Syslog                        `json:"syslog"               yaml:"syslog"`
+	Preset              string                        `json:"preset"               yaml:"preset"`
+	Log                 Log                           `json:"log"                  yaml:"log"`
+	WorkerCount         int                           `json:"workerCount"          yaml:"workerCount"`
+	BufferSize          uint                          `json:"bufferSize"           yaml:"bufferSize"`
+	Debug               Debug                         `json:"debug"                yaml:"debug"`
+	Metrics             Metrics                       `json:"metrics"              yaml:"metrics"`
+	Push                Push                          `json:"push"                 yaml:"push"`
+	Signal              Signal                        `json:"signal"               yaml:"signal"`
+	Input               Input                         `json:"input"                yaml:"input"`
+	Telemetry           Telemetry                     `json:"telemetry"            yaml:"telemetry"`
+	ResetOnReload       bool                          `json:"resetOnReload"        yaml:"resetOnReload"`
+	AllowEmptyPreset    bool                          `json:"allowEmptyPreset"     yaml:"allowEmptyPreset"`
+	SelfTest            bool                          `json:"selfTest"             yaml:"selfTest"`
+	WatchConfig         bool                          `json:"watchConfig"          yaml:"watchConfig"`
+	WatchConfigInterval time.Duration                 `json:"watchConfigInterval"  yaml:"watchConfigInterval"`
+	VerifyConfig        bool                          `json:"-"`
+	DescribePreset      bool                          `json:"-"`
+	ConfigTestLines     string                        `json:"-"`
+	ConfigTestExpected  string                        `json:"-"`
+	ConfigTestFormat    string                        `json:"-"`
+}
+
+// Output formats of --config-test-lines, see [Config.ConfigTestFormat].
+const (
+	ConfigTestFormatText  = "text"
+	ConfigTestFormatJSONL = "jsonl"
+)
+
+// Tenants runs additional presets side by side with the selected preset.
+// Lines are routed to a tenant by the value of the field at LineIndex. Lines of unknown tenants are handled by the selected preset.
+type Tenants struct {
+	Presets   []TenantPreset `json:"presets"   yaml:"presets"`
+	LineIndex uint           `json:"lineIndex" yaml:"lineIndex"`
+}
+
+// TenantPreset applies the metrics of Preset, prefixed by Namespace, to lines whose tenant field equals Value.
+type TenantPreset struct {
+	Value     string `json:"value"     yaml:"value"`
+	Preset    string `json:"preset"    yaml:"preset"`
+	Namespace string `json:"namespace" yaml:"namespace"`
+}
+
+// Telemetry enables or disables groups of the exporter's self-metrics.
+type Telemetry struct {
+	Runtime   bool `json:"runtime"   yaml:"runtime"`
+	Config    bool `json:"config"    yaml:"config"`
+	Workers   bool `json:"workers"   yaml:"workers"`
+	PerMetric bool `json:"perMetric" yaml:"perMetric"`
+}
+
+type Input struct {
+	Delimiter            string        `json:"delimiter"            yaml:"delimiter"`
+	MaxLinesPerSecond    float64       `json:"maxLinesPerSecond"    yaml:"maxLinesPerSecond"`
+	IdleWarningThreshold time.Duration `json:"idleWarningThreshold" yaml:"idleWarningThreshold"`
+	IdleWarningInterval  time.Duration `json:"idleWarningInterval"  yaml:"idleWarningInterval"`
+}
+
+type Signal struct {
+	Reload types.StringSlice `json:"reload" yaml:"reload"`
+}
+
+type Push struct {
+	Grouping map[string]string `json:"grouping" yaml:"grouping"`
+	URL      types.URL         `json:"url"      yaml:"url"`
+	Job      string            `json:"job"      yaml:"job"`
+	Interval time.Duration     `json:"interval" yaml:"interval"`
+}
+
+// Protobuf negotiation modes of the /metrics endpoint, see [Metrics.Protobuf].
+const (
+	ProtobufAuto    = "auto"
+	ProtobufForce   = "force"
+	ProtobufDisable = "disable"
+)
+
+type Metrics struct {
+	BuiltinNamespace  string             `json:"builtinNamespace"  yaml:"builtinNamespace"`
+	Protobuf          string             `json:"protobuf"          yaml:"protobuf"`
+	Buckets           types.Float64Slice `json:"buckets,omitempty" yaml:"buckets,omitempty"`
+	CreatedTimestamps bool               `json:"createdTimestamps" yaml:"createdTimestamps"`
 }
 
 type Log struct {
@@ -34,7 +113,17 @@ type Log struct {
 }
 
 type Syslog struct {
-	ListenAddress string `json:"listenAddress" yaml:"listenAddress"`
+	ListenAddress   string         `json:"listenAddress"         yaml:"listenAddress"`
+	KeepTimestamp   bool           `json:"keepTimestamp"         yaml:"keepTimestamp"`
+	KeepTag         bool           `json:"keepTag"               yaml:"keepTag"`
+	TLSCertFile     string         `json:"tlsCertFile"           yaml:"tlsCertFile"`
+	TLSKeyFile      string         `json:"tlsKeyFile"            yaml:"tlsKeyFile"`
+	TLSClientCAFile string         `json:"tlsClientCAFile"       yaml:"tlsClientCAFile"`
+	MaxMessageSize  int            `json:"maxMessageSize"        yaml:"maxMessageSize"`
+	SocketMode      types.FileMode `json:"socketMode,omitempty"  yaml:"socketMode,omitempty"`
+	SocketOwner     string         `json:"socketOwner,omitempty" yaml:"socketOwner,omitempty"`
+	SocketGroup     string         `json:"socketGroup,omitempty" yaml:"socketGroup,omitempty"`
+	GzipFrames      bool           `json:"gzipFrames,omitempty"  yaml:"gzipFrames,omitempty"`
 }
 
 type Debug struct {
@@ -42,48 +131,161 @@ type Debug struct {
 }
 
 type Web struct {
-	ListenAddress string `json:"listenAddress" yaml:"listenAddress"`
-	TLSCertFile   string `json:"tlsCertFile"   yaml:"tlsCertFile"`
-	TLSKeyFile    string `json:"tlsKeyFile"    yaml:"tlsKeyFile"`
+	TLSCertFile           string            `json:"tlsCertFile"           yaml:"tlsCertFile"`
+	TLSKeyFile            string            `json:"tlsKeyFile"            yaml:"tlsKeyFile"`
+	ListenAddress         types.StringSlice `json:"listenAddress"         yaml:"listenAddress"`
+	StaleThreshold        time.Duration     `json:"staleThreshold"        yaml:"staleThreshold"`
+	ReadyMaxErrorRatio    float64           `json:"readyMaxErrorRatio"    yaml:"readyMaxErrorRatio"`
+	ReadyErrorGracePeriod time.Duration     `json:"readyErrorGracePeriod" yaml:"readyErrorGracePeriod"`
+	ReusePort             bool              `json:"reusePort"             yaml:"reusePort"`
 }
 
 type Presets map[string]Preset
 
+// PresetFormatJSON is the [Preset.Format] of presets parsing log lines as JSON objects.
+// Metrics of such presets select fields by name, see [Label.Field] and [Metric.ValueField].
+const PresetFormatJSON = "json"
+
 type Preset struct {
-	Metrics []Metric `json:"metrics" yaml:"metrics"`
+	Metrics     []Metric `json:"metrics"               yaml:"metrics"`
+	FormatIndex *uint    `json:"formatIndex,omitempty" yaml:"formatIndex,omitempty"`
+	Format      string   `json:"format,omitempty"      yaml:"format,omitempty"`
+	MaxFields   int      `json:"maxFields,omitempty"   yaml:"maxFields,omitempty"`
+	Samples     []string `json:"samples,omitempty"     yaml:"samples,omitempty"`
 }
 
 type Metric struct {
-	ConstLabels  map[string]string  `json:"constLabels"            yaml:"constLabels"`
-	ValueIndex   *uint              `json:"valueIndex,omitempty"   yaml:"valueIndex,omitempty"`
-	Name         string             `json:"name"                   yaml:"name"`
-	Type         string             `json:"type"                   yaml:"type"`
-	Help         string             `json:"help"                   yaml:"help"`
-	Buckets      types.Float64Slice `json:"buckets,omitempty"      yaml:"buckets,omitempty"`
-	Labels       []Label            `json:"labels"                 yaml:"labels"`
-	Replacements []Replacement      `json:"replacements,omitempty" yaml:"replacements,omitempty"`
-	Upstream     Upstream           `json:"upstream"               yaml:"upstream"`
-	Math         Math               `json:"math"                   yaml:"math"`
+	ConstLabels                    map[string]string  `json:"constLabels"                              yaml:"constLabels"`
+	ValueIndex                     *uint              `json:"valueIndex,omitempty"                     yaml:"valueIndex,omitempty"`
+	ValueField                     string             `json:"valueField,omitempty"                     yaml:"valueField,omitempty"`
+	RatioIndices                   *[2]uint           `json:"ratioIndices,omitempty"                   yaml:"ratioIndices,omitempty"`
+	RequireNonEmptyIndex           *uint              `json:"requireNonEmptyIndex,omitempty"           yaml:"requireNonEmptyIndex,omitempty"`
+	Name                           string             `json:"name"                                     yaml:"name"`
+	Type                           string             `json:"type"                                     yaml:"type"`
+	Help                           string             `json:"help"                                     yaml:"help"`
+	Unit                           string             `json:"unit,omitempty"                           yaml:"unit,omitempty"`
+	Format                         string             `json:"format,omitempty"                         yaml:"format,omitempty"`
+	CountOnly                      bool               `json:"countOnly,omitempty"                      yaml:"countOnly,omitempty"`
+	QuarantineThreshold            uint               `json:"quarantineThreshold,omitempty"            yaml:"quarantineThreshold,omitempty"`
+	ResetThreshold                 float64            `json:"resetThreshold,omitempty"                 yaml:"resetThreshold,omitempty"`
+	SeriesTTL                      time.Duration      `json:"seriesTTL,omitempty"                      yaml:"seriesTTL,omitempty"`
+	ResetOnCollect                 bool               `json:"resetOnCollect,omitempty"                 yaml:"resetOnCollect,omitempty"`
+	MaxCardinality                 uint               `json:"maxCardinality,omitempty"                 yaml:"maxCardinality,omitempty"`
+	KVField                        *KVField           `json:"kvField,omitempty"                        yaml:"kvField,omitempty"`
+	ValueRegexp                    *regexp.Regexp     `json:"valueRegexp,omitempty"                    yaml:"valueRegexp,omitempty"`
+	ValueRegexpMatch               uint               `json:"valueRegexpMatch,omitempty"               yaml:"valueRegexpMatch,omitempty"`
+	ValueExpression                string             `json:"valueExpression,omitempty"                yaml:"valueExpression,omitempty"`
+	DropIfLabelMatches             []LabelMatch       `json:"dropIfLabelMatches,omitempty"             yaml:"dropIfLabelMatches,omitempty"`
+	Buckets                        types.Float64Slice `json:"buckets,omitempty"                        yaml:"buckets,omitempty"`
+	BucketSet                      string             `json:"bucketSet,omitempty"                      yaml:"bucketSet,omitempty"`
+	BucketsFrom                    string             `json:"bucketsFrom,omitempty"                    yaml:"bucketsFrom,omitempty"`
+	BucketOverrides                []BucketOverride   `json:"bucketOverrides,omitempty"                yaml:"bucketOverrides,omitempty"`
+	NativeHistogram                bool               `json:"nativeHistogram,omitempty"                yaml:"nativeHistogram,omitempty"`
+	NativeHistogramBucketFactor    float64            `json:"nativeHistogramBucketFactor,omitempty"    yaml:"nativeHistogramBucketFactor,omitempty"`
+	NativeHistogramMaxBucketNumber uint32             `json:"nativeHistogramMaxBucketNumber,omitempty" yaml:"nativeHistogramMaxBucketNumber,omitempty"`
+	ExemplarLabelIndex             *uint              `json:"exemplarLabelIndex,omitempty"             yaml:"exemplarLabelIndex,omitempty"`
+	ExemplarLabelName              string             `json:"exemplarLabelName,omitempty"              yaml:"exemplarLabelName,omitempty"`
+	Objectives                     types.Objectives   `json:"objectives,omitempty"                     yaml:"objectives,omitempty"`
+	Labels                         []Label            `json:"labels"                                   yaml:"labels"`
+	Replacements                   []Replacement      `json:"replacements,omitempty"                   yaml:"replacements,omitempty"`
+	Companions                     []Companion        `json:"companions,omitempty"                     yaml:"companions,omitempty"`
+	GaugeWhen                      *GaugeWhen         `json:"gaugeWhen,omitempty"                      yaml:"gaugeWhen,omitempty"`
+	Upstream                       Upstream           `json:"upstream"                                 yaml:"upstream"`
+	Math                           Math               `json:"math"                                     yaml:"math"`
+}
+
+// LabelMatch matches the field at LabelIndex of a log line against Regexp, see Metric.DropIfLabelMatches.
+type LabelMatch struct {
+	Regexp     *regexp.Regexp `json:"regexp"     yaml:"regexp"`
+	LabelIndex uint           `json:"labelIndex" yaml:"labelIndex"`
+}
+
+// KVField describes how to extract the value of a single key from a field containing key-value pairs,
+// e.g. "rt=0.123;sz=4096".
+type KVField struct {
+	Key           string `json:"key"                     yaml:"key"`
+	Separator     string `json:"separator,omitempty"     yaml:"separator,omitempty"`
+	PairSeparator string `json:"pairSeparator,omitempty" yaml:"pairSeparator,omitempty"`
+}
+
+// Companion describes an additional metric that is fed with the same value and labels as its parent metric.
+// Math, if set, replaces the math of the parent metric for the companion.
+type Companion struct {
+	Name       string             `json:"name"                 yaml:"name"`
+	Type       string             `json:"type"                 yaml:"type"`
+	Help       string             `json:"help"                 yaml:"help"`
+	Buckets    types.Float64Slice `json:"buckets,omitempty"    yaml:"buckets,omitempty"`
+	Objectives types.Objectives   `json:"objectives,omitempty" yaml:"objectives,omitempty"`
+	Math       *Math              `json:"math,omitempty"       yaml:"math,omitempty"`
+}
+
+// GaugeWhen switches a histogram to set a gauge instead of observing a sample
+// for log lines where the field at LineIndex equals one of Values.
+type GaugeWhen struct {
+	Name      string   `json:"name"      yaml:"name"`
+	Help      string   `json:"help"      yaml:"help"`
+	Values    []string `json:"values"    yaml:"values"`
+	LineIndex uint     `json:"lineIndex" yaml:"lineIndex"`
 }
 
+// BucketOverride observes a histogram with different buckets
+// for log lines where the field at LineIndex equals one of Values, e.g. coarser buckets for errors.
+type BucketOverride struct {
+	Values    []string           `json:"values"    yaml:"values"`
+	Buckets   types.Float64Slice `json:"buckets"   yaml:"buckets"`
+	LineIndex uint               `json:"lineIndex" yaml:"lineIndex"`
+}
+
+// Math transforms values in a fixed order: sub, add, div, then mul. Zero values are skipped.
+// Round is applied to the final value and is one of floor, ceil, round or none.
 type Math struct {
+	Round   string  `json:"round"   yaml:"round"`
 	Enabled bool    `json:"enabled" yaml:"enabled"`
+	Sub     float64 `json:"sub"     yaml:"sub"`
+	Add     float64 `json:"add"     yaml:"add"`
 	Mul     float64 `json:"mul"     yaml:"mul"`
 	Div     float64 `json:"div"     yaml:"div"`
 }
 
 type Upstream struct {
-	Excludes      []string `json:"excludes"      yaml:"excludes"`
-	AddrLineIndex uint     `json:"addrLineIndex" yaml:"addrLineIndex"`
-	Enabled       bool     `json:"enabled"       yaml:"enabled"`
-	Label         bool     `json:"label"         yaml:"label"`
+	Excludes        []string      `json:"excludes"                  yaml:"excludes"`
+	StatusLineIndex *uint         `json:"statusLineIndex,omitempty" yaml:"statusLineIndex,omitempty"`
+	ActiveMetric    string        `json:"activeMetric,omitempty"    yaml:"activeMetric,omitempty"`
+	ActiveWindow    time.Duration `json:"activeWindow,omitempty"    yaml:"activeWindow,omitempty"`
+	AddrLineIndex   uint          `json:"addrLineIndex"             yaml:"addrLineIndex"`
+	Enabled         bool          `json:"enabled"                   yaml:"enabled"`
+	Label           bool          `json:"label"                     yaml:"label"`
 }
 
+// LabelSSLProtocol and LabelSSLCipher select the part of a combined "$ssl_protocol/$ssl_cipher" field, see [Label.SSL].
+const (
+	LabelSSLProtocol = "protocol"
+	LabelSSLCipher   = "cipher"
+)
+
 type Label struct {
-	Name         string        `json:"name"                   yaml:"name"`
-	Replacements []Replacement `json:"replacements,omitempty" yaml:"replacements,omitempty"`
-	LineIndex    uint          `json:"lineIndex"              yaml:"lineIndex"`
-	UserAgent    bool          `json:"userAgent"              yaml:"userAgent"`
+	Name               string        `json:"name"                         yaml:"name"`
+	Field              string        `json:"field,omitempty"              yaml:"field,omitempty"`
+	SSL                string        `json:"ssl,omitempty"                yaml:"ssl,omitempty"`
+	Replacements       []Replacement `json:"replacements,omitempty"       yaml:"replacements,omitempty"`
+	Ranges             []LabelRange  `json:"ranges,omitempty"             yaml:"ranges,omitempty"`
+	Allowlist          []string      `json:"allowlist,omitempty"          yaml:"allowlist,omitempty"`
+	AllowlistFallback  string        `json:"allowlistFallback,omitempty"  yaml:"allowlistFallback,omitempty"`
+	HashBuckets        uint          `json:"hashBuckets,omitempty"        yaml:"hashBuckets,omitempty"`
+	LineIndex          uint          `json:"lineIndex"                    yaml:"lineIndex"`
+	UserAgent          bool          `json:"userAgent"                    yaml:"userAgent"`
+	TrimQuotes         bool          `json:"trimQuotes,omitempty"         yaml:"trimQuotes,omitempty"`
+	Header             bool          `json:"header,omitempty"             yaml:"header,omitempty"`
+	CollapseWhitespace bool          `json:"collapseWhitespace,omitempty" yaml:"collapseWhitespace,omitempty"`
+	ProtocolNormalize  bool          `json:"protocolNormalize,omitempty"  yaml:"protocolNormalize,omitempty"`
+	FirstSegment       bool          `json:"firstSegment,omitempty"       yaml:"firstSegment,omitempty"`
+	StripControl       bool          `json:"stripControl,omitempty"       yaml:"stripControl,omitempty"`
+}
+
+// LabelRange maps numeric label values up to and including Max to Value, e.g. response sizes to "small".
+type LabelRange struct {
+	Value string  `json:"value" yaml:"value"`
+	Max   float64 `json:"max"   yaml:"max"`
 }
 
 type Replacement struct {
@@ -94,8 +296,34 @@ type Replacement struct {
 }
 
 type Nginx struct {
-	ScrapeURL     types.URL     `json:"scrapeUri"     yaml:"scrapeUri"`
-	ScrapeTimeout time.Duration `json:"scrapeTimeout" yaml:"scrapeTimeout"`
+	ScrapeURL                types.URL     `json:"scrapeUri"                yaml:"scrapeUri"`
+	ScrapeURLs               []types.URL   `json:"scrapeUris,omitempty"     yaml:"scrapeUris,omitempty"`
+	PlusAPIURL               types.URL     `json:"plusApiUri"               yaml:"plusApiUri"`
+	ScrapeUsername           string        `json:"scrapeUsername"           yaml:"scrapeUsername"`
+	ScrapePassword           string        `json:"scrapePassword"           yaml:"scrapePassword"`
+	ScrapeCAFile             string        `json:"scrapeCaFile"             yaml:"scrapeCaFile"`
+	ScrapeCertFile           string        `json:"scrapeCertFile"           yaml:"scrapeCertFile"`
+	ScrapeKeyFile            string        `json:"scrapeKeyFile"            yaml:"scrapeKeyFile"`
+	ScrapeTimeout            time.Duration `json:"scrapeTimeout"            yaml:"scrapeTimeout"`
+	CacheDuration            time.Duration `json:"cacheDuration"            yaml:"cacheDuration"`
+	ScrapeInsecureSkipVerify bool          `json:"scrapeInsecureSkipVerify" yaml:"scrapeInsecureSkipVerify"`
+}
+
+// ScrapeTargets returns the stub_status URLs to scrape, i.e. the scrape URL, if set, followed by the scrape URLs.
+func (n Nginx) ScrapeTargets() []string {
+	targets := make([]string, 0, len(n.ScrapeURLs)+1)
+
+	if !n.ScrapeURL.IsEmpty() {
+		targets = append(targets, n.ScrapeURL.String())
+	}
+
+	for _, scrapeURL := range n.ScrapeURLs {
+		if !scrapeURL.IsEmpty() {
+			targets = append(targets, scrapeURL.String())
+		}
+	}
+
+	return targets
 }
 
 //goland:noinspection GoMixedReceiverTypes
@@ -108,6 +336,50 @@ func (c Config) String() string {
 	return string(jsonString)
 }
 
+// MarshalJSON encodes an infinite Max, e.g. of a catch-all range, as string, since JSON numbers can't represent it.
+func (r LabelRange) MarshalJSON() ([]byte, error) {
+	type Alias struct {
+		Max   any    `json:"max"`
+		Value string `json:"value"`
+	}
+
+	if math.IsInf(r.Max, 0) {
+		return json.Marshal(Alias{Value: r.Value, Max: strconv.FormatFloat(r.Max, 'g', -1, 64)}) //nolint:wrapcheck
+	}
+
+	return json.Marshal(Alias{Value: r.Value, Max: r.Max}) //nolint:wrapcheck
+}
+
+// UnmarshalJSON accepts an infinite Max encoded as string, see [LabelRange.MarshalJSON].
+func (r *LabelRange) UnmarshalJSON(jsonBytes []byte) error {
+	var aux struct {
+		Max   any    `json:"max"`
+		Value string `json:"value"`
+	}
+
+	if err := json.Unmarshal(jsonBytes, &aux); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	switch limit := aux.Max.(type) {
+	case float64:
+		r.Max = limit
+	case string:
+		limitValue, err := strconv.ParseFloat(limit, 64)
+		if err != nil {
+			return fmt.Errorf("invalid max of label range: %w", err)
+		}
+
+		r.Max = limitValue
+	default:
+		return fmt.Errorf("invalid max of label range: %v", aux.Max)
+	}
+
+	r.Value = aux.Value
+
+	return nil
+}
+
 func (r *Replacement) UnmarshalYAML(data *yaml.Node) error {
 	type Alias Replacement
 
@@ -119,6 +391,25 @@ func (r *Replacement) UnmarshalYAML(data *yaml.Node) error {
 
 	*r = Replacement(aux)
 
+	return r.init()
+}
+
+func (r *Replacement) UnmarshalJSON(jsonBytes []byte) error {
+	type Alias Replacement
+
+	aux := Alias(*r)
+
+	if err := json.Unmarshal(jsonBytes, &aux); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	*r = Replacement(aux)
+
+	return r.init()
+}
+
+// init validates a decoded replacement and builds the StringReplacer of a string replacement.
+func (r *Replacement) init() error {
 	if r.Regexp != nil && r.String != nil {
 		return errors.New("replacement can not have both regexp and string")
 	}
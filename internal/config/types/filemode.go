@@ -0,0 +1,52 @@
+package types
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+)
+
+// FileMode is a file permission mode, written in octal notation like chmod, e.g. 0660.
+type FileMode fs.FileMode
+
+// String returns the octal representation of the mode, e.g. 0660, or an empty string if the mode is unset.
+func (m FileMode) String() string {
+	if m == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%04o", uint32(m))
+}
+
+// MarshalText implements [encoding.TextMarshaler] interface.
+func (m FileMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements the [encoding.TextUnmarshaler] interface.
+// The mode is always parsed as octal number, with or without a leading 0 or 0o. An empty text unsets the mode.
+func (m *FileMode) UnmarshalText(text []byte) error {
+	value := string(text)
+	if value == "" {
+		*m = 0
+
+		return nil
+	}
+
+	if len(value) > 2 && value[0] == '0' && (value[1] == 'o' || value[1] == 'O') {
+		value = value[2:]
+	}
+
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return fmt.Errorf("failed to parse octal file mode from string '%s': %w", text, err)
+	}
+
+	if fs.FileMode(mode)&^fs.ModePerm != 0 {
+		return fmt.Errorf("file mode '%s' exceeds the permission bits 0777", text)
+	}
+
+	*m = FileMode(mode)
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package types_test
+
+import (
+	"testing"
+
+	"github.com/jkroepke/access-log-exporter/internal/config/types"
+	"github.com/stretchr/testify/require"
+	"go.yaml.in/yaml/v4"
+)
+
+func TestFileModeUnmarshalText(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name   string
+		input  string
+		expect types.FileMode
+		err    string
+	}{
+		{"leading zero", "0660", 0o660, ""},
+		{"without leading zero", "660", 0o660, ""},
+		{"leading 0o", "0o775", 0o775, ""},
+		{"empty", "", 0, ""},
+		{"invalid digit", "0680", 0, "failed to parse octal file mode"},
+		{"special bits", "04755", 0, "exceeds the permission bits"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mode types.FileMode
+
+			err := mode.UnmarshalText([]byte(tc.input))
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, mode)
+		})
+	}
+}
+
+func TestFileModeYAML(t *testing.T) {
+	t.Parallel()
+
+	var config struct {
+		Mode types.FileMode `yaml:"mode"`
+	}
+
+	// Unquoted values are read as octal, too.
+	require.NoError(t, yaml.Unmarshal([]byte("mode: 0660"), &config))
+	require.Equal(t, types.FileMode(0o660), config.Mode)
+
+	out, err := yaml.Marshal(config)
+	require.NoError(t, err)
+	require.Equal(t, "mode: \"0660\"\n", string(out))
+}
@@ -0,0 +1,119 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// Objectives maps summary quantiles to their allowed absolute error, e.g. 0.99 → 0.001.
+// The compact text form is a comma-separated list of quantile:error pairs, e.g. "0.5:0.05,0.9:0.01,0.99:0.001".
+type Objectives map[float64]float64
+
+// String returns the compact string representation of the objectives, sorted by quantile.
+//
+//goland:noinspection GoMixedReceiverTypes
+func (o Objectives) String() string {
+	pairs := make([]string, 0, len(o))
+
+	for _, quantile := range slices.Sorted(maps.Keys(o)) {
+		pairs = append(pairs, strconv.FormatFloat(quantile, 'g', -1, 64)+":"+strconv.FormatFloat(o[quantile], 'g', -1, 64))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// MarshalText implements [encoding.TextMarshaler] interface.
+//
+//goland:noinspection GoMixedReceiverTypes
+func (o Objectives) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText implements the [encoding.TextUnmarshaler] interface.
+//
+//goland:noinspection GoMixedReceiverTypes
+func (o *Objectives) UnmarshalText(text []byte) error {
+	pairs := strings.Split(string(text), ",")
+	objectives := make(Objectives, len(pairs))
+
+	for _, pair := range pairs {
+		quantileString, errorString, ok := strings.Cut(pair, ":")
+		if !ok {
+			return fmt.Errorf("objective '%s' must be in the format quantile:error", pair)
+		}
+
+		quantile, err := strconv.ParseFloat(strings.TrimSpace(quantileString), 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse quantile from string '%s': %w", quantileString, err)
+		}
+
+		objectiveError, err := strconv.ParseFloat(strings.TrimSpace(errorString), 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse error from string '%s': %w", errorString, err)
+		}
+
+		objectives[quantile] = objectiveError
+	}
+
+	*o = objectives
+
+	return nil
+}
+
+// UnmarshalJSON implements the [json.Unmarshaler] interface.
+// JSON object keys are strings, so the quantiles are parsed from them.
+//
+//goland:noinspection GoMixedReceiverTypes
+func (o *Objectives) UnmarshalJSON(jsonBytes []byte) error {
+	var text string
+	if err := json.Unmarshal(jsonBytes, &text); err == nil {
+		return o.UnmarshalText([]byte(text))
+	}
+
+	var stringMap map[string]float64
+
+	if err := json.NewDecoder(bytes.NewReader(jsonBytes)).Decode(&stringMap); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	objectives := make(Objectives, len(stringMap))
+
+	for quantileString, objectiveError := range stringMap {
+		quantile, err := strconv.ParseFloat(quantileString, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse quantile from string '%s': %w", quantileString, err)
+		}
+
+		objectives[quantile] = objectiveError
+	}
+
+	*o = objectives
+
+	return nil
+}
+
+// UnmarshalYAML implements the [yaml.Unmarshaler] interface.
+// A scalar value is accepted as well and handled like [Objectives.UnmarshalText].
+//
+//goland:noinspection GoMixedReceiverTypes
+func (o *Objectives) UnmarshalYAML(data *yaml.Node) error {
+	if data.Kind == yaml.ScalarNode {
+		return o.UnmarshalText([]byte(data.Value))
+	}
+
+	var objectives map[float64]float64
+
+	err := data.Decode(&objectives)
+
+	*o = objectives
+
+	//nolint:wrapcheck
+	return err
+}
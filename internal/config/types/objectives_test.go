@@ -0,0 +1,66 @@
+package types_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jkroepke/access-log-exporter/internal/config/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.yaml.in/yaml/v4"
+)
+
+func TestObjectivesUnmarshalText(t *testing.T) {
+	t.Parallel()
+
+	objectives := types.Objectives{}
+
+	require.NoError(t, objectives.UnmarshalText([]byte("0.5:0.05,0.9:0.01,0.99:0.001")))
+
+	assert.Equal(t, types.Objectives{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}, objectives)
+}
+
+func TestObjectivesUnmarshalTextInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []string{"0.5", "a:0.05", "0.5:b"} {
+		t.Run(tc, func(t *testing.T) {
+			t.Parallel()
+
+			objectives := types.Objectives{}
+
+			require.Error(t, objectives.UnmarshalText([]byte(tc)))
+		})
+	}
+}
+
+func TestObjectivesMarshalText(t *testing.T) {
+	t.Parallel()
+
+	text, err := types.Objectives{0.99: 0.001, 0.5: 0.05, 0.9: 0.01}.MarshalText()
+
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("0.5:0.05,0.9:0.01,0.99:0.001"), text)
+}
+
+func TestObjectivesUnmarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	var objectives types.Objectives
+
+	require.NoError(t, json.NewDecoder(strings.NewReader(`{"0.5":0.05,"0.99":0.001}`)).Decode(&objectives))
+
+	assert.Equal(t, types.Objectives{0.5: 0.05, 0.99: 0.001}, objectives)
+}
+
+func TestObjectivesUnmarshalYAML(t *testing.T) {
+	t.Parallel()
+
+	var objectives types.Objectives
+
+	require.NoError(t, yaml.NewDecoder(strings.NewReader("0.5: 0.05\n0.99: 0.001\n")).Decode(&objectives))
+
+	assert.Equal(t, types.Objectives{0.5: 0.05, 0.99: 0.001}, objectives)
+}
@@ -3,10 +3,12 @@ package types
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"go.yaml.in/yaml/v4"
 )
 
@@ -50,9 +52,14 @@ func (s *StringSlice) UnmarshalJSON(jsonBytes []byte) error {
 }
 
 // UnmarshalYAML implements the [yaml.Unmarshaler] interface.
+// A scalar value is accepted as well and handled like [StringSlice.UnmarshalText].
 //
 //goland:noinspection GoMixedReceiverTypes
 func (s *StringSlice) UnmarshalYAML(data *yaml.Node) error {
+	if data.Kind == yaml.ScalarNode {
+		return s.UnmarshalText([]byte(data.Value))
+	}
+
 	var slice []string
 
 	err := data.Decode(&slice)
@@ -107,9 +114,30 @@ func (s *Float64Slice) UnmarshalText(text []byte) error {
 }
 
 // UnmarshalJSON implements the [json.Unmarshaler] interface.
+// Like [Float64Slice.UnmarshalYAML], a string is handled like [Float64Slice.UnmarshalText]
+// and an object generates the buckets, e.g. {"exponential": {"start": 0.005, "factor": 2, "count": 12}}.
 //
 //goland:noinspection GoMixedReceiverTypes
 func (s *Float64Slice) UnmarshalJSON(jsonBytes []byte) error {
+	switch bytes.TrimSpace(jsonBytes)[0] {
+	case '"':
+		var text string
+
+		if err := json.Unmarshal(jsonBytes, &text); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		return s.UnmarshalText([]byte(text))
+	case '{':
+		var generator float64SliceGenerator
+
+		if err := json.Unmarshal(jsonBytes, &generator); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		return s.generate(generator)
+	}
+
 	var slice []float64
 
 	err := json.NewDecoder(bytes.NewReader(jsonBytes)).Decode(&slice)
@@ -120,10 +148,42 @@ func (s *Float64Slice) UnmarshalJSON(jsonBytes []byte) error {
 	return err
 }
 
+// float64SliceGenerator generates buckets, either exponential or linear, see [prometheus.ExponentialBuckets]
+// and [prometheus.LinearBuckets].
+type float64SliceGenerator struct {
+	Exponential *struct {
+		Start  float64 `json:"start"  yaml:"start"`
+		Factor float64 `json:"factor" yaml:"factor"`
+		Count  int     `json:"count"  yaml:"count"`
+	} `json:"exponential" yaml:"exponential"`
+	Linear *struct {
+		Start float64 `json:"start" yaml:"start"`
+		Width float64 `json:"width" yaml:"width"`
+		Count int     `json:"count" yaml:"count"`
+	} `json:"linear" yaml:"linear"`
+}
+
 // UnmarshalYAML implements the [yaml.Unmarshaler] interface.
+// A scalar value is accepted as well and handled like [Float64Slice.UnmarshalText].
+// A mapping generates the buckets, e.g. {exponential: {start: 0.005, factor: 2, count: 12}}
+// or {linear: {start: 0, width: 100, count: 10}}.
 //
 //goland:noinspection GoMixedReceiverTypes
 func (s *Float64Slice) UnmarshalYAML(data *yaml.Node) error {
+	if data.Kind == yaml.ScalarNode {
+		return s.UnmarshalText([]byte(data.Value))
+	}
+
+	if data.Kind == yaml.MappingNode {
+		var generator float64SliceGenerator
+
+		if err := data.Decode(&generator); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		return s.generate(generator)
+	}
+
 	var slice []float64
 
 	err := data.Decode(&slice)
@@ -133,3 +193,35 @@ func (s *Float64Slice) UnmarshalYAML(data *yaml.Node) error {
 	//nolint:wrapcheck
 	return err
 }
+
+// generate resolves a bucket generator. The arguments are validated upfront,
+// since the generators of the Prometheus client panic on invalid arguments.
+//
+//goland:noinspection GoMixedReceiverTypes
+func (s *Float64Slice) generate(generator float64SliceGenerator) error {
+	switch {
+	case generator.Exponential != nil && generator.Linear != nil:
+		return errors.New("buckets can not be both exponential and linear")
+	case generator.Exponential != nil:
+		exponential := generator.Exponential
+
+		if exponential.Count < 1 || exponential.Start <= 0 || exponential.Factor <= 1 {
+			return fmt.Errorf("exponential buckets require count >= 1, start > 0 and factor > 1, got count %d, start %g and factor %g",
+				exponential.Count, exponential.Start, exponential.Factor)
+		}
+
+		*s = prometheus.ExponentialBuckets(exponential.Start, exponential.Factor, exponential.Count)
+	case generator.Linear != nil:
+		linear := generator.Linear
+
+		if linear.Count < 1 || linear.Width <= 0 {
+			return fmt.Errorf("linear buckets require count >= 1 and width > 0, got count %d and width %g", linear.Count, linear.Width)
+		}
+
+		*s = prometheus.LinearBuckets(linear.Start, linear.Width, linear.Count)
+	default:
+		return errors.New("buckets generator must be either exponential or linear")
+	}
+
+	return nil
+}
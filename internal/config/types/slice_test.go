@@ -51,6 +51,16 @@ func TestSliceUnmarshalYAML(t *testing.T) {
 	assert.Equal(t, types.StringSlice{"a", "b", "c", "d"}, slice)
 }
 
+func TestSliceUnmarshalYAMLScalar(t *testing.T) {
+	t.Parallel()
+
+	slice := types.StringSlice{}
+
+	require.NoError(t, yaml.NewDecoder(strings.NewReader(`":4040"`)).Decode(&slice))
+
+	assert.Equal(t, types.StringSlice{":4040"}, slice)
+}
+
 func TestFloat64SliceUnmarshalText(t *testing.T) {
 	t.Parallel()
 
@@ -90,3 +100,71 @@ func TestFloat64SliceUnmarshalYAML(t *testing.T) {
 
 	assert.Equal(t, types.Float64Slice{0.5, 0.6, 0.7, 0.8}, slice)
 }
+
+func TestFloat64SliceUnmarshalYAMLScalar(t *testing.T) {
+	t.Parallel()
+
+	var slice types.Float64Slice
+
+	require.NoError(t, yaml.NewDecoder(strings.NewReader(`"0.5,0.6"`)).Decode(&slice))
+
+	assert.Equal(t, types.Float64Slice{0.5, 0.6}, slice)
+}
+
+func TestFloat64SliceUnmarshalYAMLGenerator(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name    string
+		yaml    string
+		buckets types.Float64Slice
+		err     string
+	}{
+		{
+			name:    "exponential",
+			yaml:    "exponential: {start: 0.005, factor: 2, count: 4}",
+			buckets: types.Float64Slice{0.005, 0.01, 0.02, 0.04},
+		},
+		{
+			name:    "linear",
+			yaml:    "linear: {start: 0, width: 100, count: 3}",
+			buckets: types.Float64Slice{0, 100, 200},
+		},
+		{
+			name: "exponential with invalid factor",
+			yaml: "exponential: {start: 0.005, factor: 1, count: 4}",
+			err:  "exponential buckets require count >= 1, start > 0 and factor > 1, got count 4, start 0.005 and factor 1",
+		},
+		{
+			name: "linear without count",
+			yaml: "linear: {start: 0, width: 100}",
+			err:  "linear buckets require count >= 1 and width > 0, got count 0 and width 100",
+		},
+		{
+			name: "both generators",
+			yaml: "{exponential: {start: 1, factor: 2, count: 2}, linear: {start: 0, width: 1, count: 2}}",
+			err:  "buckets can not be both exponential and linear",
+		},
+		{
+			name: "unknown generator",
+			yaml: "{}",
+			err:  "buckets generator must be either exponential or linear",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var slice types.Float64Slice
+
+			err := yaml.NewDecoder(strings.NewReader(tc.yaml)).Decode(&slice)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.InDeltaSlice(t, tc.buckets, slice, 1e-9)
+		})
+	}
+}
@@ -1,18 +1,150 @@
 package config
 
 import (
-	"errors"
-	"fmt"
+	"strings"
+
+	"github.com/jkroepke/access-log-exporter/internal/config/types"
 )
 
 // Validate validates the config.
+// All returned errors match [ErrValidation] and can be inspected with [errors.As].
 func Validate(conf Config) error {
-	_, ok := conf.Presets[conf.Preset]
+	preset, ok := conf.Presets[conf.Preset]
 	if !ok {
-		return fmt.Errorf("preset '%s' not found in configuration", conf.Preset)
+		return &PresetNotFoundError{Preset: conf.Preset}
+	}
+
+	if err := validatePreset(conf.Preset, preset); err != nil {
+		return err
+	}
+
+	if err := validateBucketSets(conf.Preset, preset, conf.BucketSets); err != nil {
+		return err
+	}
+
+	if err := validateTenants(conf); err != nil {
+		return err
+	}
+
+	if len(preset.Metrics) == 0 && !conf.AllowEmptyPreset {
+		return &EmptyPresetError{Preset: conf.Preset}
+	}
+
+	if err := validateTLS(conf); err != nil {
+		return err
+	}
+
+	if err := validateSignals(conf); err != nil {
+		return err
+	}
+
+	switch conf.ConfigTestFormat {
+	case "", ConfigTestFormatText, ConfigTestFormatJSONL:
+	default:
+		return &UnsupportedConfigTestFormatError{Format: conf.ConfigTestFormat}
+	}
+
+	switch conf.Metrics.Protobuf {
+	case "", ProtobufAuto, ProtobufForce, ProtobufDisable:
+	default:
+		return &UnsupportedProtobufModeError{Mode: conf.Metrics.Protobuf}
+	}
+
+	if conf.Web.ReadyMaxErrorRatio < 0 || conf.Web.ReadyMaxErrorRatio > 1 {
+		return &InvalidReadyMaxErrorRatioError{Ratio: conf.Web.ReadyMaxErrorRatio}
+	}
+
+	if len(conf.Nginx.ScrapeTargets()) > 0 && !conf.Nginx.PlusAPIURL.IsEmpty() {
+		return &ConflictingNginxScrapeError{}
+	}
+
+	if conf.Input.MaxLinesPerSecond < 0 {
+		return &InvalidMaxLinesPerSecondError{MaxLinesPerSecond: conf.Input.MaxLinesPerSecond}
+	}
+
+	if conf.Input.IdleWarningThreshold > 0 && conf.Input.IdleWarningInterval <= 0 {
+		return &InvalidIdleWarningIntervalError{Interval: conf.Input.IdleWarningInterval}
+	}
+
+	if conf.WatchConfig && conf.WatchConfigInterval <= 0 {
+		return &InvalidWatchConfigIntervalError{Interval: conf.WatchConfigInterval}
+	}
+
+	return nil
+}
+
+// validatePreset validates the metrics of a preset.
+func validatePreset(name string, preset Preset) error {
+	if preset.Format != "" && preset.Format != PresetFormatJSON {
+		return &UnsupportedPresetFormatError{Preset: name, Format: preset.Format}
+	}
+
+	metricNames := make(map[string]struct{}, len(preset.Metrics))
+
+	for _, metric := range preset.Metrics {
+		if _, ok := metricNames[metric.Name]; ok {
+			return &DuplicateMetricError{Preset: name, Metric: metric.Name}
+		}
+
+		metricNames[metric.Name] = struct{}{}
+
+		if metric.Format != "" && preset.FormatIndex == nil {
+			return &FormatWithoutFormatIndexError{Preset: name, Metric: metric.Name}
+		}
+	}
+
+	return nil
+}
+
+// validateBucketSets validates that all bucket sets referenced by the metrics of a preset are defined.
+func validateBucketSets(name string, preset Preset, bucketSets map[string]types.Float64Slice) error {
+	for _, metric := range preset.Metrics {
+		if metric.BucketSet == "" {
+			continue
+		}
+
+		if _, ok := bucketSets[metric.BucketSet]; !ok {
+			return &BucketSetNotFoundError{Preset: name, Metric: metric.Name, BucketSet: metric.BucketSet}
+		}
+	}
+
+	return nil
+}
+
+// validateTenants validates the presets of all tenants. Each tenant needs a distinct value and namespace,
+// otherwise lines can't be routed or metric names collide.
+func validateTenants(conf Config) error {
+	values := make(map[string]struct{}, len(conf.Tenants.Presets))
+	namespaces := make(map[string]struct{}, len(conf.Tenants.Presets))
+
+	for _, tenant := range conf.Tenants.Presets {
+		if _, ok := values[tenant.Value]; ok {
+			return &DuplicateTenantError{Value: tenant.Value}
+		}
+
+		values[tenant.Value] = struct{}{}
+
+		if _, ok := namespaces[tenant.Namespace]; ok || tenant.Namespace == "" {
+			return &InvalidTenantNamespaceError{Value: tenant.Value, Namespace: tenant.Namespace}
+		}
+
+		namespaces[tenant.Namespace] = struct{}{}
+
+		preset, ok := conf.Presets[tenant.Preset]
+		if !ok {
+			return &PresetNotFoundError{Preset: tenant.Preset}
+		}
+
+		if err := validatePreset(tenant.Preset, preset); err != nil {
+			return err
+		}
+
+		if err := validateBucketSets(tenant.Preset, preset, conf.BucketSets); err != nil {
+			return err
+		}
 	}
 
-	return validateTLS(conf)
+	return nil
 }
 
 // validateTLS validates TLS configuration.
@@ -21,7 +153,36 @@ func validateTLS(conf Config) error {
 	keySet := conf.Web.TLSKeyFile != ""
 
 	if certSet != keySet {
-		return errors.New("both TLS certificate and key files must be set to enable TLS")
+		return &IncompleteTLSError{CertFile: conf.Web.TLSCertFile, KeyFile: conf.Web.TLSKeyFile}
+	}
+
+	certSet = conf.Syslog.TLSCertFile != ""
+	keySet = conf.Syslog.TLSKeyFile != ""
+
+	// A client CA is only used for TLS connections.
+	if certSet != keySet || (conf.Syslog.TLSClientCAFile != "" && !certSet) {
+		return &IncompleteTLSError{CertFile: conf.Syslog.TLSCertFile, KeyFile: conf.Syslog.TLSKeyFile}
+	}
+
+	if certSet && !strings.HasPrefix(conf.Syslog.ListenAddress, "tcp://") {
+		return &SyslogTLSWithoutTCPError{ListenAddress: conf.Syslog.ListenAddress}
+	}
+
+	if (conf.Nginx.ScrapeCertFile != "") != (conf.Nginx.ScrapeKeyFile != "") {
+		return &IncompleteTLSError{CertFile: conf.Nginx.ScrapeCertFile, KeyFile: conf.Nginx.ScrapeKeyFile}
+	}
+
+	return nil
+}
+
+// validateSignals validates the signals configured to trigger a reload.
+func validateSignals(conf Config) error {
+	for _, signal := range conf.Signal.Reload {
+		switch signal {
+		case "SIGHUP", "SIGUSR1", "SIGUSR2":
+		default:
+			return &UnsupportedSignalError{Signal: signal}
+		}
 	}
 
 	return nil
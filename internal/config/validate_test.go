@@ -2,8 +2,10 @@ package config_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/jkroepke/access-log-exporter/internal/config"
+	"github.com/jkroepke/access-log-exporter/internal/config/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -43,7 +45,7 @@ func TestValidateTLS(t *testing.T) {
 	validConfig := func() config.Config {
 		return config.Config{
 			Preset:  "test",
-			Presets: config.Presets{"test": {}},
+			Presets: config.Presets{"test": {Metrics: []config.Metric{{Name: "http_requests_total"}}}},
 		}
 	}
 
@@ -88,6 +90,52 @@ func TestValidateTLS(t *testing.T) {
 			}(),
 			err: "both TLS certificate and key files must be set to enable TLS",
 		},
+		{
+			name: "syslog TLS on tcp listener",
+			conf: func() config.Config {
+				c := validConfig()
+				c.Syslog.ListenAddress = "tcp://[::]:8514"
+				c.Syslog.TLSCertFile = "/path/to/cert.pem"
+				c.Syslog.TLSKeyFile = "/path/to/key.pem"
+				c.Syslog.TLSClientCAFile = "/path/to/ca.pem"
+
+				return c
+			}(),
+			err: "",
+		},
+		{
+			name: "syslog client CA without cert",
+			conf: func() config.Config {
+				c := validConfig()
+				c.Syslog.ListenAddress = "tcp://[::]:8514"
+				c.Syslog.TLSClientCAFile = "/path/to/ca.pem"
+
+				return c
+			}(),
+			err: "both TLS certificate and key files must be set to enable TLS",
+		},
+		{
+			name: "syslog TLS on udp listener",
+			conf: func() config.Config {
+				c := validConfig()
+				c.Syslog.ListenAddress = "udp://[::]:8514"
+				c.Syslog.TLSCertFile = "/path/to/cert.pem"
+				c.Syslog.TLSKeyFile = "/path/to/key.pem"
+
+				return c
+			}(),
+			err: "syslog TLS requires a tcp:// listen address, got 'udp://[::]:8514'",
+		},
+		{
+			name: "nginx scrape cert without key",
+			conf: func() config.Config {
+				c := validConfig()
+				c.Nginx.ScrapeCertFile = "/path/to/cert.pem"
+
+				return c
+			}(),
+			err: "both TLS certificate and key files must be set to enable TLS",
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
@@ -102,3 +150,376 @@ func TestValidateTLS(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateErrorTypes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("preset not found", func(t *testing.T) {
+		t.Parallel()
+
+		err := config.Validate(config.Config{Preset: "missing"})
+		require.ErrorIs(t, err, config.ErrValidation)
+
+		var presetNotFoundError *config.PresetNotFoundError
+
+		require.ErrorAs(t, err, &presetNotFoundError)
+		assert.Equal(t, "missing", presetNotFoundError.Preset)
+	})
+
+	t.Run("duplicate metric", func(t *testing.T) {
+		t.Parallel()
+
+		err := config.Validate(config.Config{
+			Preset: "test",
+			Presets: config.Presets{"test": {
+				Metrics: []config.Metric{
+					{Name: "http_requests_total"},
+					{Name: "http_requests_total"},
+				},
+			}},
+		})
+		require.ErrorIs(t, err, config.ErrValidation)
+		require.EqualError(t, err, "metric 'http_requests_total' is defined multiple times in preset 'test'")
+
+		var duplicateMetricError *config.DuplicateMetricError
+
+		require.ErrorAs(t, err, &duplicateMetricError)
+		assert.Equal(t, "test", duplicateMetricError.Preset)
+		assert.Equal(t, "http_requests_total", duplicateMetricError.Metric)
+	})
+
+	t.Run("empty preset", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset:  "test",
+			Presets: config.Presets{"test": {}},
+		}
+
+		err := config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+		require.EqualError(t, err, "preset 'test' defines no metrics, set --allow-empty-preset to allow it")
+
+		var emptyPresetError *config.EmptyPresetError
+
+		require.ErrorAs(t, err, &emptyPresetError)
+		assert.Equal(t, "test", emptyPresetError.Preset)
+
+		conf.AllowEmptyPreset = true
+
+		require.NoError(t, config.Validate(conf))
+	})
+
+	t.Run("bucket set not found", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset: "test",
+			Presets: config.Presets{"test": {
+				Metrics: []config.Metric{{Name: "http_request_duration_seconds", BucketSet: "latency"}},
+			}},
+		}
+
+		err := config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+		require.EqualError(t, err, "metric 'http_request_duration_seconds' in preset 'test' references the undefined bucket set 'latency'")
+
+		var bucketSetNotFoundError *config.BucketSetNotFoundError
+
+		require.ErrorAs(t, err, &bucketSetNotFoundError)
+		assert.Equal(t, "latency", bucketSetNotFoundError.BucketSet)
+
+		conf.BucketSets = map[string]types.Float64Slice{"latency": {0.1, 1}}
+
+		require.NoError(t, config.Validate(conf))
+	})
+
+	t.Run("incomplete TLS", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset:  "test",
+			Presets: config.Presets{"test": {Metrics: []config.Metric{{Name: "http_requests_total"}}}},
+		}
+		conf.Web.TLSCertFile = "/path/to/cert.pem"
+
+		err := config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+
+		var incompleteTLSError *config.IncompleteTLSError
+
+		require.ErrorAs(t, err, &incompleteTLSError)
+		assert.Equal(t, "/path/to/cert.pem", incompleteTLSError.CertFile)
+		assert.Empty(t, incompleteTLSError.KeyFile)
+	})
+
+	t.Run("unsupported reload signal", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset:  "test",
+			Presets: config.Presets{"test": {Metrics: []config.Metric{{Name: "http_requests_total"}}}},
+		}
+		conf.Signal.Reload = types.StringSlice{"SIGHUP", "SIGTERM"}
+
+		err := config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+
+		var unsupportedSignalError *config.UnsupportedSignalError
+
+		require.ErrorAs(t, err, &unsupportedSignalError)
+		assert.Equal(t, "SIGTERM", unsupportedSignalError.Signal)
+	})
+
+	t.Run("format without format index", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset: "test",
+			Presets: config.Presets{"test": {
+				Metrics: []config.Metric{{Name: "http_requests_total", Format: "access"}},
+			}},
+		}
+
+		err := config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+
+		var formatWithoutFormatIndexError *config.FormatWithoutFormatIndexError
+
+		require.ErrorAs(t, err, &formatWithoutFormatIndexError)
+		assert.Equal(t, "test", formatWithoutFormatIndexError.Preset)
+		assert.Equal(t, "http_requests_total", formatWithoutFormatIndexError.Metric)
+	})
+
+	t.Run("unsupported preset format", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset:  "test",
+			Presets: config.Presets{"test": {Format: "csv"}},
+		}
+
+		err := config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+		require.EqualError(t, err, "preset 'test' defines the unsupported format 'csv', must be empty or json")
+
+		var unsupportedPresetFormatError *config.UnsupportedPresetFormatError
+
+		require.ErrorAs(t, err, &unsupportedPresetFormatError)
+		assert.Equal(t, "csv", unsupportedPresetFormatError.Format)
+	})
+
+	t.Run("unsupported protobuf mode", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset:  "test",
+			Presets: config.Presets{"test": {Metrics: []config.Metric{{Name: "http_requests_total"}}}},
+		}
+		conf.Metrics.Protobuf = "always"
+
+		err := config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+		require.EqualError(t, err, "protobuf mode 'always' is not supported, must be one of auto, force or disable")
+
+		var unsupportedProtobufModeError *config.UnsupportedProtobufModeError
+
+		require.ErrorAs(t, err, &unsupportedProtobufModeError)
+		assert.Equal(t, "always", unsupportedProtobufModeError.Mode)
+	})
+
+	t.Run("invalid ready max error ratio", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset:  "test",
+			Presets: config.Presets{"test": {Metrics: []config.Metric{{Name: "http_requests_total"}}}},
+		}
+		conf.Web.ReadyMaxErrorRatio = 1.5
+
+		err := config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+		require.EqualError(t, err, "maximum error ratio of the ready endpoint must be between 0 and 1, got 1.5")
+
+		var invalidReadyMaxErrorRatioError *config.InvalidReadyMaxErrorRatioError
+
+		require.ErrorAs(t, err, &invalidReadyMaxErrorRatioError)
+		assert.InDelta(t, 1.5, invalidReadyMaxErrorRatioError.Ratio, 0)
+	})
+
+	t.Run("tenants", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset: "test",
+			Presets: config.Presets{
+				"test": {Metrics: []config.Metric{{Name: "http_requests_total"}}},
+				"shop": {Metrics: []config.Metric{{Name: "http_requests_total"}}},
+			},
+		}
+
+		conf.Tenants.Presets = []config.TenantPreset{{Value: "shop", Preset: "missing", Namespace: "shop"}}
+
+		var presetNotFoundError *config.PresetNotFoundError
+
+		require.ErrorAs(t, config.Validate(conf), &presetNotFoundError)
+		assert.Equal(t, "missing", presetNotFoundError.Preset)
+
+		conf.Tenants.Presets = []config.TenantPreset{
+			{Value: "shop", Preset: "shop", Namespace: "shop"},
+			{Value: "shop", Preset: "shop", Namespace: "shop2"},
+		}
+
+		err := config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+		require.EqualError(t, err, "tenant 'shop' is defined multiple times")
+
+		conf.Tenants.Presets = []config.TenantPreset{
+			{Value: "shop", Preset: "shop", Namespace: "shop"},
+			{Value: "blog", Preset: "shop", Namespace: "shop"},
+		}
+
+		err = config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+		require.EqualError(t, err, "tenant 'blog' requires a non-empty namespace not used by other tenants, got 'shop'")
+
+		var invalidTenantNamespaceError *config.InvalidTenantNamespaceError
+
+		require.ErrorAs(t, err, &invalidTenantNamespaceError)
+		assert.Equal(t, "blog", invalidTenantNamespaceError.Value)
+
+		conf.Tenants.Presets[1].Namespace = "blog"
+
+		require.NoError(t, config.Validate(conf))
+	})
+
+	t.Run("negative max lines per second", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset:  "test",
+			Presets: config.Presets{"test": {Metrics: []config.Metric{{Name: "http_requests_total"}}}},
+		}
+		conf.Input.MaxLinesPerSecond = -1
+
+		err := config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+
+		var invalidMaxLinesPerSecondError *config.InvalidMaxLinesPerSecondError
+
+		require.ErrorAs(t, err, &invalidMaxLinesPerSecondError)
+		assert.InDelta(t, -1, invalidMaxLinesPerSecondError.MaxLinesPerSecond, 0)
+	})
+
+	t.Run("nginx scrape URL and plus API URL", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset:  "test",
+			Presets: config.Presets{"test": {Metrics: []config.Metric{{Name: "http_requests_total"}}}},
+		}
+
+		var err error
+
+		conf.Nginx.ScrapeURL, err = types.NewURL("http://127.0.0.1/stub_status")
+		require.NoError(t, err)
+
+		conf.Nginx.PlusAPIURL, err = types.NewURL("http://127.0.0.1/api/9")
+		require.NoError(t, err)
+
+		err = config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+		require.ErrorAs(t, err, new(*config.ConflictingNginxScrapeError))
+	})
+
+	t.Run("idle warning without interval", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset:  "test",
+			Presets: config.Presets{"test": {Metrics: []config.Metric{{Name: "http_requests_total"}}}},
+		}
+		conf.Input.IdleWarningThreshold = time.Minute
+
+		err := config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+		require.EqualError(t, err, "idle warning interval must be positive, got 0s")
+
+		var invalidIdleWarningIntervalError *config.InvalidIdleWarningIntervalError
+
+		require.ErrorAs(t, err, &invalidIdleWarningIntervalError)
+		assert.Zero(t, invalidIdleWarningIntervalError.Interval)
+	})
+
+	t.Run("unsupported config test format", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset:           "test",
+			Presets:          config.Presets{"test": {Metrics: []config.Metric{{Name: "http_requests_total"}}}},
+			ConfigTestFormat: "json",
+		}
+
+		err := config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+		require.EqualError(t, err, "config test format 'json' is not supported, must be one of text or jsonl")
+		require.ErrorAs(t, err, new(*config.UnsupportedConfigTestFormatError))
+	})
+
+	t.Run("watch config without interval", func(t *testing.T) {
+		t.Parallel()
+
+		conf := config.Config{
+			Preset:      "test",
+			Presets:     config.Presets{"test": {Metrics: []config.Metric{{Name: "http_requests_total"}}}},
+			WatchConfig: true,
+		}
+
+		err := config.Validate(conf)
+		require.ErrorIs(t, err, config.ErrValidation)
+		require.EqualError(t, err, "watch config interval must be positive, got 0s")
+		require.ErrorAs(t, err, new(*config.InvalidWatchConfigIntervalError))
+	})
+}
+
+func TestWarnings(t *testing.T) {
+	t.Parallel()
+
+	warnings := config.Warnings(config.Config{
+		Presets: config.Presets{
+			"test": config.Preset{
+				Metrics: []config.Metric{
+					{
+						Name: "http_requests_total",
+						Type: "counter",
+						Math: config.Math{Enabled: true},
+						Upstream: config.Upstream{
+							Enabled: true,
+						},
+					},
+					{
+						Name:       "http_request_duration_seconds",
+						Type:       "histogram",
+						ValueIndex: new(uint(1)),
+						Buckets:    []float64{0.1, 1},
+						Objectives: types.Objectives{0.5: 0.05},
+					},
+					{
+						Name:            "http_response_duration_seconds",
+						Type:            "histogram",
+						ValueIndex:      new(uint(1)),
+						Buckets:         []float64{0.1, 1},
+						NativeHistogram: true,
+					},
+				},
+			},
+		},
+	})
+
+	require.Equal(t, []config.Warning{
+		{Preset: "test", Metric: "http_requests_total", Message: "math is enabled, but none of sub, add, mul, div or round is set"},
+		{Preset: "test", Metric: "http_requests_total", Message: "upstream is ignored for metrics without valueIndex"},
+		{Preset: "test", Metric: "http_request_duration_seconds", Message: "objectives are ignored for histogram metrics"},
+		{Preset: "test", Metric: "http_response_duration_seconds", Message: "buckets are ignored for native histograms"},
+	}, warnings)
+}
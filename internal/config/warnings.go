@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Warning describes a configuration issue that doesn't prevent the exporter from running,
+// but likely doesn't behave as intended.
+type Warning struct {
+	Preset  string
+	Metric  string
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Metric == "" {
+		return fmt.Sprintf("preset '%s': %s", w.Preset, w.Message)
+	}
+
+	return fmt.Sprintf("preset '%s', metric '%s': %s", w.Preset, w.Metric, w.Message)
+}
+
+// Warnings returns the warnings of all presets, sorted by preset name.
+func Warnings(conf Config) []Warning {
+	warnings := make([]Warning, 0)
+
+	for _, name := range slices.Sorted(maps.Keys(conf.Presets)) {
+		warnings = append(warnings, presetWarnings(name, conf.Presets[name])...)
+	}
+
+	return warnings
+}
+
+// presetWarnings returns the warnings of a single preset.
+func presetWarnings(name string, preset Preset) []Warning {
+	if len(preset.Metrics) == 0 {
+		return []Warning{{Preset: name, Message: "preset does not define any metrics"}}
+	}
+
+	warnings := make([]Warning, 0)
+
+	for _, metric := range preset.Metrics {
+		if len(metric.Buckets) != 0 && metric.Type != "histogram" {
+			warnings = append(warnings, Warning{
+				Preset:  name,
+				Metric:  metric.Name,
+				Message: fmt.Sprintf("buckets are ignored for %s metrics", metric.Type),
+			})
+		}
+
+		if len(metric.Buckets) != 0 && metric.NativeHistogram {
+			warnings = append(warnings, Warning{
+				Preset:  name,
+				Metric:  metric.Name,
+				Message: "buckets are ignored for native histograms",
+			})
+		}
+
+		if len(metric.Objectives) != 0 && metric.Type != "summary" {
+			warnings = append(warnings, Warning{
+				Preset:  name,
+				Metric:  metric.Name,
+				Message: fmt.Sprintf("objectives are ignored for %s metrics", metric.Type),
+			})
+		}
+
+		if metric.Math.Enabled && metric.Math.Sub == 0 && metric.Math.Add == 0 && metric.Math.Mul == 0 && metric.Math.Div == 0 &&
+			(metric.Math.Round == "" || metric.Math.Round == "none") {
+			warnings = append(warnings, Warning{
+				Preset:  name,
+				Metric:  metric.Name,
+				Message: "math is enabled, but none of sub, add, mul, div or round is set",
+			})
+		}
+
+		if metric.Upstream.Enabled && metric.ValueIndex == nil && metric.ValueRegexp == nil && metric.RatioIndices == nil {
+			warnings = append(warnings, Warning{
+				Preset:  name,
+				Metric:  metric.Name,
+				Message: "upstream is ignored for metrics without valueIndex",
+			})
+		}
+	}
+
+	return warnings
+}
@@ -0,0 +1,86 @@
+package metric
+
+import (
+	"strings"
+	"sync"
+)
+
+// overflowLabel is the label of the series new label sets are routed to once maxCardinality is reached.
+const overflowLabel = "overflow"
+
+// cardinalityLimit tracks the distinct label sets of a metric and admits up to max of them.
+type cardinalityLimit struct {
+	seen map[string]struct{}
+	mu   sync.Mutex
+	max  uint
+}
+
+func newCardinalityLimit(maxCardinality uint) *cardinalityLimit {
+	return &cardinalityLimit{
+		seen: make(map[string]struct{}),
+		max:  maxCardinality,
+	}
+}
+
+// admit reports whether the label set is known or still fits within the limit, and records it in the latter case.
+func (c *cardinalityLimit) admit(labels []string) bool {
+	key := strings.Join(labels, "\xff")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.seen[key]; ok {
+		return true
+	}
+
+	if uint(len(c.seen)) >= c.max {
+		return false
+	}
+
+	c.seen[key] = struct{}{}
+
+	return true
+}
+
+// forget releases the label set, e.g. after its series expired, so a new label set can take its place.
+func (c *cardinalityLimit) forget(labels []string) {
+	key := strings.Join(labels, "\xff")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.seen, key)
+}
+
+// reset releases all label sets.
+func (c *cardinalityLimit) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.seen)
+}
+
+// limitCardinality returns the label values to observe, including the overflow label if maxCardinality is configured.
+// Once maxCardinality label sets are known, new label sets are routed to the overflow series instead,
+// whose labels are all empty except overflow="true".
+func (m *Metric) limitCardinality(labels []string) []string {
+	if m.cardinality == nil {
+		return labels
+	}
+
+	if !m.cardinality.admit(labels) {
+		return m.overflowLabels
+	}
+
+	// The label values from the pool have spare capacity for the overflow label, so this doesn't allocate.
+	return append(labels, "")
+}
+
+// releaseCardinality releases the label set of a deleted series. The label values include the overflow label.
+func (m *Metric) releaseCardinality(labels []string) {
+	if m.cardinality == nil || labels[len(labels)-1] != "" {
+		return
+	}
+
+	m.cardinality.forget(labels[:len(labels)-1])
+}
@@ -0,0 +1,81 @@
+package metric
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// escapedESC is the escape character as logged by nginx, which escapes control characters in log values by default.
+const escapedESC = `\x1B`
+
+// stripControl removes ANSI escape sequences, e.g. the color code "\x1b[31m", and all other control characters.
+// Since nginx logs the escape character as \x1B, escape sequences in that form are removed as well.
+func stripControl(value string) string {
+	if !strings.ContainsFunc(value, unicode.IsControl) && !strings.Contains(value, escapedESC) && !strings.Contains(value, `\x1b`) {
+		return value
+	}
+
+	var builder strings.Builder
+
+	builder.Grow(len(value))
+
+	for i := 0; i < len(value); {
+		if n := escapeLength(value[i:]); n > 0 {
+			i += n
+			i += escapeSequenceLength(value[i:])
+
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(value[i:])
+		if !unicode.IsControl(r) {
+			builder.WriteString(value[i : i+size])
+		}
+
+		i += size
+	}
+
+	return builder.String()
+}
+
+// escapeLength returns the length of the escape character at the start of value, either raw or escaped by nginx.
+func escapeLength(value string) int {
+	switch {
+	case value != "" && value[0] == '\x1b':
+		return 1
+	case len(value) >= len(escapedESC) && strings.EqualFold(value[:len(escapedESC)], escapedESC):
+		return len(escapedESC)
+	default:
+		return 0
+	}
+}
+
+// escapeSequenceLength returns the length of the escape sequence following an escape character.
+// A control sequence like "[1;31m" ends with a byte in the range @ to ~. Other sequences consist of a single byte.
+func escapeSequenceLength(value string) int {
+	if value == "" {
+		return 0
+	}
+
+	if value[0] != '[' {
+		if value[0] >= '@' && value[0] <= '_' {
+			return 1
+		}
+
+		return 0
+	}
+
+	for i := 1; i < len(value); i++ {
+		// Parameter bytes are in the range 0 to ?, intermediate bytes in the range space to /.
+		if value[i] >= '@' && value[i] <= '~' {
+			return i + 1
+		}
+
+		if value[i] < ' ' || value[i] > '?' {
+			return i
+		}
+	}
+
+	return len(value)
+}
@@ -0,0 +1,78 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jkroepke/access-log-exporter/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// defaultExemplarLabelName is the exemplar label name if exemplarLabelName isn't set.
+const defaultExemplarLabelName = "trace_id"
+
+// validateExemplar ensures exemplars are only configured for histograms with a valid label name.
+func validateExemplar(cfg config.Metric) error {
+	if cfg.ExemplarLabelIndex == nil {
+		if cfg.ExemplarLabelName != "" {
+			return errors.New("exemplarLabelName requires exemplarLabelIndex to be set")
+		}
+
+		return nil
+	}
+
+	if cfg.Type != "histogram" {
+		return errors.New("exemplarLabelIndex can only be used with histogram metrics")
+	}
+
+	name := exemplarLabelName(cfg)
+	if !model.UTF8Validation.IsValidLabelName(name) || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+		return fmt.Errorf("invalid exemplar label name %q", name)
+	}
+
+	return nil
+}
+
+// exemplarLabelName returns the configured exemplar label name or the default.
+func exemplarLabelName(cfg config.Metric) string {
+	if cfg.ExemplarLabelName == "" {
+		return defaultExemplarLabelName
+	}
+
+	return cfg.ExemplarLabelName
+}
+
+// exemplar returns the exemplar labels of line, or nil if no exemplar is configured or the field is missing,
+// empty or "-". Values exceeding the exemplar size limit of Prometheus are skipped as well,
+// since they would be rejected on observation.
+func (m *Metric) exemplar(line []string) prometheus.Labels {
+	if m.cfg.ExemplarLabelIndex == nil || *m.cfg.ExemplarLabelIndex >= uint(len(line)) {
+		return nil
+	}
+
+	value := traceID(line[*m.cfg.ExemplarLabelIndex])
+	if value == "" || value == "-" {
+		return nil
+	}
+
+	name := exemplarLabelName(m.cfg)
+	if !utf8.ValidString(value) || utf8.RuneCountInString(name)+utf8.RuneCountInString(value) > prometheus.ExemplarMaxRunes {
+		return nil
+	}
+
+	return prometheus.Labels{name: value}
+}
+
+// traceID returns the trace ID of a W3C traceparent header like
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01. Other values are returned unchanged.
+func traceID(value string) string {
+	parts := strings.Split(value, "-")
+	if len(parts) == 4 && len(parts[0]) == 2 && len(parts[1]) == 32 && len(parts[2]) == 16 {
+		return parts[1]
+	}
+
+	return value
+}
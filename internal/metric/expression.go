@@ -0,0 +1,297 @@
+package metric
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxExpressionLength and maxExpressionDepth bound the work to compile and evaluate a valueExpression.
+	maxExpressionLength = 256
+	maxExpressionDepth  = 16
+)
+
+var errExpressionNotFinite = errors.New("result is not a finite number")
+
+// expression is a compiled valueExpression, e.g. "value / fields[4]".
+// It supports numbers, the value of the metric, numeric fields of the log line, parentheses,
+// negation and the operators +, -, * and /. There are no functions or other identifiers, so evaluating it has no side effects.
+type expression struct {
+	root expressionNode
+}
+
+type expressionNode interface {
+	eval(value float64, line []string) (float64, error)
+}
+
+type (
+	expressionNumber float64
+	expressionValue  struct{}
+	expressionField  uint
+	expressionNegate struct{ operand expressionNode }
+	expressionBinary struct {
+		left, right expressionNode
+		operator    byte
+	}
+)
+
+func (n expressionNumber) eval(float64, []string) (float64, error) {
+	return float64(n), nil
+}
+
+func (expressionValue) eval(value float64, _ []string) (float64, error) {
+	return value, nil
+}
+
+func (n expressionField) eval(_ float64, line []string) (float64, error) {
+	if uint(n) >= uint(len(line)) {
+		return 0, fmt.Errorf("line index out of range for fields[%d], line length is %d", n, len(line))
+	}
+
+	field := strings.TrimSpace(line[n])
+
+	value, err := strconv.ParseFloat(field, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse fields[%d] %q: %w", n, field, err)
+	}
+
+	return value, nil
+}
+
+func (n expressionNegate) eval(value float64, line []string) (float64, error) {
+	operand, err := n.operand.eval(value, line)
+
+	return -operand, err
+}
+
+func (n expressionBinary) eval(value float64, line []string) (float64, error) {
+	left, err := n.left.eval(value, line)
+	if err != nil {
+		return 0, err
+	}
+
+	right, err := n.right.eval(value, line)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n.operator {
+	case '+':
+		return left + right, nil
+	case '-':
+		return left - right, nil
+	case '*':
+		return left * right, nil
+	default:
+		return left / right, nil
+	}
+}
+
+// eval evaluates the expression for the value and fields of a log line.
+// A result like a division by zero, which is not a finite number, returns an error.
+func (e *expression) eval(value float64, line []string) (float64, error) {
+	result, err := e.root.eval(value, line)
+	if err != nil {
+		return 0, err
+	}
+
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, errExpressionNotFinite
+	}
+
+	return result, nil
+}
+
+// newExpression compiles a valueExpression. Anything beyond the supported grammar is rejected.
+func newExpression(source string) (*expression, error) {
+	if len(source) > maxExpressionLength {
+		return nil, fmt.Errorf("value expression exceeds %d characters", maxExpressionLength)
+	}
+
+	parser := expressionParser{source: source}
+
+	root, err := parser.parseSum(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value expression %q: %w", source, err)
+	}
+
+	if parser.skipSpace(); parser.pos != len(source) {
+		return nil, fmt.Errorf("invalid value expression %q: unexpected %q at position %d", source, source[parser.pos], parser.pos)
+	}
+
+	return &expression{root: root}, nil
+}
+
+// expressionParser is a recursive descent parser for the grammar
+//
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number | "value" | "fields" "[" index "]" | "(" sum ")"
+type expressionParser struct {
+	source string
+	pos    int
+}
+
+func (p *expressionParser) parseSum(depth int) (expressionNode, error) {
+	left, err := p.parseProduct(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume('+') || p.consume('-') {
+		operator := p.source[p.pos-1]
+
+		right, err := p.parseProduct(depth)
+		if err != nil {
+			return nil, err
+		}
+
+		left = expressionBinary{left: left, right: right, operator: operator}
+	}
+
+	return left, nil
+}
+
+func (p *expressionParser) parseProduct(depth int) (expressionNode, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume('*') || p.consume('/') {
+		operator := p.source[p.pos-1]
+
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+
+		left = expressionBinary{left: left, right: right, operator: operator}
+	}
+
+	return left, nil
+}
+
+func (p *expressionParser) parseUnary(depth int) (expressionNode, error) {
+	if depth > maxExpressionDepth {
+		return nil, fmt.Errorf("nesting exceeds a depth of %d", maxExpressionDepth)
+	}
+
+	if p.consume('-') {
+		operand, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		return expressionNegate{operand: operand}, nil
+	}
+
+	return p.parsePrimary(depth)
+}
+
+func (p *expressionParser) parsePrimary(depth int) (expressionNode, error) {
+	if p.consume('(') {
+		node, err := p.parseSum(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.consume(')') {
+			return nil, fmt.Errorf("missing ')' at position %d", p.pos)
+		}
+
+		return node, nil
+	}
+
+	p.skipSpace()
+
+	start := p.pos
+
+	switch {
+	case p.pos == len(p.source):
+		return nil, errors.New("unexpected end")
+	case isExpressionDigit(p.source[p.pos]) || p.source[p.pos] == '.':
+		for p.pos < len(p.source) && (isExpressionDigit(p.source[p.pos]) || p.source[p.pos] == '.') {
+			p.pos++
+		}
+
+		number, err := strconv.ParseFloat(p.source[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", p.source[start:p.pos], start)
+		}
+
+		return expressionNumber(number), nil
+	case isExpressionLetter(p.source[p.pos]):
+		for p.pos < len(p.source) && isExpressionLetter(p.source[p.pos]) {
+			p.pos++
+		}
+
+		switch identifier := p.source[start:p.pos]; identifier {
+		case "value":
+			return expressionValue{}, nil
+		case "fields":
+			return p.parseFieldIndex()
+		default:
+			return nil, fmt.Errorf("unknown identifier %q at position %d, only value and fields are supported", identifier, start)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", p.source[p.pos], p.pos)
+	}
+}
+
+// parseFieldIndex parses the "[index]" following fields.
+func (p *expressionParser) parseFieldIndex() (expressionNode, error) {
+	if !p.consume('[') {
+		return nil, fmt.Errorf("missing '[' after fields at position %d", p.pos)
+	}
+
+	p.skipSpace()
+
+	start := p.pos
+
+	for p.pos < len(p.source) && isExpressionDigit(p.source[p.pos]) {
+		p.pos++
+	}
+
+	index, err := strconv.ParseUint(p.source[start:p.pos], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid field index at position %d", start)
+	}
+
+	if !p.consume(']') {
+		return nil, fmt.Errorf("missing ']' at position %d", p.pos)
+	}
+
+	return expressionField(index), nil
+}
+
+// consume skips whitespace and reports whether the next character is char, in which case it's consumed.
+func (p *expressionParser) consume(char byte) bool {
+	p.skipSpace()
+
+	if p.pos < len(p.source) && p.source[p.pos] == char {
+		p.pos++
+
+		return true
+	}
+
+	return false
+}
+
+func (p *expressionParser) skipSpace() {
+	for p.pos < len(p.source) && (p.source[p.pos] == ' ' || p.source[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func isExpressionDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
+
+func isExpressionLetter(char byte) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || char == '_'
+}
@@ -0,0 +1,38 @@
+package metric
+
+import "strconv"
+
+// maxHashBuckets bounds the number of precomputed bucket names of a label with hashBuckets.
+const maxHashBuckets = 10000
+
+// labelHashBuckets maps label values to one of a fixed number of buckets by their hash, e.g. value_bucket_3.
+// This bounds the number of series of extreme cardinality labels, while preserving the rough distribution.
+type labelHashBuckets struct {
+	names []string
+}
+
+func newLabelHashBuckets(buckets uint) *labelHashBuckets {
+	names := make([]string, buckets)
+	for i := range names {
+		names[i] = "value_bucket_" + strconv.Itoa(i)
+	}
+
+	return &labelHashBuckets{names: names}
+}
+
+// apply returns the name of the bucket of value. The hash is stable across restarts, so a value always maps
+// to the same bucket. Empty values are kept, so they stay distinguishable from the buckets.
+func (h *labelHashBuckets) apply(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	// FNV-1a, inlined to avoid allocating a hash.Hash32 per value.
+	hash := uint32(2166136261)
+	for i := range len(value) {
+		hash ^= uint32(value[i])
+		hash *= 16777619
+	}
+
+	return h.names[hash%uint32(len(h.names))]
+}
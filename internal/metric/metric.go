@@ -3,39 +3,166 @@ package metric
 import (
 	"errors"
 	"fmt"
+	"math"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
 
 	"github.com/jkroepke/access-log-exporter/internal/config"
+	"github.com/jkroepke/access-log-exporter/internal/config/types"
 	"github.com/jkroepke/access-log-exporter/internal/useragent"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/ua-parser/uap-go/uaparser"
 )
 
+const (
+	// defaultNativeHistogramBucketFactor results in a resolution of roughly 10%, as recommended by the Prometheus client.
+	defaultNativeHistogramBucketFactor = 1.1
+	// defaultNativeHistogramMaxBucketNumber caps the memory usage of a single native histogram.
+	defaultNativeHistogramMaxBucketNumber = 160
+)
+
 //nolint:cyclop
-func New(cfg config.Metric) (*Metric, error) {
+func New(cfg config.Metric, opts ...Option) (*Metric, error) {
 	// Validate metric configuration
 	if cfg.Name == "" {
 		return nil, errors.New("metric name cannot be empty")
 	}
 
-	if cfg.ValueIndex == nil && cfg.Type != "counter" {
+	if !hasValue(cfg) && cfg.RatioIndices == nil && cfg.Type != "counter" {
 		return nil, errors.New("valueIndex must be set for non-counter metrics")
 	}
 
-	labelCount := len(cfg.Labels)
-	if cfg.Upstream.Enabled && cfg.Upstream.Label {
-		labelCount++ // Include upstream label if enabled
+	if len(cfg.Companions) != 0 && !hasValue(cfg) && cfg.RatioIndices == nil {
+		return nil, errors.New("companions require valueIndex or ratioIndices to be set")
+	}
+
+	if cfg.ValueRegexp != nil {
+		if cfg.ValueIndex != nil || cfg.RatioIndices != nil {
+			return nil, errors.New("valueRegexp is mutually exclusive with valueIndex and ratioIndices")
+		}
+
+		if cfg.ValueRegexp.NumSubexp() > 1 {
+			return nil, errors.New("valueRegexp must have at most one capture group")
+		}
+	}
+
+	if cfg.ValueField != "" {
+		return nil, errors.New("valueField requires a preset with format json")
+	}
+
+	for _, label := range cfg.Labels {
+		if label.Field != "" {
+			return nil, fmt.Errorf("label '%s': field requires a preset with format json", label.Name)
+		}
+	}
+
+	if cfg.RatioIndices != nil {
+		if cfg.ValueIndex != nil {
+			return nil, errors.New("valueIndex and ratioIndices are mutually exclusive")
+		}
+
+		if cfg.Upstream.Enabled {
+			return nil, errors.New("ratioIndices can not be combined with upstream")
+		}
+	}
+
+	if cfg.KVField != nil {
+		if cfg.ValueIndex == nil {
+			return nil, errors.New("kvField requires valueIndex to be set")
+		}
+
+		if cfg.KVField.Key == "" {
+			return nil, errors.New("kvField key cannot be empty")
+		}
+	}
+
+	if cfg.ResetThreshold != 0 && cfg.Type != "counter" {
+		return nil, errors.New("resetThreshold can only be used with counter metrics")
+	}
+
+	if cfg.ResetOnCollect && cfg.Type != "counter" && cfg.Type != "histogram" {
+		return nil, errors.New("resetOnCollect can only be used with counter and histogram metrics")
+	}
+
+	if err := validateCountOnly(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := validateGaugeWhen(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := validateNativeHistogram(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := validateBucketOverrides(cfg); err != nil {
+		return nil, err
+	}
+
+	for _, match := range cfg.DropIfLabelMatches {
+		if match.Regexp == nil {
+			return nil, fmt.Errorf("dropIfLabelMatches for label index %d requires a regexp", match.LabelIndex)
+		}
+	}
+
+	if err := validateMathRound(cfg.Math); err != nil {
+		return nil, err
+	}
+
+	for _, companion := range cfg.Companions {
+		if companion.Math == nil {
+			continue
+		}
+
+		if err := validateMathRound(*companion.Math); err != nil {
+			return nil, fmt.Errorf("companion metric %q: %w", companion.Name, err)
+		}
+	}
+
+	if err := validateExemplar(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := validateUnit(cfg); err != nil {
+		return nil, err
+	}
+
+	valueExpression, err := compileValueExpression(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	met := &Metric{now: time.Now, expression: valueExpression}
+
+	for _, opt := range opts {
+		opt(met)
 	}
 
+	// Buckets configured on the metric itself take precedence over the bucket set.
+	if cfg.BucketSet != "" && len(cfg.Buckets) == 0 {
+		buckets, ok := met.bucketSets[cfg.BucketSet]
+		if !ok {
+			return nil, fmt.Errorf("bucket set '%s' not found", cfg.BucketSet)
+		}
+
+		cfg.Buckets = buckets
+	}
+
+	labelCount := labelCount(cfg)
+
 	// Pre-allocate labelKeys with exact capacity
 	labelKeys := make([]string, labelCount)
 
 	var (
 		uaParser         *uaparser.Parser
 		userAgentEnabled bool
+		allowlists       []*labelAllowlist
+		hashBuckets      []*labelHashBuckets
 	)
 
 	for i, label := range cfg.Labels {
@@ -43,8 +170,38 @@ func New(cfg config.Metric) (*Metric, error) {
 			return nil, errors.New("metric label name cannot be empty")
 		}
 
+		switch label.SSL {
+		case "", config.LabelSSLProtocol, config.LabelSSLCipher:
+		default:
+			return nil, fmt.Errorf("label '%s': ssl must be one of protocol or cipher, got '%s'", label.Name, label.SSL)
+		}
+
 		labelKeys[i] = label.Name
 
+		if label.Allowlist != nil {
+			if allowlists == nil {
+				allowlists = make([]*labelAllowlist, len(cfg.Labels))
+			}
+
+			allowlists[i] = newLabelAllowlist(label.Allowlist, label.AllowlistFallback)
+		}
+
+		if label.HashBuckets > 0 {
+			if label.Allowlist != nil {
+				return nil, fmt.Errorf("label '%s': hashBuckets and allowlist are mutually exclusive", label.Name)
+			}
+
+			if label.HashBuckets > maxHashBuckets {
+				return nil, fmt.Errorf("label '%s': hashBuckets must not exceed %d, got %d", label.Name, maxHashBuckets, label.HashBuckets)
+			}
+
+			if hashBuckets == nil {
+				hashBuckets = make([]*labelHashBuckets, len(cfg.Labels))
+			}
+
+			hashBuckets[i] = newLabelHashBuckets(label.HashBuckets)
+		}
+
 		if label.UserAgent {
 			userAgentEnabled = true
 		}
@@ -60,186 +217,916 @@ func New(cfg config.Metric) (*Metric, error) {
 		labelKeys[len(cfg.Labels)] = "upstream"
 	}
 
-	var metric prometheus.Collector
+	// Add upstream status label if configured, always as last label
+	if cfg.Upstream.Enabled && cfg.Upstream.StatusLineIndex != nil {
+		labelKeys[labelCount-1] = "upstream_status"
+	}
 
-	switch cfg.Type {
-	case "counter":
-		metric = prometheus.NewCounterVec(prometheus.CounterOpts{
-			Name:        cfg.Name,
-			Help:        cfg.Help,
+	// The overflow label is only part of the label keys. It's appended to the label values right before
+	// they are observed, so the indices of the other labels stay the same.
+	if cfg.MaxCardinality > 0 {
+		labelKeys = append(labelKeys, overflowLabel)
+	}
+
+	if name, ok := duplicateLabelKey(labelKeys); ok {
+		return nil, fmt.Errorf("duplicate label name %q", name)
+	}
+
+	metric, err := newCollector(cfg.Type, prometheus.Opts{
+		Namespace:   met.namespace,
+		Name:        cfg.Name,
+		Help:        cfg.Help,
+		Unit:        cfg.Unit,
+		ConstLabels: cfg.ConstLabels,
+	}, histogramOpts(cfg), cfg.Objectives, labelKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	companions := make([]prometheus.Collector, 0, len(cfg.Companions))
+
+	for _, companion := range cfg.Companions {
+		if companion.Name == "" {
+			return nil, errors.New("companion metric name cannot be empty")
+		}
+
+		collector, err := newCollector(companion.Type, prometheus.Opts{
+			Namespace:   met.namespace,
+			Name:        companion.Name,
+			Help:        companion.Help,
+			ConstLabels: cfg.ConstLabels,
+		}, prometheus.HistogramOpts{Buckets: companion.Buckets}, companion.Objectives, labelKeys)
+		if err != nil {
+			return nil, fmt.Errorf("companion metric %q: %w", companion.Name, err)
+		}
+
+		companions = append(companions, collector)
+	}
+
+	var gaugeWhen prometheus.Collector
+
+	if cfg.GaugeWhen != nil {
+		gaugeWhen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   met.namespace,
+			Name:        cfg.GaugeWhen.Name,
+			Help:        cfg.GaugeWhen.Help,
 			ConstLabels: cfg.ConstLabels,
 		}, labelKeys)
-	case "gauge":
-		metric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	}
+
+	// Overrides share the name and labels of the metric, so they are only described once by the metric itself.
+	bucketOverrides := make([]prometheus.Collector, len(cfg.BucketOverrides))
+	overrideLabels := make([]int, len(cfg.BucketOverrides))
+
+	for i, override := range cfg.BucketOverrides {
+		overrideLabels[i] = slices.IndexFunc(cfg.Labels, func(label config.Label) bool { return label.LineIndex == override.LineIndex })
+
+		bucketOverrides[i], err = newCollector(cfg.Type, prometheus.Opts{
+			Namespace:   met.namespace,
 			Name:        cfg.Name,
 			Help:        cfg.Help,
+			Unit:        cfg.Unit,
 			ConstLabels: cfg.ConstLabels,
-		}, labelKeys)
+		}, prometheus.HistogramOpts{Buckets: override.Buckets}, nil, labelKeys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	met.cfg = cfg
+	met.metric = metric
+	met.companions = companions
+	met.gaugeWhen = gaugeWhen
+	met.bucketOverrides = bucketOverrides
+	met.overrideLabels = overrideLabels
+	met.ua = uaParser
+	met.allowlists = allowlists
+	met.hashBuckets = hashBuckets
+	met.labelsPool = &sync.Pool{
+		New: func() any {
+			labels := newLabelValues(cfg)
+
+			return &labels
+		},
+	}
+
+	if cfg.QuarantineThreshold > 0 {
+		met.quarantine = newQuarantine(cfg.QuarantineThreshold)
+	}
+
+	if cfg.Upstream.Enabled && cfg.Upstream.ActiveMetric != "" {
+		upstreamLabelKeys := labelKeys[:len(cfg.Labels):len(cfg.Labels)]
+		if cfg.MaxCardinality > 0 {
+			upstreamLabelKeys = append(upstreamLabelKeys, overflowLabel)
+		}
+
+		met.upstreams = newUpstreamTracker(prometheus.BuildFQName(met.namespace, "", cfg.Upstream.ActiveMetric), cfg.ConstLabels, upstreamLabelKeys, cfg.Upstream.ActiveWindow, met.now)
+	}
+
+	if cfg.SeriesTTL > 0 {
+		met.series = newSeriesTracker(cfg.SeriesTTL, met.now)
+	}
+
+	if cfg.MaxCardinality > 0 {
+		met.cardinality = newCardinalityLimit(cfg.MaxCardinality)
+		met.overflowLabels = make([]string, labelCount+1)
+		met.overflowLabels[labelCount] = "true"
+	}
+
+	// Counters without dynamic labels and value always increment the same child,
+	// so resolve it once and bypass the label handling in Parse.
+	if counterVec, ok := metric.(*prometheus.CounterVec); ok && labelCount == 0 && (!hasValue(cfg) || cfg.CountOnly) && met.series == nil && !cfg.ResetOnCollect && cfg.MaxCardinality == 0 {
+		met.counter = counterVec.WithLabelValues()
+	}
+
+	return met, nil
+}
+
+// WithBucketSets sets the named bucket sets a histogram may reference by bucketSet.
+func WithBucketSets(bucketSets map[string]types.Float64Slice) Option {
+	return func(m *Metric) {
+		m.bucketSets = bucketSets
+	}
+}
+
+// WithNamespace prefixes the names of the metric and all of its companion metrics with namespace, e.g. to separate tenants.
+func WithNamespace(namespace string) Option {
+	return func(m *Metric) {
+		m.namespace = namespace
+	}
+}
+
+// WithClock sets the function returning the current time, e.g. to expire series in tests. The default is [time.Now].
+func WithClock(now func() time.Time) Option {
+	return func(m *Metric) {
+		m.now = now
+	}
+}
+
+// WithQuarantineCounter sets a counter that is incremented each time a label set is quarantined.
+func WithQuarantineCounter(counter prometheus.Counter) Option {
+	return func(m *Metric) {
+		m.quarantined = counter
+	}
+}
+
+// WithValueRegexpMismatchCounter sets a counter that is incremented each time a line is skipped
+// because valueRegexp doesn't match.
+func WithValueRegexpMismatchCounter(counter prometheus.Counter) Option {
+	return func(m *Metric) {
+		m.regexpMismatches = counter
+	}
+}
+
+// WithObservationCounter sets a counter that is incremented each time the metric records an observation.
+func WithObservationCounter(counter prometheus.Counter) Option {
+	return func(m *Metric) {
+		m.observed = counter
+	}
+}
+
+// compileValueExpression compiles the valueExpression of the metric, if any.
+func compileValueExpression(cfg config.Metric) (*expression, error) {
+	if cfg.ValueExpression == "" {
+		return nil, nil //nolint:nilnil // no expression configured
+	}
+
+	switch {
+	case !hasValue(cfg) || cfg.CountOnly:
+		return nil, errors.New("valueExpression requires valueIndex or valueRegexp to be set")
+	case cfg.Upstream.Enabled:
+		return nil, errors.New("valueExpression can not be combined with upstream")
+	case cfg.QuarantineThreshold > 0:
+		return nil, errors.New("valueExpression can not be combined with quarantineThreshold")
+	}
+
+	return newExpression(cfg.ValueExpression)
+}
+
+// hasValue reports whether the metric extracts a single value from each line, either by valueIndex or valueRegexp.
+func hasValue(cfg config.Metric) bool {
+	return cfg.ValueIndex != nil || cfg.ValueRegexp != nil
+}
+
+// labelCount returns the number of label values of the metric, including the upstream labels.
+func labelCount(cfg config.Metric) int {
+	count := len(cfg.Labels)
+
+	if cfg.Upstream.Enabled && cfg.Upstream.Label {
+		count++ // Include upstream label if enabled
+	}
+
+	if cfg.Upstream.Enabled && cfg.Upstream.StatusLineIndex != nil {
+		count++ // Include upstream status label if configured
+	}
+
+	return count
+}
+
+// newLabelValues returns a slice for the label values of a line. If maxCardinality is configured,
+// it has spare capacity for the overflow label, see [Metric.limitCardinality].
+func newLabelValues(cfg config.Metric) []string {
+	count := labelCount(cfg)
+
+	if cfg.MaxCardinality > 0 {
+		return make([]string, count, count+1)
+	}
+
+	return make([]string, count)
+}
+
+// duplicateLabelKey returns the first label key that occurs more than once, e.g. a configured label
+// named like the upstream label. Prometheus rejects such label sets, and values would silently collide in [Metric.Trace].
+func duplicateLabelKey(labelKeys []string) (string, bool) {
+	for i, key := range labelKeys {
+		if slices.Contains(labelKeys[:i], key) {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+// histogramOpts returns the bucket layout of a histogram metric. Native histograms ignore the configured buckets.
+func histogramOpts(cfg config.Metric) prometheus.HistogramOpts {
+	if !cfg.NativeHistogram {
+		return prometheus.HistogramOpts{Buckets: cfg.Buckets}
+	}
+
+	opts := prometheus.HistogramOpts{
+		NativeHistogramBucketFactor:    defaultNativeHistogramBucketFactor,
+		NativeHistogramMaxBucketNumber: defaultNativeHistogramMaxBucketNumber,
+	}
+
+	if cfg.NativeHistogramBucketFactor != 0 {
+		opts.NativeHistogramBucketFactor = cfg.NativeHistogramBucketFactor
+	}
+
+	if cfg.NativeHistogramMaxBucketNumber != 0 {
+		opts.NativeHistogramMaxBucketNumber = cfg.NativeHistogramMaxBucketNumber
+	}
+
+	return opts
+}
+
+// newCollector creates the vector matching metricType with the given options and label keys.
+// Only the bucket options of histogramOpts are used.
+func newCollector(metricType string, opts prometheus.Opts, histogramOpts prometheus.HistogramOpts, objectives map[float64]float64, labelKeys []string) (prometheus.Collector, error) {
+	switch metricType {
+	case "counter":
+		return prometheus.NewCounterVec(prometheus.CounterOpts(opts), labelKeys), nil
+	case "gauge":
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts(opts), labelKeys), nil
 	case "histogram":
-		buckets := cfg.Buckets
-		if len(buckets) == 0 {
-			buckets = prometheus.DefBuckets
+		// Native histograms without buckets don't expose classic buckets at all.
+		if len(histogramOpts.Buckets) == 0 && histogramOpts.NativeHistogramBucketFactor <= 1 {
+			histogramOpts.Buckets = prometheus.DefBuckets
+		}
+
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:                      opts.Namespace,
+			Subsystem:                      opts.Subsystem,
+			Name:                           opts.Name,
+			Help:                           opts.Help,
+			Unit:                           opts.Unit,
+			ConstLabels:                    opts.ConstLabels,
+			Buckets:                        histogramOpts.Buckets,
+			NativeHistogramBucketFactor:    histogramOpts.NativeHistogramBucketFactor,
+			NativeHistogramMaxBucketNumber: histogramOpts.NativeHistogramMaxBucketNumber,
+		}, labelKeys), nil
+	case "summary":
+		return prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   opts.Subsystem,
+			Name:        opts.Name,
+			Help:        opts.Help,
+			Unit:        opts.Unit,
+			ConstLabels: opts.ConstLabels,
+			Objectives:  objectives,
+		}, labelKeys), nil
+	default:
+		return nil, fmt.Errorf("unsupported metric type: %q. Must be one of counter, gauge, histogram, or summary", metricType)
+	}
+}
+
+// validateCountOnly ensures countOnly is only used for counters that don't need a value.
+func validateCountOnly(cfg config.Metric) error {
+	if !cfg.CountOnly {
+		return nil
+	}
+
+	switch {
+	case cfg.Type != "counter":
+		return errors.New("countOnly can only be used with counter metrics")
+	case cfg.RatioIndices != nil:
+		return errors.New("countOnly can not be combined with ratioIndices")
+	case cfg.Upstream.Enabled:
+		return errors.New("countOnly can not be combined with upstream")
+	case len(cfg.Companions) != 0:
+		return errors.New("countOnly can not be combined with companions")
+	}
+
+	return nil
+}
+
+// validateGaugeWhen ensures gaugeWhen is only used for histograms with a value and a separate gauge name.
+func validateGaugeWhen(cfg config.Metric) error {
+	if cfg.GaugeWhen == nil {
+		return nil
+	}
+
+	switch {
+	case cfg.Type != "histogram":
+		return errors.New("gaugeWhen can only be used with histogram metrics")
+	case cfg.GaugeWhen.Name == "":
+		return errors.New("gaugeWhen name cannot be empty")
+	case cfg.GaugeWhen.Name == cfg.Name:
+		return errors.New("gaugeWhen name must differ from the metric name")
+	case len(cfg.GaugeWhen.Values) == 0:
+		return errors.New("gaugeWhen values cannot be empty")
+	case cfg.Upstream.Enabled:
+		return errors.New("gaugeWhen can not be combined with upstream")
+	}
+
+	return nil
+}
+
+// validateBucketOverrides ensures bucketOverrides are only used for classic histograms.
+// Each override must select by a field which is also a label, otherwise the same series
+// could be observed by histograms of different bucket schemes and collide on collection.
+func validateBucketOverrides(cfg config.Metric) error {
+	if len(cfg.BucketOverrides) == 0 {
+		return nil
+	}
+
+	switch {
+	case cfg.Type != "histogram":
+		return errors.New("bucketOverrides can only be used with histogram metrics")
+	case cfg.NativeHistogram:
+		return errors.New("bucketOverrides can not be combined with nativeHistogram")
+	case cfg.Upstream.Enabled:
+		return errors.New("bucketOverrides can not be combined with upstream")
+	}
+
+	for _, override := range cfg.BucketOverrides {
+		switch {
+		case len(override.Values) == 0:
+			return errors.New("bucketOverrides values cannot be empty")
+		case len(override.Buckets) == 0:
+			return errors.New("bucketOverrides buckets cannot be empty")
+		case !slices.ContainsFunc(cfg.Labels, func(label config.Label) bool { return label.LineIndex == override.LineIndex }):
+			return fmt.Errorf("bucketOverrides lineIndex %d must also be used by a label", override.LineIndex)
+		}
+	}
+
+	return nil
+}
+
+// validateNativeHistogram ensures nativeHistogram is only used for histograms with a valid bucket factor.
+func validateNativeHistogram(cfg config.Metric) error {
+	if !cfg.NativeHistogram {
+		if cfg.NativeHistogramBucketFactor != 0 || cfg.NativeHistogramMaxBucketNumber != 0 {
+			return errors.New("nativeHistogramBucketFactor and nativeHistogramMaxBucketNumber require nativeHistogram to be enabled")
+		}
+
+		return nil
+	}
+
+	switch {
+	case cfg.Type != "histogram":
+		return errors.New("nativeHistogram can only be used with histogram metrics")
+	case cfg.NativeHistogramBucketFactor != 0 && cfg.NativeHistogramBucketFactor <= 1:
+		return fmt.Errorf("nativeHistogramBucketFactor must be greater than 1, got %v", cfg.NativeHistogramBucketFactor)
+	}
+
+	return nil
+}
+
+// validateUnit ensures the metric name follows the Prometheus naming convention of ending with the unit,
+// followed by the "_total" suffix for counters.
+func validateUnit(cfg config.Metric) error {
+	if cfg.Unit == "" {
+		return nil
+	}
+
+	name := cfg.Name
+	if cfg.Type == "counter" {
+		name = strings.TrimSuffix(name, "_total")
+	}
+
+	if !strings.HasSuffix(name, "_"+cfg.Unit) {
+		return fmt.Errorf("metric name %q must end with the unit suffix %q", cfg.Name, "_"+cfg.Unit)
+	}
+
+	return nil
+}
+
+func (m *Metric) Describe(ch chan<- *prometheus.Desc) {
+	if m.metric != nil {
+		m.metric.Describe(ch)
+	}
+
+	for _, companion := range m.companions {
+		companion.Describe(ch)
+	}
+
+	if m.gaugeWhen != nil {
+		m.gaugeWhen.Describe(ch)
+	}
+
+	if m.upstreams != nil {
+		m.upstreams.gauge.Describe(ch)
+	}
+}
+
+func (m *Metric) Collect(ch chan<- prometheus.Metric) {
+	if m.series != nil {
+		m.series.expire(m.deleteSeries)
+	}
+
+	// Block Parse until the series are reset, so no observation between collecting and resetting gets lost.
+	if m.cfg.ResetOnCollect {
+		m.collectMu.Lock()
+		defer m.collectMu.Unlock()
+		defer m.resetSeries()
+	}
+
+	if m.metric != nil {
+		m.metric.Collect(ch)
+	}
+
+	for _, companion := range m.companions {
+		companion.Collect(ch)
+	}
+
+	if m.gaugeWhen != nil {
+		m.gaugeWhen.Collect(ch)
+	}
+
+	for _, override := range m.bucketOverrides {
+		override.Collect(ch)
+	}
+
+	if m.upstreams != nil {
+		m.upstreams.expire()
+		m.upstreams.gauge.Collect(ch)
+	}
+}
+
+func (m *Metric) Name() string {
+	return m.cfg.Name
+}
+
+// Parse processes a single line of input, extracting labels and values based on the metric configuration.
+// It's guaranteed to be thread-safe and can be called concurrently.
+func (m *Metric) Parse(line []string) error {
+	// Dropped lines are checked first, so they don't cost more than the regexp matches.
+	drop, err := m.shouldDrop(line)
+	if err != nil || drop {
+		return err
+	}
+
+	if m.cfg.ResetOnCollect {
+		m.collectMu.RLock()
+		defer m.collectMu.RUnlock()
+	}
+
+	// Validate and extract value from line
+	value, skip, err := m.validateAndExtractValue(line)
+	if err != nil {
+		return err
+	}
+
+	if skip {
+		return nil // Skip processing for empty/invalid lines
+	}
+
+	// Fast path for counters without dynamic labels and value
+	if m.counter != nil {
+		m.counter.Inc()
+		m.recordObservation()
+
+		return nil
+	}
+
+	// Get label values from pool and ensure cleanup
+	labelsPtr := m.getLabelsFromPool()
+
+	labels := *labelsPtr
+	defer m.returnLabelsToPool(labelsPtr)
+
+	// Process all labels from the line
+	if err := m.processLabels(line, labels); err != nil {
+		return err
+	}
+
+	// Handle metric value setting based on configuration
+	return m.handleMetricValue(line, value, labels)
+}
+
+// shouldDrop reports whether any dropIfLabelMatches rule matches the line, e.g. for health checks.
+func (m *Metric) shouldDrop(line []string) (bool, error) {
+	lineLength := uint(len(line))
+
+	for _, match := range m.cfg.DropIfLabelMatches {
+		if match.LabelIndex >= lineLength {
+			return false, fmt.Errorf("line index out of range for dropIfLabelMatches index %d, line length is %d", match.LabelIndex, lineLength)
+		}
+
+		if match.Regexp.MatchString(line[match.LabelIndex]) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// validateAndExtractValue validates the input line and extracts the metric value if configured.
+// Returns the value string, whether to skip processing, and any validation errors.
+func (m *Metric) validateAndExtractValue(line []string) (string, bool, error) {
+	lineLength := uint(len(line))
+
+	if lineLength == 0 {
+		return "", true, nil // Signal to skip processing
+	}
+
+	// BCE (Bound Check Elimination)
+	// https://go101.org/optimizations/5-bce.html
+	_ = line[lineLength-1]
+
+	// Skip lines where the required field is empty, by default the first one
+	var requiredIndex uint
+	if m.cfg.RequireNonEmptyIndex != nil {
+		requiredIndex = *m.cfg.RequireNonEmptyIndex
+	}
+
+	if requiredIndex >= lineLength {
+		return "", false, fmt.Errorf("line index out of range for required non-empty index %d, line length is %d", requiredIndex, lineLength)
+	}
+
+	if line[requiredIndex] == "" {
+		return "", true, nil // Signal to skip processing
+	}
+
+	// If no value is configured or it's ignored, this is a counter-only metric
+	if !hasValue(m.cfg) || m.cfg.CountOnly {
+		return "", false, nil
+	}
+
+	if m.cfg.ValueRegexp != nil {
+		return m.extractRegexpValue(line)
+	}
+
+	// Validate value index bounds
+	if *m.cfg.ValueIndex >= lineLength {
+		return "", false, fmt.Errorf("line index out of range for value index %d, line length is %d", *m.cfg.ValueIndex, lineLength)
+	}
+
+	value := line[*m.cfg.ValueIndex]
+
+	if m.cfg.KVField != nil {
+		value = extractKVValue(*m.cfg.KVField, value)
+	}
+
+	if value == "" || value == "-" {
+		return "", true, nil // Signal to skip processing
+	}
+
+	if m.cfg.Replacements != nil {
+		value = m.valueReplacements(m.cfg.Replacements, value)
+	}
+
+	return value, false, nil
+}
+
+// extractRegexpValue extracts the value from the whole line, joined by tabs, using valueRegexp.
+// The value is the capture group, or the whole match if there is none, of the valueRegexpMatch-th match.
+// Lines without such a match are skipped and counted.
+func (m *Metric) extractRegexpValue(line []string) (string, bool, error) {
+	matchIndex := int(m.cfg.ValueRegexpMatch)
+
+	matches := m.cfg.ValueRegexp.FindAllStringSubmatch(strings.Join(line, "\t"), matchIndex+1)
+	if len(matches) <= matchIndex {
+		if m.regexpMismatches != nil {
+			m.regexpMismatches.Inc()
+		}
+
+		return "", true, nil // Signal to skip processing
+	}
+
+	value := matches[matchIndex][len(matches[matchIndex])-1]
+	if value == "" || value == "-" {
+		return "", true, nil // Signal to skip processing
+	}
+
+	if m.cfg.Replacements != nil {
+		value = m.valueReplacements(m.cfg.Replacements, value)
+	}
+
+	return value, false, nil
+}
+
+// extractKVValue returns the value of the configured key from a field containing key-value pairs.
+// An empty string is returned if the key is not present.
+func extractKVValue(kvField config.KVField, field string) string {
+	separator := kvField.Separator
+	if separator == "" {
+		separator = "="
+	}
+
+	pairSeparator := kvField.PairSeparator
+	if pairSeparator == "" {
+		pairSeparator = ";"
+	}
+
+	for field != "" {
+		var pair string
+
+		pair, field, _ = strings.Cut(field, pairSeparator)
+
+		key, value, found := strings.Cut(strings.TrimSpace(pair), separator)
+		if found && key == kvField.Key {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// getLabelsFromPool retrieves label values from the sync.Pool for thread-safe reuse.
+func (m *Metric) getLabelsFromPool() *[]string {
+	labels, ok := m.labelsPool.Get().(*[]string)
+	if !ok {
+		labelValues := newLabelValues(m.cfg)
+		labels = &labelValues
+	}
+
+	return labels
+}
+
+// returnLabelsToPool clears label values and returns them to the pool for reuse.
+func (m *Metric) returnLabelsToPool(labelsPtr *[]string) {
+	labels := *labelsPtr
+	for i := range labels {
+		labels[i] = ""
+	}
+
+	m.labelsPool.Put(labelsPtr)
+}
+
+// processLabels extracts and processes all configured labels from the log line.
+func (m *Metric) processLabels(line, labels []string) error {
+	lineLength := uint(len(line))
+
+	for i, label := range m.cfg.Labels {
+		if label.LineIndex >= lineLength {
+			return fmt.Errorf("line index out of range for label %s, line length is %d", label.Name, lineLength)
+		}
+
+		labelValue := line[label.LineIndex]
+
+		if label.TrimQuotes {
+			labelValue = trimQuotes(labelValue)
+		}
+
+		if label.StripControl {
+			labelValue = stripControl(labelValue)
+		}
+
+		if label.Header {
+			labelValue = normalizeHeader(labelValue)
+		}
+
+		if label.SSL != "" {
+			labelValue = splitSSL(labelValue, label.SSL)
+		}
+
+		if label.ProtocolNormalize {
+			labelValue = normalizeProtocol(labelValue)
+		}
+
+		if label.CollapseWhitespace {
+			labelValue = collapseWhitespace(labelValue)
+		}
+
+		if label.FirstSegment {
+			labelValue = firstPathSegment(labelValue)
+		}
+
+		// Apply user agent parsing if configured
+		if label.UserAgent {
+			uaInfo := m.ua.Parse(labelValue)
+			labelValue = uaInfo.UserAgent.Family
+		}
+
+		if label.Ranges != nil {
+			labelValue = labelRange(label.Ranges, labelValue)
+		}
+
+		// Apply regex replacements if configured
+		labelValue = m.valueReplacements(label.Replacements, labelValue)
+
+		// The allowlist applies last, so it can refer to the replaced values.
+		if m.allowlists != nil && m.allowlists[i] != nil {
+			labelValue = m.allowlists[i].apply(labelValue)
+		}
+
+		if m.hashBuckets != nil && m.hashBuckets[i] != nil {
+			labelValue = m.hashBuckets[i].apply(labelValue)
 		}
 
-		metric = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-			Name:        cfg.Name,
-			Help:        cfg.Help,
-			ConstLabels: cfg.ConstLabels,
-			Buckets:     buckets,
-		}, labelKeys)
-	default:
-		return nil, fmt.Errorf("unsupported metric type: %q. Must be one of counter, gauge, or histogram", cfg.Type)
+		labels[i] = labelValue
 	}
 
-	return &Metric{
-		cfg:    cfg,
-		metric: metric,
-		ua:     uaParser,
-		labelsPool: &sync.Pool{
-			New: func() any {
-				labels := make([]string, labelCount)
+	return nil
+}
+
+// defaultAllowlistFallback is the label value of values not in the allowlist, unless allowlistFallback is set.
+const defaultAllowlistFallback = "other"
 
-				return &labels
-			},
-		},
-	}, nil
+// labelAllowlist collapses all label values not in the allowlist into a single fallback value.
+type labelAllowlist struct {
+	values   map[string]struct{}
+	fallback string
 }
 
-func (m *Metric) Describe(ch chan<- *prometheus.Desc) {
-	if m.metric != nil {
-		m.metric.Describe(ch)
+func newLabelAllowlist(values []string, fallback string) *labelAllowlist {
+	if fallback == "" {
+		fallback = defaultAllowlistFallback
 	}
-}
 
-func (m *Metric) Collect(ch chan<- prometheus.Metric) {
-	if m.metric != nil {
-		m.metric.Collect(ch)
+	allowlist := &labelAllowlist{
+		values:   make(map[string]struct{}, len(values)),
+		fallback: fallback,
+	}
+
+	for _, value := range values {
+		allowlist.values[value] = struct{}{}
 	}
+
+	return allowlist
 }
 
-func (m *Metric) Name() string {
-	return m.cfg.Name
+// apply returns the value if it's in the allowlist, otherwise the fallback.
+func (a *labelAllowlist) apply(value string) string {
+	if _, ok := a.values[value]; ok {
+		return value
+	}
+
+	return a.fallback
 }
 
-// Parse processes a single line of input, extracting labels and values based on the metric configuration.
-// It's guaranteed to be thread-safe and can be called concurrently.
-func (m *Metric) Parse(line []string) error {
-	// Validate and extract value from line
-	value, skip, err := m.validateAndExtractValue(line)
+// labelRange returns the value of the first range whose max is not exceeded by the numeric value.
+// Non-numeric values and values above all ranges result in an empty label value.
+func labelRange(ranges []config.LabelRange, value string) string {
+	number, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		return err
+		return ""
 	}
 
-	if skip {
-		return nil // Skip processing for empty/invalid lines
+	for _, r := range ranges {
+		if number <= r.Max {
+			return r.Value
+		}
 	}
 
-	// Get label values from pool and ensure cleanup
-	labelsPtr := m.getLabelsFromPool()
+	return ""
+}
 
-	labels := *labelsPtr
-	defer m.returnLabelsToPool(labelsPtr)
+// trimQuotes removes a single pair of matching surrounding double or single quotes.
+func trimQuotes(value string) string {
+	if len(value) < 2 {
+		return value
+	}
 
-	// Process all labels from the line
-	if err := m.processLabels(line, labels); err != nil {
-		return err
+	if quote := value[0]; (quote == '"' || quote == '\'') && value[len(value)-1] == quote {
+		return value[1 : len(value)-1]
 	}
 
-	// Handle metric value setting based on configuration
-	return m.handleMetricValue(line, value, labels)
+	return value
 }
 
-// validateAndExtractValue validates the input line and extracts the metric value if configured.
-// Returns the value string, whether to skip processing, and any validation errors.
-func (m *Metric) validateAndExtractValue(line []string) (string, bool, error) {
-	lineLength := uint(len(line))
-
-	if lineLength == 0 || line[0] == "" {
-		return "", true, nil // Signal to skip processing
+// normalizeHeader normalizes a logged HTTP header value. Surrounding whitespace is trimmed,
+// inner whitespace collapsed and the value lowercased. A missing header ("-") results in an empty value.
+func normalizeHeader(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "-" {
+		return ""
 	}
 
-	// BCE (Bound Check Elimination)
-	// https://go101.org/optimizations/5-bce.html
-	_ = line[lineLength-1]
+	return strings.ToLower(collapseWhitespace(value))
+}
 
-	// If no value index is configured, this is a counter-only metric
-	if m.cfg.ValueIndex == nil {
-		return "", false, nil
+// normalizeProtocol reduces an HTTP protocol like HTTP/1.1 or HTTP/2.0 to its version, e.g. 1.1 or 2.
+// HTTP/2 and later have no minor versions, so a trailing ".0" is dropped. Other values are returned unchanged.
+func normalizeProtocol(value string) string {
+	version, ok := strings.CutPrefix(value, "HTTP/")
+	if !ok {
+		return value
 	}
 
-	// Validate value index bounds
-	if *m.cfg.ValueIndex >= lineLength {
-		return "", false, fmt.Errorf("line index out of range for value index %d, line length is %d", *m.cfg.ValueIndex, lineLength)
+	if major, ok := strings.CutSuffix(version, ".0"); ok && major != "0" && major != "1" {
+		return major
 	}
 
-	value := line[*m.cfg.ValueIndex]
-	if value == "" || value == "-" {
-		return "", true, nil // Signal to skip processing
+	return version
+}
+
+// firstPathSegment returns the first segment of a path, ignoring the query string, e.g. api for /api/users/5?page=2.
+// The root path results in "/". Values not starting with a slash, like "-", are returned unchanged.
+func firstPathSegment(value string) string {
+	path, ok := strings.CutPrefix(value, "/")
+	if !ok {
+		return value
 	}
 
-	if m.cfg.Replacements != nil {
-		value = m.valueReplacements(m.cfg.Replacements, value)
+	path, _, _ = strings.Cut(path, "?")
+	path = strings.TrimLeft(path, "/")
+
+	segment, _, _ := strings.Cut(path, "/")
+	if segment == "" {
+		return "/"
 	}
 
-	return value, false, nil
+	return segment
 }
 
-// getLabelsFromPool retrieves label values from the sync.Pool for thread-safe reuse.
-func (m *Metric) getLabelsFromPool() *[]string {
-	labels, ok := m.labelsPool.Get().(*[]string)
+// splitSSL returns the protocol or cipher of a combined "$ssl_protocol/$ssl_cipher" field,
+// e.g. TLSv1.3 or TLS_AES_256_GCM_SHA384. Values without a slash, like "-" for plain HTTP, are returned unchanged.
+func splitSSL(value, part string) string {
+	protocol, cipher, ok := strings.Cut(value, "/")
 	if !ok {
-		labelCount := len(m.cfg.Labels)
-		if m.cfg.Upstream.Enabled && m.cfg.Upstream.Label {
-			labelCount++
-		}
+		return value
+	}
 
-		labelValues := make([]string, labelCount)
-		labels = &labelValues
+	if part == config.LabelSSLCipher {
+		return cipher
 	}
 
-	return labels
+	return protocol
 }
 
-// returnLabelsToPool clears label values and returns them to the pool for reuse.
-func (m *Metric) returnLabelsToPool(labelsPtr *[]string) {
-	labels := *labelsPtr
-	for i := range labels {
-		labels[i] = ""
+// collapseWhitespace replaces runs of whitespace with a single space.
+func collapseWhitespace(value string) string {
+	if !hasCollapsibleWhitespace(value) {
+		return value
 	}
 
-	m.labelsPool.Put(labelsPtr)
-}
+	var builder strings.Builder
 
-// processLabels extracts and processes all configured labels from the log line.
-func (m *Metric) processLabels(line, labels []string) error {
-	lineLength := uint(len(line))
+	builder.Grow(len(value))
 
-	for i, label := range m.cfg.Labels {
-		if label.LineIndex >= lineLength {
-			return fmt.Errorf("line index out of range for label %s, line length is %d", label.Name, lineLength)
-		}
+	inSpace := false
 
-		labelValue := line[label.LineIndex]
+	for _, r := range value {
+		if unicode.IsSpace(r) {
+			if !inSpace {
+				builder.WriteByte(' ')
+			}
 
-		// Apply user agent parsing if configured
-		if label.UserAgent {
-			uaInfo := m.ua.Parse(labelValue)
-			labelValue = uaInfo.UserAgent.Family
+			inSpace = true
+
+			continue
 		}
 
-		// Apply regex replacements if configured
-		labelValue = m.valueReplacements(label.Replacements, labelValue)
+		inSpace = false
 
-		labels[i] = labelValue
+		builder.WriteRune(r)
 	}
 
-	return nil
+	return builder.String()
+}
+
+// hasCollapsibleWhitespace reports whether value contains runs of whitespace or whitespace other than a space.
+func hasCollapsibleWhitespace(value string) bool {
+	inSpace := false
+
+	for _, r := range value {
+		isSpace := unicode.IsSpace(r)
+		if isSpace && (inSpace || r != ' ') {
+			return true
+		}
+
+		inSpace = isSpace
+	}
+
+	return false
 }
 
 // handleMetricValue handles setting the metric value based on the configuration type.
 func (m *Metric) handleMetricValue(line []string, value string, labels []string) error {
+	// Handle ratio of two fields
+	if m.cfg.RatioIndices != nil {
+		collector, err := m.observationCollector(line, labels)
+		if err != nil {
+			return err
+		}
+
+		return m.handleRatio(line, collector, labels, m.exemplar(line))
+	}
+
 	// Handle counter without value (increment by 1)
-	if m.cfg.ValueIndex == nil {
+	if !hasValue(m.cfg) || m.cfg.CountOnly {
 		return m.handleCounterIncrement(labels)
 	}
 
@@ -250,17 +1137,133 @@ func (m *Metric) handleMetricValue(line []string, value string, labels []string)
 
 	// Handle upstream processing if enabled
 	if m.cfg.Upstream.Enabled {
-		return m.setMetricWithUpstream(line, uint(len(line)), value, labels)
+		return m.setMetricWithUpstream(line, uint(len(line)), value, labels, m.exemplar(line))
+	}
+
+	collector, err := m.observationCollector(line, labels)
+	if err != nil {
+		return err
+	}
+
+	if m.expression != nil {
+		return m.handleExpression(line, collector, value, labels, m.exemplar(line))
 	}
 
 	// Handle standard metric setting
-	if err := m.setMetric(value, labels); err != nil {
+	if err := m.setMetric(collector, value, labels, m.exemplar(line)); err != nil {
 		return fmt.Errorf("failed to set metric %s with value %q: %w", m.cfg.Name, value, err)
 	}
 
 	return nil
 }
 
+// handleExpression sets the metric to the result of the valueExpression, evaluated for the value and the fields of the line.
+// Math transformations apply to the result.
+func (m *Metric) handleExpression(line []string, collector prometheus.Collector, value string, labels []string, exemplar prometheus.Labels) error {
+	result, skip, err := m.evalExpression(line, value)
+	if err != nil || skip {
+		return err
+	}
+
+	return m.setMetricValue(collector, result, labels, exemplar)
+}
+
+// evalExpression parses the value and evaluates the valueExpression. Empty values are skipped like in [Metric.setMetric].
+func (m *Metric) evalExpression(line []string, value string) (float64, bool, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, true, nil
+	}
+
+	valueFloat, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse value %q: %w", value, err)
+	}
+
+	result, err := m.expression.eval(valueFloat, line)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to evaluate value expression of metric %s: %w", m.cfg.Name, err)
+	}
+
+	return result, false, nil
+}
+
+// handleRatio sets the metric to the quotient of the two fields configured by ratioIndices.
+func (m *Metric) handleRatio(line []string, collector prometheus.Collector, labels []string, exemplar prometheus.Labels) error {
+	ratio, skip, err := m.extractRatio(line)
+	if err != nil || skip {
+		return err
+	}
+
+	return m.setMetricValue(collector, ratio, labels, exemplar)
+}
+
+// observationCollector returns the collector the value of line is recorded in.
+// This is the gauge configured by gaugeWhen if the switch field of line matches one of its values,
+// the histogram of the first bucketOverrides entry matching the label values, otherwise the metric itself.
+func (m *Metric) observationCollector(line, labels []string) (prometheus.Collector, error) {
+	if m.gaugeWhen == nil && len(m.bucketOverrides) == 0 {
+		return m.metric, nil
+	}
+
+	if m.gaugeWhen != nil {
+		lineLength := uint(len(line))
+		if m.cfg.GaugeWhen.LineIndex >= lineLength {
+			return nil, fmt.Errorf("line index out of range for gaugeWhen index %d, line length is %d", m.cfg.GaugeWhen.LineIndex, lineLength)
+		}
+
+		if slices.Contains(m.cfg.GaugeWhen.Values, strings.TrimSpace(line[m.cfg.GaugeWhen.LineIndex])) {
+			return m.gaugeWhen, nil
+		}
+	}
+
+	// Overrides compare the label value instead of the field, since label transformations like ranges
+	// may merge different field values into one series, which must only exist in one of the histograms.
+	// The first matching override wins.
+	for i, override := range m.cfg.BucketOverrides {
+		if slices.Contains(override.Values, labels[m.overrideLabels[i]]) {
+			return m.bucketOverrides[i], nil
+		}
+	}
+
+	return m.metric, nil
+}
+
+// extractRatio computes the quotient of the two fields configured by ratioIndices.
+// Lines with an empty or zero denominator are skipped to avoid division by zero.
+func (m *Metric) extractRatio(line []string) (float64, bool, error) {
+	lineLength := uint(len(line))
+
+	for _, index := range m.cfg.RatioIndices {
+		if index >= lineLength {
+			return 0, false, fmt.Errorf("line index out of range for ratio index %d, line length is %d", index, lineLength)
+		}
+	}
+
+	numerator := strings.TrimSpace(line[m.cfg.RatioIndices[0]])
+	denominator := strings.TrimSpace(line[m.cfg.RatioIndices[1]])
+
+	if numerator == "" || numerator == "-" || denominator == "" || denominator == "-" {
+		return 0, true, nil
+	}
+
+	numeratorFloat, err := strconv.ParseFloat(numerator, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse ratio numerator %q: %w", numerator, err)
+	}
+
+	denominatorFloat, err := strconv.ParseFloat(denominator, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse ratio denominator %q: %w", denominator, err)
+	}
+
+	if denominatorFloat == 0 {
+		return 0, true, nil
+	}
+
+	return numeratorFloat / denominatorFloat, false, nil
+}
+
 // handleCounterIncrement handles counter metrics that increment by 1 (no value configured).
 func (m *Metric) handleCounterIncrement(labels []string) error {
 	counterVec, ok := m.metric.(*prometheus.CounterVec)
@@ -269,11 +1272,29 @@ func (m *Metric) handleCounterIncrement(labels []string) error {
 		return errors.New("valueIndex is nil but metric type is not counter")
 	}
 
+	labels = m.limitCardinality(labels)
+
 	counterVec.WithLabelValues(labels...).Inc()
+	m.recordObservation()
+	m.touchSeries(labels)
 
 	return nil
 }
 
+// touchSeries records an observation of the label set, if seriesTTL is configured.
+func (m *Metric) touchSeries(labels []string) {
+	if m.series != nil {
+		m.series.touch(labels)
+	}
+}
+
+// recordObservation increments the observation counter, if configured.
+func (m *Metric) recordObservation() {
+	if m.observed != nil {
+		m.observed.Inc()
+	}
+}
+
 // setMetricWithUpstream processes comma-separated metric values with corresponding upstream servers.
 //
 // This function handles the upstream feature where multiple metric values can be associated
@@ -297,19 +1318,25 @@ func (m *Metric) handleCounterIncrement(labels []string) error {
 //   - Maps values to upstream servers (reuses last upstream if fewer upstreams than values)
 //   - Skips values associated with excluded upstream servers
 //   - Adds "upstream" label when upstream labeling is enabled
-func (m *Metric) setMetricWithUpstream(line []string, lineLength uint, value string, labels []string) error {
+//   - Adds "upstream_status" label when an upstream status index is configured
+func (m *Metric) setMetricWithUpstream(line []string, lineLength uint, value string, labels []string, exemplar prometheus.Labels) error {
 	upstreams, err := m.parseUpstreams(line, lineLength)
 	if err != nil {
 		return err
 	}
 
-	return m.processCommaDelimitedValues(value, upstreams, labels)
+	statuses, err := m.parseUpstreamStatuses(line, lineLength)
+	if err != nil {
+		return err
+	}
+
+	return m.processCommaDelimitedValues(value, upstreams, statuses, labels, exemplar)
 }
 
 // parseUpstreams extracts and processes upstream server addresses from the log line.
 func (m *Metric) parseUpstreams(line []string, lineLength uint) ([]string, error) {
-	// Only parse upstreams if we need them for excludes or labels
-	if len(m.cfg.Upstream.Excludes) == 0 && !m.cfg.Upstream.Label {
+	// Only parse upstreams if we need them for excludes, labels or counting active upstreams
+	if len(m.cfg.Upstream.Excludes) == 0 && !m.cfg.Upstream.Label && m.upstreams == nil {
 		return nil, nil
 	}
 
@@ -327,15 +1354,35 @@ func (m *Metric) parseUpstreams(line []string, lineLength uint) ([]string, error
 	return upstreams, nil
 }
 
+// parseUpstreamStatuses extracts the upstream status codes from the log line, if configured.
+func (m *Metric) parseUpstreamStatuses(line []string, lineLength uint) ([]string, error) {
+	if m.cfg.Upstream.StatusLineIndex == nil {
+		return nil, nil
+	}
+
+	if *m.cfg.Upstream.StatusLineIndex >= lineLength {
+		return nil, fmt.Errorf("line index out of range for upstream status index %d, line length is %d", *m.cfg.Upstream.StatusLineIndex, lineLength)
+	}
+
+	statuses := strings.Split(line[*m.cfg.Upstream.StatusLineIndex], ",")
+
+	// Trim whitespace from statuses
+	for i, status := range statuses {
+		statuses[i] = strings.TrimSpace(status)
+	}
+
+	return statuses, nil
+}
+
 // processCommaDelimitedValues processes comma-separated metric values with upstream mapping.
-func (m *Metric) processCommaDelimitedValues(value string, upstreams, labels []string) error {
+func (m *Metric) processCommaDelimitedValues(value string, upstreams, statuses, labels []string, exemplar prometheus.Labels) error {
 	valueIndex := 0
 
 	for {
 		valueElement, remaining := m.extractNextValue(value)
 
 		if valueElement != "-" {
-			if err := m.processValueWithUpstream(valueElement, upstreams, valueIndex, labels); err != nil {
+			if err := m.processValueWithUpstream(valueElement, upstreams, statuses, valueIndex, labels, exemplar); err != nil {
 				return err
 			}
 		}
@@ -363,9 +1410,14 @@ func (m *Metric) extractNextValue(value string) (string, string) {
 }
 
 // processValueWithUpstream processes a single metric value with its associated upstream.
-func (m *Metric) processValueWithUpstream(valueElement string, upstreams []string, valueIndex int, labels []string) error {
+func (m *Metric) processValueWithUpstream(valueElement string, upstreams, statuses []string, valueIndex int, labels []string, exemplar prometheus.Labels) error {
+	// Add upstream status label if configured
+	if len(statuses) != 0 {
+		labels[len(labels)-1] = m.getUpstreamForValue(statuses, valueIndex)
+	}
+
 	if len(upstreams) == 0 {
-		return m.setMetric(valueElement, labels)
+		return m.setMetric(m.metric, valueElement, labels, exemplar)
 	}
 
 	upstream := m.getUpstreamForValue(upstreams, valueIndex)
@@ -380,11 +1432,28 @@ func (m *Metric) processValueWithUpstream(valueElement string, upstreams []strin
 		labels[len(m.cfg.Labels)] = upstream
 	}
 
-	return m.setMetric(valueElement, labels)
+	if m.upstreams != nil {
+		// The gauge shares the cardinality limit of the metric, so the label set is admitted like in setMetric.
+		m.upstreams.observe(m.upstreamLabels(m.limitCardinality(labels)), upstream)
+	}
+
+	return m.setMetric(m.metric, valueElement, labels, exemplar)
+}
+
+// upstreamLabels returns the label values of the active upstreams gauge for the label values of a series.
+// These are the configured labels and, if maxCardinality is configured, the overflow label.
+func (m *Metric) upstreamLabels(labels []string) []string {
+	labelCount := len(m.cfg.Labels)
+
+	if m.cardinality == nil {
+		return labels[:labelCount]
+	}
+
+	return append(labels[:labelCount:labelCount], labels[len(labels)-1])
 }
 
-// getUpstreamForValue returns the appropriate upstream for the given value index.
-// If there are fewer upstreams than values, it reuses the last upstream.
+// getUpstreamForValue returns the appropriate upstream element for the given value index.
+// If there are fewer upstream elements than values, it reuses the last one.
 func (m *Metric) getUpstreamForValue(upstreams []string, valueIndex int) string {
 	upstreamIndex := valueIndex
 	if upstreamIndex >= len(upstreams) {
@@ -408,6 +1477,7 @@ func (m *Metric) isUpstreamExcluded(upstream string) bool {
 // 4. Sets the value on the appropriate metric type (counter, gauge, or histogram)
 //
 // Parameters:
+//   - collector: The Prometheus collector to set the value on, see [Metric.observationCollector]
 //   - value: The string representation of the metric value to be processed
 //   - labels: Prometheus label values to identify the specific metric instance
 //
@@ -423,54 +1493,156 @@ func (m *Metric) isUpstreamExcluded(upstream string) bool {
 //   - Counter: Adds the parsed value to the counter (must be non-negative)
 //   - Gauge: Sets the gauge to the parsed value
 //   - Histogram: Observes the parsed value as a sample
-func (m *Metric) setMetric(value string, labels []string) error {
+func (m *Metric) setMetric(collector prometheus.Collector, value string, labels []string, exemplar prometheus.Labels) error {
 	// Handle empty values early
 	value = strings.TrimSpace(value)
 	if value == "" {
 		return nil // Skip empty values silently
 	}
 
+	if m.quarantine != nil {
+		return m.setMetricWithQuarantine(collector, value, labels, exemplar)
+	}
+
+	valueFloat, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse value %q: %w", value, err)
+	}
+
+	// Set the metric value based on type, math transformations are applied by setMetricValue
+	return m.setMetricValue(collector, valueFloat, labels, exemplar)
+}
+
+// setMetricWithQuarantine works like setMetric, but drops the series of a label set
+// after quarantineThreshold consecutive value parse failures and skips the label set from then on.
+func (m *Metric) setMetricWithQuarantine(collector prometheus.Collector, value string, labels []string, exemplar prometheus.Labels) error {
+	key := m.quarantine.key(labels)
+	if m.quarantine.isQuarantined(key) {
+		return nil
+	}
+
 	valueFloat, err := strconv.ParseFloat(value, 64)
 	if err != nil {
+		if m.quarantine.failure(key) {
+			m.quarantineSeries(labels)
+
+			return fmt.Errorf("failed to parse value %q, quarantining series after %d consecutive failures: %w", value, m.cfg.QuarantineThreshold, err)
+		}
+
 		return fmt.Errorf("failed to parse value %q: %w", value, err)
 	}
 
-	// Apply math transformations if configured
-	valueFloat = m.applyMathTransformations(valueFloat)
+	m.quarantine.success(key)
 
-	// Set the metric value based on type
-	return m.setMetricValue(valueFloat, labels)
+	return m.setMetricValue(collector, valueFloat, labels, exemplar)
 }
 
-// applyMathTransformations applies division and multiplication if configured.
+// validateMathRound validates the rounding mode of a math block.
+func validateMathRound(mathConfig config.Math) error {
+	switch mathConfig.Round {
+	case "", "none", "floor", "ceil", "round":
+		return nil
+	default:
+		return fmt.Errorf("math round must be one of floor, ceil, round or none, got '%s'", mathConfig.Round)
+	}
+}
+
+// applyMathTransformations applies the configured offsets, division, multiplication and rounding.
 func (m *Metric) applyMathTransformations(value float64) float64 {
-	if !m.cfg.Math.Enabled {
+	return applyMath(m.cfg.Math, value)
+}
+
+// applyMath applies the offsets, division, multiplication and rounding of mathConfig, if enabled.
+func applyMath(mathConfig config.Math, value float64) float64 {
+	if !mathConfig.Enabled {
 		return value
 	}
 
-	if m.cfg.Math.Div != 0 {
-		value /= m.cfg.Math.Div
+	// Offsets are applied first, so they are given in the unit of the logged value.
+	if mathConfig.Sub != 0 {
+		value -= mathConfig.Sub
+	}
+
+	if mathConfig.Add != 0 {
+		value += mathConfig.Add
+	}
+
+	if mathConfig.Div != 0 {
+		value /= mathConfig.Div
+	}
+
+	if mathConfig.Mul != 0 {
+		value *= mathConfig.Mul
 	}
 
-	if m.cfg.Math.Mul != 0 {
-		value *= m.cfg.Math.Mul
+	// Rounding applies to the final value, e.g. to get whole KiB after a division by 1024.
+	switch mathConfig.Round {
+	case "floor":
+		value = math.Floor(value)
+	case "ceil":
+		value = math.Ceil(value)
+	case "round":
+		value = math.Round(value)
 	}
 
 	return value
 }
 
-// setMetricValue sets the value on the appropriate metric type.
-func (m *Metric) setMetricValue(value float64, labels []string) error {
-	switch metric := m.metric.(type) {
+// setMetricValue sets the value on collector and all companions after applying the math transformations.
+// Companions with their own math block apply it instead of the math of the metric.
+// The exemplar, if not nil, is attached to histogram observations.
+func (m *Metric) setMetricValue(collector prometheus.Collector, value float64, labels []string, exemplar prometheus.Labels) error {
+	labels = m.limitCardinality(labels)
+
+	// The overflow series merges the label sets of all bucket schemes, so it always uses the buckets of the metric.
+	if m.cardinality != nil && labels[len(labels)-1] == "true" && slices.Contains(m.bucketOverrides, collector) {
+		collector = m.metric
+	}
+
+	if err := m.setCollectorValue(collector, m.applyMathTransformations(value), labels, exemplar); err != nil {
+		return err
+	}
+
+	for i, companion := range m.companions {
+		companionValue := m.applyMathTransformations(value)
+		if companionMath := m.cfg.Companions[i].Math; companionMath != nil {
+			companionValue = applyMath(*companionMath, value)
+		}
+
+		if err := m.setCollectorValue(companion, companionValue, labels, exemplar); err != nil {
+			return err
+		}
+	}
+
+	m.recordObservation()
+	m.touchSeries(labels)
+
+	return nil
+}
+
+func (m *Metric) setCollectorValue(collector prometheus.Collector, value float64, labels []string, exemplar prometheus.Labels) error {
+	switch metric := collector.(type) {
 	case *prometheus.CounterVec:
 		if value < 0 {
 			return fmt.Errorf("counter value cannot be negative: %f", value)
 		}
 
+		if m.cfg.ResetThreshold > 0 {
+			return m.addWithReset(metric, value, labels)
+		}
+
 		metric.WithLabelValues(labels...).Add(value)
 	case *prometheus.GaugeVec:
 		metric.WithLabelValues(labels...).Set(value)
 	case *prometheus.HistogramVec:
+		observer := metric.WithLabelValues(labels...)
+
+		if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && exemplar != nil {
+			exemplarObserver.ObserveWithExemplar(value, exemplar)
+		} else {
+			observer.Observe(value)
+		}
+	case *prometheus.SummaryVec:
 		metric.WithLabelValues(labels...).Observe(value)
 	default:
 		return fmt.Errorf("unsupported metric type %s", m.cfg.Type)
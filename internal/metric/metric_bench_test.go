@@ -43,6 +43,27 @@ func BenchmarkMetricParseSimple(b *testing.B) {
 	b.ReportAllocs()
 }
 
+func BenchmarkMetricParseNoLabels(b *testing.B) {
+	met, err := metric.New(config.Metric{
+		Name: "http_requests_total",
+		Type: "counter",
+		Help: "The total number of client requests.",
+		ConstLabels: map[string]string{
+			"vhost": "example.com",
+		},
+	})
+
+	require.NoError(b, err)
+
+	logLine := strings.Split("example.com\tGET\t200", "\t")
+
+	for b.Loop() {
+		_ = met.Parse(logLine)
+	}
+
+	b.ReportAllocs()
+}
+
 func BenchmarkMetricParseUserAgent(b *testing.B) {
 	met, err := metric.New(config.Metric{
 		Name: "http_requests_total",
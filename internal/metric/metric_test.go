@@ -1,14 +1,23 @@
 package metric_test
 
 import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jkroepke/access-log-exporter/internal/config"
 	"github.com/jkroepke/access-log-exporter/internal/config/types"
 	"github.com/jkroepke/access-log-exporter/internal/metric"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
 	"github.com/stretchr/testify/require"
 )
 
@@ -51,6 +60,26 @@ func TestMetrics(t *testing.T) {
 # HELP http_requests_total The total number of client requests.
 # TYPE http_requests_total counter
 http_requests_total{host="example.com",method="GET",status="200"} 1`,
+		},
+		{
+			name: "metric without labels",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+				ConstLabels: map[string]string{
+					"vhost": "example.com",
+				},
+			},
+			logLines: []string{
+				"example.com\tGET\t200",
+				"example.com\tPOST\t201",
+				"\tGET\t200",
+			},
+			metrics: `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{vhost="example.com"} 2`,
 		},
 		{
 			name: "simple metric test math",
@@ -85,6 +114,87 @@ http_requests_total{host="example.com",method="GET",status="200"} 1`,
 # HELP http_requests_total The total number of client requests.
 # TYPE http_requests_total counter
 http_requests_total{host="example.com",method="GET",status="200"} 1`,
+		},
+		{
+			name: "gauge metric test math add and div",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "gauge",
+				Help:       "The time spent on processing the request.",
+				ValueIndex: new(uint(1)),
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+				},
+				Math: config.Math{
+					Enabled: true,
+					Add:     500,
+					Div:     1000,
+				},
+			},
+			logLines: []string{
+				"example.com\t1500",
+			},
+			metrics: `
+# HELP http_request_duration_seconds The time spent on processing the request.
+# TYPE http_request_duration_seconds gauge
+http_request_duration_seconds{host="example.com"} 2`,
+		},
+		{
+			name: "gauge metric test math sub before mul",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "gauge",
+				Help:       "The time spent on processing the request.",
+				ValueIndex: new(uint(1)),
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+				},
+				Math: config.Math{
+					Enabled: true,
+					Sub:     0.5,
+					Mul:     2,
+				},
+			},
+			logLines: []string{
+				"example.com\t1.5",
+			},
+			metrics: `
+# HELP http_request_duration_seconds The time spent on processing the request.
+# TYPE http_request_duration_seconds gauge
+http_request_duration_seconds{host="example.com"} 2`,
+		},
+		{
+			name: "gauge metric test math div with round ceil",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "gauge",
+				Help:       "The time spent on processing the request.",
+				ValueIndex: new(uint(1)),
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+				},
+				Math: config.Math{
+					Enabled: true,
+					Div:     1000,
+					Round:   "ceil",
+				},
+			},
+			logLines: []string{
+				"example.com\t1234",
+			},
+			metrics: `
+# HELP http_request_duration_seconds The time spent on processing the request.
+# TYPE http_request_duration_seconds gauge
+http_request_duration_seconds{host="example.com"} 2`,
 		},
 		{
 			name: "simple metric with incomplete log line",
@@ -164,7 +274,7 @@ http_requests_total{host="example.com",method="GET",status="200"} 1`,
 				ValueIndex: new(uint(0)),
 			},
 			logLines:  make([]string, 0),
-			metricErr: `unsupported metric type: "". Must be one of counter, gauge, or histogram`,
+			metricErr: `unsupported metric type: "". Must be one of counter, gauge, histogram, or summary`,
 		},
 		{
 			name: "metric with empty label name",
@@ -186,7 +296,7 @@ http_requests_total{host="example.com",method="GET",status="200"} 1`,
 				ValueIndex: new(uint(0)),
 			},
 			logLines:  make([]string, 0),
-			metricErr: `unsupported metric type: "info". Must be one of counter, gauge, or histogram`,
+			metricErr: `unsupported metric type: "info". Must be one of counter, gauge, histogram, or summary`,
 		},
 		{
 			name: "non-counter metrics without valueIndex",
@@ -650,35 +760,2008 @@ http_upstream_connect_duration_seconds{host="api.example.com",method="GET",statu
 http_upstream_connect_duration_seconds{host="web.example.org",method="POST",status="502"} 5e-06
 `,
 		},
-	} {
-		t.Run(tc.name, func(t *testing.T) {
-			t.Parallel()
-
-			met, err := metric.New(tc.cfg)
-			if err != nil {
-				if tc.metricErr != "" {
-					require.EqualError(t, err, tc.metricErr)
-				} else {
-					require.NoError(t, err)
-				}
-
-				return
-			}
-
-			for _, line := range tc.logLines {
-				err := met.Parse(strings.Split(line, "\t"))
-				if err != nil {
-					if tc.parseErr != "" {
-						require.EqualError(t, err, tc.parseErr)
-					} else {
-						require.NoError(t, err)
-					}
-
-					return
-				}
-			}
-
-			require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(strings.TrimSpace(tc.metrics)+"\n")))
-		})
-	}
+		{
+			name: "metric with upstream status label",
+			cfg: config.Metric{
+				Name:       "http_upstream_response_duration_seconds_total",
+				Type:       "counter",
+				Help:       "The time spent on receiving the response from the upstream server",
+				ValueIndex: new(uint(4)),
+				Upstream: config.Upstream{
+					Enabled:         true,
+					AddrLineIndex:   2,
+					StatusLineIndex: new(uint(3)),
+					Label:           true,
+				},
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+					{
+						Name:      "status",
+						LineIndex: 1,
+					},
+				},
+			},
+			logLines: []string{
+				"api.example.com\t200\t10.0.1.5:8080\t200\t0.120",
+				"web.example.org\t200\t10.0.1.10:8080, 10.0.1.11:8080\t502, 200\t0.800, 0.900",
+			},
+			metrics: `
+# HELP http_upstream_response_duration_seconds_total The time spent on receiving the response from the upstream server
+# TYPE http_upstream_response_duration_seconds_total counter
+http_upstream_response_duration_seconds_total{host="api.example.com",status="200",upstream="10.0.1.5:8080",upstream_status="200"} 0.12
+http_upstream_response_duration_seconds_total{host="web.example.org",status="200",upstream="10.0.1.10:8080",upstream_status="502"} 0.8
+http_upstream_response_duration_seconds_total{host="web.example.org",status="200",upstream="10.0.1.11:8080",upstream_status="200"} 0.9
+`,
+		},
+		{
+			name: "metric with upstream status label without upstream label",
+			cfg: config.Metric{
+				Name:       "http_upstream_response_duration_seconds_total",
+				Type:       "counter",
+				Help:       "The time spent on receiving the response from the upstream server",
+				ValueIndex: new(uint(3)),
+				Upstream: config.Upstream{
+					Enabled:         true,
+					StatusLineIndex: new(uint(2)),
+				},
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+				},
+			},
+			logLines: []string{
+				"web.example.org\t200\t502, 504, 200\t0.500, 0.250, 0.125",
+			},
+			metrics: `
+# HELP http_upstream_response_duration_seconds_total The time spent on receiving the response from the upstream server
+# TYPE http_upstream_response_duration_seconds_total counter
+http_upstream_response_duration_seconds_total{host="web.example.org",upstream_status="200"} 0.125
+http_upstream_response_duration_seconds_total{host="web.example.org",upstream_status="502"} 0.5
+http_upstream_response_duration_seconds_total{host="web.example.org",upstream_status="504"} 0.25
+`,
+		},
+		{
+			name: "metric with quoted label values",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+				Labels: []config.Label{
+					{
+						Name:       "method",
+						LineIndex:  0,
+						TrimQuotes: true,
+					},
+					{
+						Name:       "protocol",
+						LineIndex:  1,
+						TrimQuotes: true,
+					},
+					{
+						Name:      "referer",
+						LineIndex: 2,
+					},
+				},
+			},
+			logLines: []string{
+				"\"GET\"\t'HTTP/1.1'\t\"-\"",
+				"\"\"POST\"\"\t\"HTTP/2.0'\t\"-\"",
+				"\"\t\"\"\t\"-\"",
+			},
+			metrics: `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{method="\"",protocol="",referer="\"-\""} 1
+http_requests_total{method="\"POST\"",protocol="\"HTTP/2.0'",referer="\"-\""} 1
+http_requests_total{method="GET",protocol="HTTP/1.1",referer="\"-\""} 1
+`,
+		},
+		{
+			name: "counter with protocolNormalize",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+				Labels: []config.Label{
+					{
+						Name:              "protocol",
+						LineIndex:         0,
+						ProtocolNormalize: true,
+					},
+				},
+			},
+			logLines: []string{
+				"HTTP/1.0",
+				"HTTP/1.1",
+				"HTTP/1.1",
+				"HTTP/2.0",
+				"HTTP/2",
+				"HTTP/3.0",
+				"HTTP/3",
+				"-",
+			},
+			metrics: `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{protocol="-"} 1
+http_requests_total{protocol="1.0"} 1
+http_requests_total{protocol="1.1"} 2
+http_requests_total{protocol="2"} 2
+http_requests_total{protocol="3"} 2
+`,
+		},
+		{
+			name: "counter with firstSegment",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+				Labels: []config.Label{
+					{
+						Name:         "route",
+						LineIndex:    0,
+						FirstSegment: true,
+					},
+				},
+			},
+			logLines: []string{
+				"/api/users/5",
+				"/api?page=2",
+				"/static/css/main.css",
+				"/",
+				"/?page=2",
+				"-",
+			},
+			metrics: `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{route="-"} 1
+http_requests_total{route="/"} 2
+http_requests_total{route="api"} 2
+http_requests_total{route="static"} 1
+`,
+		},
+		{
+			name: "counter with ssl protocol and cipher",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+				Labels: []config.Label{
+					{
+						Name:      "ssl_protocol",
+						LineIndex: 0,
+						SSL:       config.LabelSSLProtocol,
+					},
+					{
+						Name:      "ssl_cipher",
+						LineIndex: 0,
+						SSL:       config.LabelSSLCipher,
+					},
+				},
+			},
+			logLines: []string{
+				"TLSv1.3/TLS_AES_256_GCM_SHA384",
+				"TLSv1.2/ECDHE-RSA-AES128-GCM-SHA256",
+				"-",
+			},
+			metrics: `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{ssl_cipher="-",ssl_protocol="-"} 1
+http_requests_total{ssl_cipher="ECDHE-RSA-AES128-GCM-SHA256",ssl_protocol="TLSv1.2"} 1
+http_requests_total{ssl_cipher="TLS_AES_256_GCM_SHA384",ssl_protocol="TLSv1.3"} 1
+`,
+		},
+		{
+			name: "counter with label ranges",
+			cfg: config.Metric{
+				Name: "http_responses_total",
+				Type: "counter",
+				Help: "The total number of responses.",
+				Labels: []config.Label{
+					{
+						Name:      "size",
+						LineIndex: 0,
+						Ranges: []config.LabelRange{
+							{Max: 1024, Value: "small"},
+							{Max: 1048576, Value: "medium"},
+							{Max: math.Inf(1), Value: "large"},
+						},
+					},
+				},
+			},
+			logLines: []string{
+				"0",
+				"1024",
+				"1025",
+				"1048576",
+				"5000000",
+				"-",
+			},
+			metrics: `
+# HELP http_responses_total The total number of responses.
+# TYPE http_responses_total counter
+http_responses_total{size=""} 1
+http_responses_total{size="large"} 1
+http_responses_total{size="medium"} 2
+http_responses_total{size="small"} 2
+`,
+		},
+		{
+			name: "counter with label allowlist",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+				Labels: []config.Label{
+					{
+						Name:      "method",
+						LineIndex: 0,
+						Allowlist: []string{"GET", "POST", "PUT", "DELETE"},
+					},
+					{
+						Name:              "status",
+						LineIndex:         1,
+						Allowlist:         []string{"2xx"},
+						AllowlistFallback: "error",
+						Replacements: []config.Replacement{
+							{Regexp: regexp.MustCompile(`^2\d\d$`), Replacement: "2xx"},
+						},
+					},
+				},
+			},
+			logLines: []string{
+				"GET\t200",
+				"TRACE\t204",
+				"POST\t404",
+			},
+			metrics: `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",status="2xx"} 1
+http_requests_total{method="POST",status="error"} 1
+http_requests_total{method="other",status="2xx"} 1
+`,
+		},
+		{
+			name: "counter with dropIfLabelMatches",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+				DropIfLabelMatches: []config.LabelMatch{
+					{LabelIndex: 1, Regexp: regexp.MustCompile(`^/(healthz|readyz)$`)},
+				},
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+				},
+			},
+			logLines: []string{
+				"example.com\t/healthz",
+				"example.com\t/index.html",
+			},
+			metrics: `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{host="example.com"} 1
+`,
+		},
+		{
+			name: "dropIfLabelMatches without regexp",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				DropIfLabelMatches: []config.LabelMatch{
+					{LabelIndex: 1},
+				},
+			},
+			logLines:  make([]string, 0),
+			metricErr: "dropIfLabelMatches for label index 1 requires a regexp",
+		},
+		{
+			name: "label with unknown ssl part",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Labels: []config.Label{
+					{
+						Name:      "ssl",
+						LineIndex: 0,
+						SSL:       "version",
+					},
+				},
+			},
+			logLines:  make([]string, 0),
+			metricErr: "label 'ssl': ssl must be one of protocol or cipher, got 'version'",
+		},
+		{
+			name: "count only counter with value index",
+			cfg: config.Metric{
+				Name:       "http_requests_total",
+				Type:       "counter",
+				Help:       "The total number of client requests.",
+				ValueIndex: new(uint(1)),
+				CountOnly:  true,
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+				},
+			},
+			logLines: []string{
+				"example.com\t512",
+				"example.com\t1024",
+				"example.com\t-",
+			},
+			metrics: `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{host="example.com"} 3
+`,
+		},
+		{
+			name: "count only gauge",
+			cfg: config.Metric{
+				Name:       "http_response_size_bytes",
+				Type:       "gauge",
+				ValueIndex: new(uint(1)),
+				CountOnly:  true,
+			},
+			logLines:  make([]string, 0),
+			metricErr: "countOnly can only be used with counter metrics",
+		},
+		{
+			name: "metric with empty first field",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+				Labels: []config.Label{
+					{
+						Name:      "method",
+						LineIndex: 1,
+					},
+				},
+			},
+			logLines: []string{
+				"\tGET",
+				"example.com\tGET",
+			},
+			metrics: `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{method="GET"} 1
+`,
+		},
+		{
+			name: "metric with empty first field and custom required index",
+			cfg: config.Metric{
+				Name:                 "http_requests_total",
+				Type:                 "counter",
+				Help:                 "The total number of client requests.",
+				RequireNonEmptyIndex: new(uint(1)),
+				Labels: []config.Label{
+					{
+						Name:      "method",
+						LineIndex: 1,
+					},
+				},
+			},
+			logLines: []string{
+				"\tGET",
+				"example.com\tGET",
+				"example.com\t",
+			},
+			metrics: `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{method="GET"} 2
+`,
+		},
+		{
+			name: "metric with required index out of range",
+			cfg: config.Metric{
+				Name:                 "http_requests_total",
+				Type:                 "counter",
+				RequireNonEmptyIndex: new(uint(5)),
+			},
+			logLines: []string{
+				"example.com\tGET",
+			},
+			parseErr: "line index out of range for required non-empty index 5, line length is 2",
+		},
+		{
+			name: "metric with header label",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+					{
+						Name:      "content_type",
+						LineIndex: 1,
+						Header:    true,
+					},
+				},
+			},
+			logLines: []string{
+				"example.com\tApplication/JSON",
+				"example.com\t application/json ",
+				"example.com\tText/HTML;  charset=UTF-8",
+				"example.com\t-",
+			},
+			metrics: `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{content_type="",host="example.com"} 1
+http_requests_total{content_type="application/json",host="example.com"} 2
+http_requests_total{content_type="text/html; charset=utf-8",host="example.com"} 1
+`,
+		},
+		{
+			name: "metric with collapsed whitespace label",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+				Labels: []config.Label{
+					{
+						Name:               "user_agent",
+						LineIndex:          0,
+						CollapseWhitespace: true,
+					},
+				},
+			},
+			logLines: []string{
+				"a   b",
+				"a b",
+				"a \u00a0b ",
+			},
+			metrics: `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{user_agent="a b"} 2
+http_requests_total{user_agent="a b "} 1
+`,
+		},
+		{
+			name: "metric with stripped control characters label",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Help: "The total number of client requests.",
+				Labels: []config.Label{
+					{
+						Name:         "upstream",
+						LineIndex:    0,
+						StripControl: true,
+					},
+				},
+			},
+			logLines: []string{
+				"\x1b[31mbackend\x1b[0m",
+				"\x1b[1;32mbackend",
+				`\x1B[31mbackend\x1B[0m`,
+				"back\x00end\x7f",
+				"frontend",
+			},
+			metrics: `
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{upstream="backend"} 4
+http_requests_total{upstream="frontend"} 1
+`,
+		},
+		{
+			name: "metric with value from key-value field",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "histogram",
+				Help:       "The time spent on processing the request.",
+				ValueIndex: new(uint(1)),
+				Buckets:    []float64{.1, 1},
+				KVField: &config.KVField{
+					Key: "rt",
+				},
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+				},
+			},
+			logLines: []string{
+				"example.com\trt=0.123;sz=4096",
+				"example.com\tsz=4096; rt=0.5",
+				"example.com\tsz=4096",
+				"example.com\trt=-;sz=4096",
+			},
+			metrics: `
+# HELP http_request_duration_seconds The time spent on processing the request.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{host="example.com",le="0.1"} 0
+http_request_duration_seconds_bucket{host="example.com",le="1"} 2
+http_request_duration_seconds_bucket{host="example.com",le="+Inf"} 2
+http_request_duration_seconds_sum{host="example.com"} 0.623
+http_request_duration_seconds_count{host="example.com"} 2
+`,
+		},
+		{
+			name: "metric with value from key-value field with custom separators",
+			cfg: config.Metric{
+				Name:       "http_response_size_bytes",
+				Type:       "counter",
+				Help:       "The total size of responses.",
+				ValueIndex: new(uint(0)),
+				KVField: &config.KVField{
+					Key:           "sz",
+					Separator:     ":",
+					PairSeparator: ",",
+				},
+			},
+			logLines: []string{
+				"rt:0.123,sz:4096",
+			},
+			metrics: `
+# HELP http_response_size_bytes The total size of responses.
+# TYPE http_response_size_bytes counter
+http_response_size_bytes 4096
+`,
+		},
+		{
+			name: "metric with key-value field without value index",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				KVField: &config.KVField{
+					Key: "rt",
+				},
+			},
+			logLines:  make([]string, 0),
+			metricErr: "kvField requires valueIndex to be set",
+		},
+		{
+			name: "metric with active upstreams gauge",
+			cfg: config.Metric{
+				Name:       "http_upstream_response_duration_seconds_total",
+				Type:       "counter",
+				Help:       "The time spent on receiving the response from the upstream server",
+				ValueIndex: new(uint(2)),
+				Upstream: config.Upstream{
+					Enabled:       true,
+					AddrLineIndex: 1,
+					ActiveMetric:  "http_upstreams_active",
+					Excludes:      []string{"unix:/tmp/sock"},
+				},
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+				},
+			},
+			logLines: []string{
+				"api.example.com\t10.0.1.5:8080\t0.1",
+				"api.example.com\t10.0.1.5:8080\t0.1",
+				"api.example.com\t10.0.1.6:8080, 10.0.1.7:8080\t0.1, 0.1",
+				"api.example.com\tunix:/tmp/sock\t0.1",
+				"web.example.org\t10.0.1.5:8080\t0.1",
+			},
+			metrics: `
+# HELP http_upstream_response_duration_seconds_total The time spent on receiving the response from the upstream server
+# TYPE http_upstream_response_duration_seconds_total counter
+http_upstream_response_duration_seconds_total{host="api.example.com"} 0.4
+http_upstream_response_duration_seconds_total{host="web.example.org"} 0.1
+# HELP http_upstreams_active Number of distinct upstream servers observed
+# TYPE http_upstreams_active gauge
+http_upstreams_active{host="api.example.com"} 3
+http_upstreams_active{host="web.example.org"} 1
+`,
+		},
+		{
+			name: "counter with reset threshold",
+			cfg: config.Metric{
+				Name:       "http_response_size_bytes_total",
+				Type:       "counter",
+				Help:       "The total size of responses.",
+				ValueIndex: new(uint(1)),
+				// Largest float64 which can represent all smaller integers exactly.
+				ResetThreshold: 1 << 53,
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+				},
+			},
+			logLines: []string{
+				"example.com\t9007199254740991",
+				"example.com\t1",
+				// Without the reset, adding 1 to 2^53 is lost due to the float64 precision.
+				"example.com\t1",
+				"example.com\t1",
+			},
+			metrics: `
+# HELP http_response_size_bytes_total The total size of responses.
+# TYPE http_response_size_bytes_total counter
+http_response_size_bytes_total{host="example.com"} 2
+`,
+		},
+		{
+			name: "gauge with reset threshold",
+			cfg: config.Metric{
+				Name:           "http_response_size_bytes",
+				Type:           "gauge",
+				ValueIndex:     new(uint(1)),
+				ResetThreshold: 1000,
+			},
+			logLines:  make([]string, 0),
+			metricErr: "resetThreshold can only be used with counter metrics",
+		},
+		{
+			name: "ratio metric",
+			cfg: config.Metric{
+				Name:         "http_response_compression_ratio",
+				Type:         "gauge",
+				Help:         "The ratio of bytes sent to the request length.",
+				RatioIndices: &[2]uint{2, 1},
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+				},
+			},
+			logLines: []string{
+				"example.com\t200\t50",
+				"example.com\t0\t50",
+				"example.com\t-\t50",
+			},
+			metrics: `
+# HELP http_response_compression_ratio The ratio of bytes sent to the request length.
+# TYPE http_response_compression_ratio gauge
+http_response_compression_ratio{host="example.com"} 0.25
+`,
+		},
+		{
+			name: "ratio metric with value index",
+			cfg: config.Metric{
+				Name:         "http_response_compression_ratio",
+				Type:         "gauge",
+				ValueIndex:   new(uint(1)),
+				RatioIndices: &[2]uint{2, 1},
+			},
+			logLines:  make([]string, 0),
+			metricErr: "valueIndex and ratioIndices are mutually exclusive",
+		},
+		{
+			name: "histogram with counter companion",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "histogram",
+				Help:       "The time spent on processing the request.",
+				ValueIndex: new(uint(1)),
+				Buckets:    []float64{.1, 1},
+				Companions: []config.Companion{
+					{
+						Name: "http_request_duration_seconds_sum_total",
+						Type: "counter",
+						Help: "The total time spent on processing requests.",
+					},
+				},
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+				},
+			},
+			logLines: []string{
+				"example.com\t0.5",
+				"example.com\t0.25",
+			},
+			metrics: `
+# HELP http_request_duration_seconds The time spent on processing the request.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{host="example.com",le="0.1"} 0
+http_request_duration_seconds_bucket{host="example.com",le="1"} 2
+http_request_duration_seconds_bucket{host="example.com",le="+Inf"} 2
+http_request_duration_seconds_sum{host="example.com"} 0.75
+http_request_duration_seconds_count{host="example.com"} 2
+# HELP http_request_duration_seconds_sum_total The total time spent on processing requests.
+# TYPE http_request_duration_seconds_sum_total counter
+http_request_duration_seconds_sum_total{host="example.com"} 0.75
+`,
+		},
+		{
+			name: "histogram with companion math",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "histogram",
+				Help:       "The time spent on processing the request.",
+				ValueIndex: new(uint(1)),
+				Buckets:    []float64{.1, 1},
+				Math: config.Math{
+					Enabled: true,
+					Div:     1000,
+				},
+				Companions: []config.Companion{
+					{
+						Name: "http_request_duration_seconds_total",
+						Type: "counter",
+						Help: "The total time spent on processing requests.",
+					},
+					{
+						Name: "http_request_duration_minutes_total",
+						Type: "counter",
+						Help: "The total time spent on processing requests in minutes.",
+						Math: &config.Math{
+							Enabled: true,
+							Div:     60000,
+						},
+					},
+					{
+						Name: "http_request_duration_raw_total",
+						Type: "counter",
+						Help: "The total time spent on processing requests as logged.",
+						Math: &config.Math{},
+					},
+				},
+			},
+			logLines: []string{
+				"example.com\t500",
+				"example.com\t250",
+			},
+			metrics: `
+# HELP http_request_duration_seconds The time spent on processing the request.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="0.1"} 0
+http_request_duration_seconds_bucket{le="1"} 2
+http_request_duration_seconds_bucket{le="+Inf"} 2
+http_request_duration_seconds_sum 0.75
+http_request_duration_seconds_count 2
+# HELP http_request_duration_seconds_total The total time spent on processing requests.
+# TYPE http_request_duration_seconds_total counter
+http_request_duration_seconds_total 0.75
+# HELP http_request_duration_minutes_total The total time spent on processing requests in minutes.
+# TYPE http_request_duration_minutes_total counter
+http_request_duration_minutes_total 0.0125
+# HELP http_request_duration_raw_total The total time spent on processing requests as logged.
+# TYPE http_request_duration_raw_total counter
+http_request_duration_raw_total 750
+`,
+		},
+		{
+			name: "companion with invalid math round",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "histogram",
+				ValueIndex: new(uint(0)),
+				Companions: []config.Companion{
+					{
+						Name: "http_request_duration_seconds_total",
+						Type: "counter",
+						Math: &config.Math{Round: "up"},
+					},
+				},
+			},
+			logLines:  make([]string, 0),
+			metricErr: `companion metric "http_request_duration_seconds_total": math round must be one of floor, ceil, round or none, got 'up'`,
+		},
+		{
+			name: "companion without value index",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Companions: []config.Companion{
+					{
+						Name: "http_requests_copy_total",
+						Type: "counter",
+					},
+				},
+			},
+			logLines:  make([]string, 0),
+			metricErr: "companions require valueIndex or ratioIndices to be set",
+		},
+		{
+			name: "companion with unsupported type",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "histogram",
+				ValueIndex: new(uint(0)),
+				Companions: []config.Companion{
+					{
+						Name: "http_request_duration_seconds_info",
+						Type: "info",
+					},
+				},
+			},
+			logLines:  make([]string, 0),
+			metricErr: `companion metric "http_request_duration_seconds_info": unsupported metric type: "info". Must be one of counter, gauge, histogram, or summary`,
+		},
+		{
+			name: "summary",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "summary",
+				Help:       "The time spent on processing the request.",
+				ValueIndex: new(uint(1)),
+				Objectives: types.Objectives{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+				},
+			},
+			logLines: []string{
+				"example.com\t0.1",
+				"example.com\t0.2",
+				"example.com\t0.3",
+				"example.com\t0.4",
+				"example.com\t0.5",
+			},
+			metrics: `
+# HELP http_request_duration_seconds The time spent on processing the request.
+# TYPE http_request_duration_seconds summary
+http_request_duration_seconds{host="example.com",quantile="0.5"} 0.3
+http_request_duration_seconds{host="example.com",quantile="0.9"} 0.5
+http_request_duration_seconds{host="example.com",quantile="0.99"} 0.5
+http_request_duration_seconds_sum{host="example.com"} 1.5
+http_request_duration_seconds_count{host="example.com"} 5
+`,
+		},
+		{
+			name: "summary without value index",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "summary",
+				Objectives: types.Objectives{0.5: 0.05},
+			},
+			logLines:  make([]string, 0),
+			metricErr: "valueIndex must be set for non-counter metrics",
+		},
+		{
+			name: "histogram with gaugeWhen",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "histogram",
+				Help:       "The time spent on processing the request.",
+				ValueIndex: new(uint(1)),
+				Buckets:    []float64{.1, 1},
+				GaugeWhen: &config.GaugeWhen{
+					Name:      "http_request_duration_seconds_summary",
+					Help:      "The time spent on processing requests from summary lines.",
+					LineIndex: 2,
+					Values:    []string{"summary"},
+				},
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+				},
+			},
+			logLines: []string{
+				"example.com\t0.5\trequest",
+				"example.com\t0.25\t request",
+				"example.com\t3\tsummary",
+				"example.com\t2\t summary ",
+			},
+			metrics: `
+# HELP http_request_duration_seconds The time spent on processing the request.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{host="example.com",le="0.1"} 0
+http_request_duration_seconds_bucket{host="example.com",le="1"} 2
+http_request_duration_seconds_bucket{host="example.com",le="+Inf"} 2
+http_request_duration_seconds_sum{host="example.com"} 0.75
+http_request_duration_seconds_count{host="example.com"} 2
+# HELP http_request_duration_seconds_summary The time spent on processing requests from summary lines.
+# TYPE http_request_duration_seconds_summary gauge
+http_request_duration_seconds_summary{host="example.com"} 2
+`,
+		},
+		{
+			name: "histogram with gaugeWhen index out of range",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "histogram",
+				ValueIndex: new(uint(0)),
+				GaugeWhen: &config.GaugeWhen{
+					Name:      "http_request_duration_seconds_summary",
+					LineIndex: 2,
+					Values:    []string{"summary"},
+				},
+			},
+			logLines: []string{"0.5"},
+			parseErr: "line index out of range for gaugeWhen index 2, line length is 1",
+		},
+		{
+			name: "histogram with bucketOverrides",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "histogram",
+				Help:       "The time spent on processing the request.",
+				ValueIndex: new(uint(2)),
+				Buckets:    []float64{.1, 1},
+				BucketOverrides: []config.BucketOverride{
+					{
+						LineIndex: 1,
+						Values:    []string{"500", "503"},
+						Buckets:   []float64{1, 10},
+					},
+				},
+				Labels: []config.Label{
+					{
+						Name:      "status",
+						LineIndex: 1,
+					},
+				},
+			},
+			logLines: []string{
+				"example.com\t200\t0.05",
+				"example.com\t200\t0.5",
+				"example.com\t503\t5",
+				"example.com\t500\t0.5",
+			},
+			metrics: `
+# HELP http_request_duration_seconds The time spent on processing the request.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{status="200",le="0.1"} 1
+http_request_duration_seconds_bucket{status="200",le="1"} 2
+http_request_duration_seconds_bucket{status="200",le="+Inf"} 2
+http_request_duration_seconds_sum{status="200"} 0.55
+http_request_duration_seconds_count{status="200"} 2
+http_request_duration_seconds_bucket{status="500",le="1"} 1
+http_request_duration_seconds_bucket{status="500",le="10"} 1
+http_request_duration_seconds_bucket{status="500",le="+Inf"} 1
+http_request_duration_seconds_sum{status="500"} 0.5
+http_request_duration_seconds_count{status="500"} 1
+http_request_duration_seconds_bucket{status="503",le="1"} 0
+http_request_duration_seconds_bucket{status="503",le="10"} 1
+http_request_duration_seconds_bucket{status="503",le="+Inf"} 1
+http_request_duration_seconds_sum{status="503"} 5
+http_request_duration_seconds_count{status="503"} 1
+`,
+		},
+		{
+			name: "bucketOverrides without label",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "histogram",
+				ValueIndex: new(uint(0)),
+				BucketOverrides: []config.BucketOverride{
+					{
+						LineIndex: 1,
+						Values:    []string{"500"},
+						Buckets:   []float64{1, 10},
+					},
+				},
+			},
+			logLines:  make([]string, 0),
+			metricErr: "bucketOverrides lineIndex 1 must also be used by a label",
+		},
+		{
+			name: "gauge with bucketOverrides",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "gauge",
+				ValueIndex: new(uint(0)),
+				BucketOverrides: []config.BucketOverride{
+					{
+						Values:  []string{"500"},
+						Buckets: []float64{1, 10},
+					},
+				},
+			},
+			logLines:  make([]string, 0),
+			metricErr: "bucketOverrides can only be used with histogram metrics",
+		},
+		{
+			name: "gauge with gaugeWhen",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "gauge",
+				ValueIndex: new(uint(0)),
+				GaugeWhen: &config.GaugeWhen{
+					Name:   "http_request_duration_seconds_summary",
+					Values: []string{"summary"},
+				},
+			},
+			logLines:  make([]string, 0),
+			metricErr: "gaugeWhen can only be used with histogram metrics",
+		},
+		{
+			name: "gauge with exemplarLabelIndex",
+			cfg: config.Metric{
+				Name:               "http_request_duration_seconds",
+				Type:               "gauge",
+				ValueIndex:         new(uint(0)),
+				ExemplarLabelIndex: new(uint(1)),
+			},
+			logLines:  make([]string, 0),
+			metricErr: "exemplarLabelIndex can only be used with histogram metrics",
+		},
+		{
+			name: "exemplarLabelName without exemplarLabelIndex",
+			cfg: config.Metric{
+				Name:              "http_request_duration_seconds",
+				Type:              "histogram",
+				ValueIndex:        new(uint(0)),
+				ExemplarLabelName: "trace_id",
+			},
+			logLines:  make([]string, 0),
+			metricErr: "exemplarLabelName requires exemplarLabelIndex to be set",
+		},
+		{
+			name: "histogram with reserved exemplarLabelName",
+			cfg: config.Metric{
+				Name:               "http_request_duration_seconds",
+				Type:               "histogram",
+				ValueIndex:         new(uint(0)),
+				ExemplarLabelIndex: new(uint(1)),
+				ExemplarLabelName:  "__trace_id",
+			},
+			logLines:  make([]string, 0),
+			metricErr: `invalid exemplar label name "__trace_id"`,
+		},
+		{
+			name: "gauge with nativeHistogram",
+			cfg: config.Metric{
+				Name:            "http_request_duration_seconds",
+				Type:            "gauge",
+				ValueIndex:      new(uint(0)),
+				NativeHistogram: true,
+			},
+			logLines:  make([]string, 0),
+			metricErr: "nativeHistogram can only be used with histogram metrics",
+		},
+		{
+			name: "nativeHistogram with invalid bucket factor",
+			cfg: config.Metric{
+				Name:                        "http_request_duration_seconds",
+				Type:                        "histogram",
+				ValueIndex:                  new(uint(0)),
+				NativeHistogram:             true,
+				NativeHistogramBucketFactor: 1,
+			},
+			logLines:  make([]string, 0),
+			metricErr: "nativeHistogramBucketFactor must be greater than 1, got 1",
+		},
+		{
+			name: "nativeHistogramBucketFactor without nativeHistogram",
+			cfg: config.Metric{
+				Name:                        "http_request_duration_seconds",
+				Type:                        "histogram",
+				ValueIndex:                  new(uint(0)),
+				NativeHistogramBucketFactor: 1.1,
+			},
+			logLines:  make([]string, 0),
+			metricErr: "nativeHistogramBucketFactor and nativeHistogramMaxBucketNumber require nativeHistogram to be enabled",
+		},
+		{
+			name: "gaugeWhen with same name",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "histogram",
+				ValueIndex: new(uint(0)),
+				GaugeWhen: &config.GaugeWhen{
+					Name:   "http_request_duration_seconds",
+					Values: []string{"summary"},
+				},
+			},
+			logLines:  make([]string, 0),
+			metricErr: "gaugeWhen name must differ from the metric name",
+		},
+		{
+			name: "gaugeWhen without values",
+			cfg: config.Metric{
+				Name:       "http_request_duration_seconds",
+				Type:       "histogram",
+				ValueIndex: new(uint(0)),
+				GaugeWhen: &config.GaugeWhen{
+					Name: "http_request_duration_seconds_summary",
+				},
+			},
+			logLines:  make([]string, 0),
+			metricErr: "gaugeWhen values cannot be empty",
+		},
+		{
+			name: "valueRegexp with valueIndex",
+			cfg: config.Metric{
+				Name:        "http_request_duration_seconds",
+				Type:        "histogram",
+				ValueIndex:  new(uint(0)),
+				ValueRegexp: regexp.MustCompile(`took=([0-9.]+)s`),
+			},
+			logLines:  make([]string, 0),
+			metricErr: "valueRegexp is mutually exclusive with valueIndex and ratioIndices",
+		},
+		{
+			name: "valueRegexp with multiple capture groups",
+			cfg: config.Metric{
+				Name:        "http_request_duration_seconds",
+				Type:        "histogram",
+				ValueRegexp: regexp.MustCompile(`(took)=([0-9.]+)s`),
+			},
+			logLines:  make([]string, 0),
+			metricErr: "valueRegexp must have at most one capture group",
+		},
+		{
+			name: "duplicate label names",
+			cfg: config.Metric{
+				Name: "http_requests_total",
+				Type: "counter",
+				Labels: []config.Label{
+					{
+						Name:      "host",
+						LineIndex: 0,
+					},
+					{
+						Name:      "host",
+						LineIndex: 1,
+					},
+				},
+			},
+			logLines:  make([]string, 0),
+			metricErr: `duplicate label name "host"`,
+		},
+		{
+			name: "label name collides with upstream label",
+			cfg: config.Metric{
+				Name:       "http_upstream_connect_duration_seconds",
+				Type:       "histogram",
+				ValueIndex: new(uint(1)),
+				Upstream: config.Upstream{
+					Enabled:       true,
+					Label:         true,
+					AddrLineIndex: 2,
+				},
+				Labels: []config.Label{
+					{
+						Name:      "upstream",
+						LineIndex: 0,
+					},
+				},
+			},
+			logLines:  make([]string, 0),
+			metricErr: `duplicate label name "upstream"`,
+		},
+		{
+			name: "metric with unit not matching the name",
+			cfg: config.Metric{
+				Name:       "http_request_duration",
+				Type:       "histogram",
+				Unit:       "seconds",
+				ValueIndex: new(uint(0)),
+			},
+			logLines:  make([]string, 0),
+			metricErr: `metric name "http_request_duration" must end with the unit suffix "_seconds"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			met, err := metric.New(tc.cfg)
+			if err != nil {
+				if tc.metricErr != "" {
+					require.EqualError(t, err, tc.metricErr)
+				} else {
+					require.NoError(t, err)
+				}
+
+				return
+			}
+
+			for _, line := range tc.logLines {
+				err := met.Parse(strings.Split(line, "\t"))
+				if err != nil {
+					if tc.parseErr != "" {
+						require.EqualError(t, err, tc.parseErr)
+					} else {
+						require.NoError(t, err)
+					}
+
+					return
+				}
+			}
+
+			require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(strings.TrimSpace(tc.metrics)+"\n")))
+		})
+	}
+}
+
+func TestMetricValueRegexp(t *testing.T) {
+	t.Parallel()
+
+	mismatches := prometheus.NewCounter(prometheus.CounterOpts{Name: "log_value_regexp_mismatches_total"})
+
+	met, err := metric.New(config.Metric{
+		Name:             "http_request_duration_seconds",
+		Type:             "histogram",
+		Help:             "The time spent on processing the request.",
+		ValueRegexp:      regexp.MustCompile(`took=([0-9.]+)s`),
+		ValueRegexpMatch: 1,
+		Buckets:          []float64{.1, 1},
+		Labels: []config.Label{
+			{
+				Name:      "host",
+				LineIndex: 0,
+			},
+		},
+	}, metric.WithValueRegexpMismatchCounter(mismatches))
+	require.NoError(t, err)
+
+	// The second match is the total duration, the first one the upstream duration.
+	require.NoError(t, met.Parse([]string{"example.com upstream took=0.05s total took=0.25s"}))
+	require.NoError(t, met.Parse(strings.Split("example.com\tupstream took=0.5s\ttotal took=0.75s", "\t")))
+	require.NoError(t, met.Parse([]string{"example.com total took=0.25s"}))
+	require.NoError(t, met.Parse([]string{"example.com no duration"}))
+	require.Error(t, met.Parse([]string{"example.com took=.s took=.s"}))
+
+	require.InDelta(t, 2, testutil.ToFloat64(mismatches), 0)
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_request_duration_seconds The time spent on processing the request.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{host="example.com upstream took=0.05s total took=0.25s",le="0.1"} 0
+http_request_duration_seconds_bucket{host="example.com upstream took=0.05s total took=0.25s",le="1"} 1
+http_request_duration_seconds_bucket{host="example.com upstream took=0.05s total took=0.25s",le="+Inf"} 1
+http_request_duration_seconds_sum{host="example.com upstream took=0.05s total took=0.25s"} 0.25
+http_request_duration_seconds_count{host="example.com upstream took=0.05s total took=0.25s"} 1
+http_request_duration_seconds_bucket{host="example.com",le="0.1"} 0
+http_request_duration_seconds_bucket{host="example.com",le="1"} 1
+http_request_duration_seconds_bucket{host="example.com",le="+Inf"} 1
+http_request_duration_seconds_sum{host="example.com"} 0.75
+http_request_duration_seconds_count{host="example.com"} 1
+`)))
+}
+
+func TestMetricValueExpression(t *testing.T) {
+	t.Parallel()
+
+	valueIndex := uint(1)
+
+	cfg := config.Metric{
+		Name:            "http_response_size_ratio",
+		Type:            "gauge",
+		Help:            "Ratio of the response body size to the total response size.",
+		ValueIndex:      &valueIndex,
+		ValueExpression: "value / fields[2]",
+		Labels: []config.Label{
+			{
+				Name:      "host",
+				LineIndex: 0,
+			},
+		},
+	}
+
+	met, err := metric.New(cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, met.Parse([]string{"example.com", "512", "1024"}))
+	require.NoError(t, met.Parse([]string{"example.org", "", "1024"}))
+	require.ErrorContains(t, met.Parse([]string{"example.org", "512", "0"}), "result is not a finite number")
+	require.ErrorContains(t, met.Parse([]string{"example.org", "512", "-"}), `failed to parse fields[2] "-"`)
+	require.ErrorContains(t, met.Parse([]string{"example.org", "512"}), "line index out of range for fields[2]")
+
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_response_size_ratio Ratio of the response body size to the total response size.
+# TYPE http_response_size_ratio gauge
+http_response_size_ratio{host="example.com"} 0.5
+`)))
+
+	require.Equal(t, "0.25", met.Trace([]string{"example.com", "256", "1024"}).Value)
+
+	for expression, expected := range map[string]string{
+		"(value - fields[2]) * -2 + 1.5 / 3": "",
+		"value / os.Getenv(1)":               "unknown identifier \"os\"",
+		"exec(value)":                        "unknown identifier \"exec\"",
+		"value; 1":                           "unexpected ';'",
+		"fields[-1]":                         "invalid field index",
+		"value +":                            "unexpected end",
+		"((value)":                           "missing ')'",
+		strings.Repeat("(", 20) + "value" + strings.Repeat(")", 20): "nesting exceeds a depth of 16",
+		strings.Repeat("value+", 50) + "value":                      "exceeds 256 characters",
+	} {
+		cfg.ValueExpression = expression
+
+		_, err := metric.New(cfg)
+		if expected == "" {
+			require.NoError(t, err, expression)
+		} else {
+			require.ErrorContains(t, err, expected, expression)
+		}
+	}
+}
+
+func TestMetricBucketSet(t *testing.T) {
+	t.Parallel()
+
+	bucketSets := map[string]types.Float64Slice{"latency": {.1, 1}}
+
+	met, err := metric.New(config.Metric{
+		Name:       "http_request_duration_seconds",
+		Type:       "histogram",
+		Help:       "The time spent on processing the request.",
+		ValueIndex: new(uint(0)),
+		BucketSet:  "latency",
+	}, metric.WithBucketSets(bucketSets))
+	require.NoError(t, err)
+	require.NoError(t, met.Parse([]string{"0.5"}))
+
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_request_duration_seconds The time spent on processing the request.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="0.1"} 0
+http_request_duration_seconds_bucket{le="1"} 1
+http_request_duration_seconds_bucket{le="+Inf"} 1
+http_request_duration_seconds_sum 0.5
+http_request_duration_seconds_count 1
+`)))
+
+	// Buckets of the metric take precedence over the bucket set.
+	met, err = metric.New(config.Metric{
+		Name:       "http_request_duration_seconds",
+		Type:       "histogram",
+		Help:       "The time spent on processing the request.",
+		ValueIndex: new(uint(0)),
+		Buckets:    []float64{10},
+		BucketSet:  "latency",
+	}, metric.WithBucketSets(bucketSets))
+	require.NoError(t, err)
+	require.NoError(t, met.Parse([]string{"0.5"}))
+
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_request_duration_seconds The time spent on processing the request.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="10"} 1
+http_request_duration_seconds_bucket{le="+Inf"} 1
+http_request_duration_seconds_sum 0.5
+http_request_duration_seconds_count 1
+`)))
+
+	_, err = metric.New(config.Metric{
+		Name:       "http_request_duration_seconds",
+		Type:       "histogram",
+		ValueIndex: new(uint(0)),
+		BucketSet:  "size",
+	}, metric.WithBucketSets(bucketSets))
+	require.EqualError(t, err, "bucket set 'size' not found")
+}
+
+func TestMetricUnitOpenMetrics(t *testing.T) {
+	t.Parallel()
+
+	met, err := metric.New(config.Metric{
+		Name:       "http_response_size_bytes_total",
+		Type:       "counter",
+		Help:       "The total number of bytes sent to clients.",
+		Unit:       "bytes",
+		ValueIndex: new(uint(0)),
+	})
+	require.NoError(t, err)
+	require.NoError(t, met.Parse([]string{"1024"}))
+
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(met))
+
+	metricFamilies, err := reg.Gather()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+
+	encoder := expfmt.NewEncoder(&buf, expfmt.NewFormat(expfmt.TypeOpenMetrics))
+	for _, metricFamily := range metricFamilies {
+		require.NoError(t, encoder.Encode(metricFamily))
+	}
+
+	require.Contains(t, buf.String(), "# UNIT http_response_size_bytes bytes\n")
+}
+
+func TestMetricBucketOverridesLabelTransformation(t *testing.T) {
+	t.Parallel()
+
+	newMetric := func(values []string, maxCardinality uint) *metric.Metric {
+		t.Helper()
+
+		met, err := metric.New(config.Metric{
+			Name:           "http_request_duration_seconds",
+			Type:           "histogram",
+			Help:           "The time spent on processing the request.",
+			ValueIndex:     new(uint(1)),
+			Buckets:        []float64{.1, 1},
+			MaxCardinality: maxCardinality,
+			BucketOverrides: []config.BucketOverride{
+				{
+					LineIndex: 0,
+					Values:    values,
+					Buckets:   []float64{1, 10},
+				},
+			},
+			Labels: []config.Label{
+				{
+					Name:      "status",
+					LineIndex: 0,
+					Ranges: []config.LabelRange{
+						{Max: 499, Value: "ok"},
+						{Max: 599, Value: "5xx"},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		return met
+	}
+
+	gather := func(met *metric.Metric) string {
+		t.Helper()
+
+		reg := prometheus.NewPedanticRegistry()
+		require.NoError(t, reg.Register(met))
+
+		metricFamilies, err := reg.Gather()
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+
+		encoder := expfmt.NewEncoder(&buf, expfmt.NewFormat(expfmt.TypeTextPlain))
+		for _, metricFamily := range metricFamilies {
+			require.NoError(t, encoder.Encode(metricFamily))
+		}
+
+		return buf.String()
+	}
+
+	// The override matches the label value, so 500 and 503 share the series in the histogram of the metric.
+	met := newMetric([]string{"500"}, 0)
+	require.NoError(t, met.Parse([]string{"500", "0.5"}))
+	require.NoError(t, met.Parse([]string{"503", "5"}))
+	require.Contains(t, gather(met), `http_request_duration_seconds_bucket{status="5xx",le="0.1"} 0`)
+
+	met = newMetric([]string{"5xx"}, 0)
+	require.NoError(t, met.Parse([]string{"500", "0.5"}))
+	require.NoError(t, met.Parse([]string{"503", "5"}))
+	require.Contains(t, gather(met), `http_request_duration_seconds_bucket{status="5xx",le="10"} 2`)
+
+	// The overflow series always uses the buckets of the metric.
+	met = newMetric([]string{"5xx"}, 1)
+	require.NoError(t, met.Parse([]string{"200", "0.05"}))
+	require.NoError(t, met.Parse([]string{"500", "0.5"}))
+	require.NoError(t, met.Parse([]string{"200", "0.5"}))
+
+	metrics := gather(met)
+	require.Contains(t, metrics, `http_request_duration_seconds_bucket{overflow="true",status="",le="0.1"} 0`)
+	require.Contains(t, metrics, `http_request_duration_seconds_bucket{overflow="",status="ok",le="1"} 2`)
+}
+
+func TestMetricNativeHistogram(t *testing.T) {
+	t.Parallel()
+
+	met, err := metric.New(config.Metric{
+		Name:                           "http_response_duration_seconds",
+		Type:                           "histogram",
+		Help:                           "The time spent on sending the response.",
+		ValueIndex:                     new(uint(1)),
+		Buckets:                        []float64{0.1, 1},
+		NativeHistogram:                true,
+		NativeHistogramMaxBucketNumber: 100,
+		Labels: []config.Label{
+			{Name: "host", LineIndex: 0},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, met.Parse([]string{"example.com", "0.25"}))
+	require.NoError(t, met.Parse([]string{"example.com", "0.75"}))
+
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(met))
+
+	metricFamilies, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, metricFamilies, 1)
+
+	histogram := metricFamilies[0].GetMetric()[0].GetHistogram()
+	require.Equal(t, uint64(2), histogram.GetSampleCount())
+	require.InDelta(t, 1.0, histogram.GetSampleSum(), 0)
+	require.NotEmpty(t, histogram.GetPositiveSpan(), "native histogram has no buckets")
+	require.Empty(t, histogram.GetBucket(), "classic buckets are exposed")
+
+	var buf bytes.Buffer
+
+	encoder := expfmt.NewEncoder(&buf, expfmt.NewFormat(expfmt.TypeOpenMetrics))
+	for _, metricFamily := range metricFamilies {
+		require.NoError(t, encoder.Encode(metricFamily))
+	}
+
+	require.Contains(t, buf.String(), `http_response_duration_seconds_count{host="example.com"} 2`)
+}
+
+func TestMetricExemplar(t *testing.T) {
+	t.Parallel()
+
+	met, err := metric.New(config.Metric{
+		Name:               "http_request_duration_seconds",
+		Type:               "histogram",
+		Help:               "The time spent on processing the request.",
+		ValueIndex:         new(uint(1)),
+		Buckets:            []float64{0.1, 1},
+		ExemplarLabelIndex: new(uint(2)),
+		Labels: []config.Label{
+			{Name: "host", LineIndex: 0},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, met.Parse([]string{"example.com", "0.05", "-"}))
+	require.NoError(t, met.Parse([]string{"example.com", "0.5", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}))
+
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(met))
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+
+	require.Regexp(t, `http_request_duration_seconds_bucket\{host="example.com",le="1.0"\} 2 # \{trace_id="4bf92f3577b34da6a3ce929d0e0e4736"\} 0.5 `, body)
+	require.NotRegexp(t, `le="0.1"\} 1 #`, body, "exemplar of a line without trace ID")
+}
+
+func TestMetricQuarantine(t *testing.T) {
+	t.Parallel()
+
+	quarantined := prometheus.NewCounter(prometheus.CounterOpts{Name: "log_series_quarantined_total"})
+
+	met, err := metric.New(config.Metric{
+		Name:                "http_request_duration_seconds_total",
+		Type:                "counter",
+		Help:                "The total time spent on processing requests.",
+		ValueIndex:          new(uint(1)),
+		QuarantineThreshold: 3,
+		Labels: []config.Label{
+			{
+				Name:      "host",
+				LineIndex: 0,
+			},
+		},
+	}, metric.WithQuarantineCounter(quarantined))
+	require.NoError(t, err)
+
+	// A successful parse resets the consecutive failures.
+	for _, line := range []string{"good.example.com\t1", "good.example.com\tinvalid", "good.example.com\tinvalid", "good.example.com\t1"} {
+		_ = met.Parse(strings.Split(line, "\t"))
+	}
+
+	require.NoError(t, met.Parse(strings.Split("bad.example.com\t1", "\t")))
+
+	for range 3 {
+		require.Error(t, met.Parse(strings.Split("bad.example.com\tinvalid", "\t")))
+	}
+
+	// Quarantined label sets are skipped without errors, even if the value is valid.
+	require.NoError(t, met.Parse(strings.Split("bad.example.com\tinvalid", "\t")))
+	require.NoError(t, met.Parse(strings.Split("bad.example.com\t1", "\t")))
+
+	require.InDelta(t, 1, testutil.ToFloat64(quarantined), 0)
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_request_duration_seconds_total The total time spent on processing requests.
+# TYPE http_request_duration_seconds_total counter
+http_request_duration_seconds_total{host="good.example.com"} 2
+`)))
+}
+
+func TestMetricSeriesTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+
+	met, err := metric.New(config.Metric{
+		Name:      "http_requests_total",
+		Type:      "counter",
+		Help:      "The total number of client requests.",
+		SeriesTTL: 10 * time.Minute,
+		Labels: []config.Label{
+			{
+				Name:      "host",
+				LineIndex: 0,
+			},
+		},
+	}, metric.WithClock(func() time.Time { return now }))
+	require.NoError(t, err)
+
+	require.NoError(t, met.Parse([]string{"old.example.com"}))
+
+	now = now.Add(5 * time.Minute)
+
+	require.NoError(t, met.Parse([]string{"new.example.com"}))
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{host="new.example.com"} 1
+http_requests_total{host="old.example.com"} 1
+`)))
+
+	now = now.Add(6 * time.Minute)
+
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{host="new.example.com"} 1
+`)))
+
+	// An expired series starts from scratch once observed again.
+	require.NoError(t, met.Parse([]string{"old.example.com"}))
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{host="new.example.com"} 1
+http_requests_total{host="old.example.com"} 1
+`)))
+}
+
+func TestMetricUpstreamsActiveWindow(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+
+	met, err := metric.New(config.Metric{
+		Name:       "http_upstream_response_duration_seconds_total",
+		Type:       "counter",
+		Help:       "The time spent on receiving the response from the upstream server",
+		ValueIndex: new(uint(2)),
+		Upstream: config.Upstream{
+			Enabled:       true,
+			AddrLineIndex: 1,
+			ActiveMetric:  "http_upstreams_active",
+			ActiveWindow:  10 * time.Minute,
+		},
+		Labels: []config.Label{
+			{
+				Name:      "host",
+				LineIndex: 0,
+			},
+		},
+	}, metric.WithClock(func() time.Time { return now }))
+	require.NoError(t, err)
+
+	require.NoError(t, met.Parse([]string{"api.example.com", "10.0.1.5:8080, 10.0.1.6:8080", "0.1, 0.1"}))
+	require.NoError(t, met.Parse([]string{"web.example.org", "10.0.1.7:8080", "0.1"}))
+
+	now = now.Add(5 * time.Minute)
+
+	require.NoError(t, met.Parse([]string{"api.example.com", "10.0.1.5:8080", "0.1"}))
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_upstreams_active Number of distinct upstream servers observed
+# TYPE http_upstreams_active gauge
+http_upstreams_active{host="api.example.com"} 2
+http_upstreams_active{host="web.example.org"} 1
+`), "http_upstreams_active"))
+
+	// 10.0.1.6:8080 left the pool of api.example.com and web.example.org received no more requests.
+	now = now.Add(6 * time.Minute)
+
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_upstreams_active Number of distinct upstream servers observed
+# TYPE http_upstreams_active gauge
+http_upstreams_active{host="api.example.com"} 1
+`), "http_upstreams_active"))
+
+	now = now.Add(time.Minute)
+
+	require.NoError(t, met.Parse([]string{"api.example.com", "10.0.1.6:8080", "0.1"}))
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_upstreams_active Number of distinct upstream servers observed
+# TYPE http_upstreams_active gauge
+http_upstreams_active{host="api.example.com"} 2
+`), "http_upstreams_active"))
+}
+
+func TestMetricSeriesTTLActiveUpstreams(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+
+	met, err := metric.New(config.Metric{
+		Name:       "http_upstream_response_duration_seconds_total",
+		Type:       "counter",
+		Help:       "The time spent on receiving the response from the upstream server",
+		ValueIndex: new(uint(2)),
+		SeriesTTL:  10 * time.Minute,
+		Upstream: config.Upstream{
+			Enabled:       true,
+			AddrLineIndex: 1,
+			Label:         true,
+			ActiveMetric:  "http_upstreams_active",
+			ActiveWindow:  time.Hour,
+		},
+		Labels: []config.Label{
+			{
+				Name:      "host",
+				LineIndex: 0,
+			},
+		},
+	}, metric.WithClock(func() time.Time { return now }))
+	require.NoError(t, err)
+
+	require.NoError(t, met.Parse([]string{"api.example.com", "10.0.1.5:8080", "0.1"}))
+	require.NoError(t, met.Parse([]string{"web.example.org", "10.0.1.7:8080", "0.1"}))
+
+	now = now.Add(5 * time.Minute)
+
+	require.NoError(t, met.Parse([]string{"api.example.com", "10.0.1.6:8080", "0.1"}))
+
+	now = now.Add(6 * time.Minute)
+
+	// The upstreams of expired series are dropped from the gauge, even within the active window.
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_upstreams_active Number of distinct upstream servers observed
+# TYPE http_upstreams_active gauge
+http_upstreams_active{host="api.example.com"} 1
+`), "http_upstreams_active"))
+}
+
+func TestMetricResetOnCollect(t *testing.T) {
+	t.Parallel()
+
+	met, err := metric.New(config.Metric{
+		Name:           "http_requests_total",
+		Type:           "counter",
+		Help:           "The total number of client requests.",
+		ResetOnCollect: true,
+		Labels: []config.Label{
+			{
+				Name:      "host",
+				LineIndex: 0,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, met.Parse([]string{"example.com"}))
+	require.NoError(t, met.Parse([]string{"example.com"}))
+	require.NoError(t, met.Parse([]string{"example.org"}))
+
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{host="example.com"} 2
+http_requests_total{host="example.org"} 1
+`)))
+
+	require.NoError(t, met.Parse([]string{"example.com"}))
+
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{host="example.com"} 1
+`)))
+
+	_, err = metric.New(config.Metric{
+		Name:           "http_requests_in_flight",
+		Type:           "gauge",
+		ValueIndex:     new(uint(0)),
+		ResetOnCollect: true,
+	})
+	require.EqualError(t, err, "resetOnCollect can only be used with counter and histogram metrics")
+}
+
+func TestMetricResetOnCollectActiveUpstreams(t *testing.T) {
+	t.Parallel()
+
+	met, err := metric.New(config.Metric{
+		Name:           "http_upstream_response_duration_seconds_total",
+		Type:           "counter",
+		Help:           "The time spent on receiving the response from the upstream server",
+		ValueIndex:     new(uint(2)),
+		ResetOnCollect: true,
+		Upstream: config.Upstream{
+			Enabled:       true,
+			AddrLineIndex: 1,
+			ActiveMetric:  "http_upstreams_active",
+		},
+		Labels: []config.Label{
+			{
+				Name:      "host",
+				LineIndex: 0,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, met.Parse([]string{"api.example.com", "10.0.1.5:8080, 10.0.1.6:8080", "0.1, 0.1"}))
+	require.NoError(t, met.Parse([]string{"web.example.org", "10.0.1.7:8080", "0.1"}))
+
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_upstreams_active Number of distinct upstream servers observed
+# TYPE http_upstreams_active gauge
+http_upstreams_active{host="api.example.com"} 2
+http_upstreams_active{host="web.example.org"} 1
+`), "http_upstreams_active"))
+
+	require.NoError(t, met.Parse([]string{"api.example.com", "10.0.1.5:8080", "0.1"}))
+
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_upstreams_active Number of distinct upstream servers observed
+# TYPE http_upstreams_active gauge
+http_upstreams_active{host="api.example.com"} 1
+`), "http_upstreams_active"))
+}
+
+func TestMetricMaxCardinality(t *testing.T) {
+	t.Parallel()
+
+	met, err := metric.New(config.Metric{
+		Name:           "http_requests_total",
+		Type:           "counter",
+		Help:           "The total number of client requests.",
+		MaxCardinality: 2,
+		Labels: []config.Label{
+			{
+				Name:      "path",
+				LineIndex: 0,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	for _, path := range []string{"/a", "/b", "/c", "/d", "/a", "/c"} {
+		require.NoError(t, met.Parse([]string{path}))
+	}
+
+	// Known label sets keep their series, new ones beyond the cap end up in the overflow series.
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{overflow="",path="/a"} 2
+http_requests_total{overflow="",path="/b"} 1
+http_requests_total{overflow="true",path=""} 3
+`)))
+
+	_, err = metric.New(config.Metric{
+		Name:           "http_requests_total",
+		Type:           "counter",
+		MaxCardinality: 2,
+		Labels: []config.Label{
+			{
+				Name:      "overflow",
+				LineIndex: 0,
+			},
+		},
+	})
+	require.EqualError(t, err, `duplicate label name "overflow"`)
+}
+
+func TestMetricMaxCardinalityActiveUpstreams(t *testing.T) {
+	t.Parallel()
+
+	met, err := metric.New(config.Metric{
+		Name:           "http_upstream_response_duration_seconds_total",
+		Type:           "counter",
+		Help:           "The time spent on receiving the response from the upstream server",
+		ValueIndex:     new(uint(2)),
+		MaxCardinality: 1,
+		Upstream: config.Upstream{
+			Enabled:       true,
+			AddrLineIndex: 1,
+			ActiveMetric:  "http_upstreams_active",
+		},
+		Labels: []config.Label{
+			{
+				Name:      "host",
+				LineIndex: 0,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, met.Parse([]string{"a.example.com", "10.0.1.5:8080", "0.1"}))
+	require.NoError(t, met.Parse([]string{"b.example.com", "10.0.1.6:8080", "0.1"}))
+	require.NoError(t, met.Parse([]string{"c.example.com", "10.0.1.7:8080", "0.1"}))
+
+	// Label sets beyond the cap are counted in the overflow series of the gauge as well.
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_upstreams_active Number of distinct upstream servers observed
+# TYPE http_upstreams_active gauge
+http_upstreams_active{host="",overflow="true"} 2
+http_upstreams_active{host="a.example.com",overflow=""} 1
+`), "http_upstreams_active"))
+}
+
+func TestMetricHashBuckets(t *testing.T) {
+	t.Parallel()
+
+	const buckets = 8
+
+	cfg := config.Metric{
+		Name: "http_requests_total",
+		Type: "counter",
+		Help: "The total number of client requests.",
+		Labels: []config.Label{
+			{
+				Name:        "path",
+				LineIndex:   0,
+				HashBuckets: buckets,
+			},
+		},
+	}
+
+	newMetric := func() *metric.Metric {
+		t.Helper()
+
+		met, err := metric.New(cfg)
+		require.NoError(t, err)
+
+		for i := range 1000 {
+			require.NoError(t, met.Parse([]string{"/path/" + strconv.Itoa(i)}))
+		}
+
+		return met
+	}
+
+	met := newMetric()
+
+	// All values end up in exactly K buckets.
+	require.Equal(t, buckets, testutil.CollectAndCount(met))
+
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(met))
+
+	metricFamilies, err := reg.Gather()
+	require.NoError(t, err)
+
+	var total float64
+
+	for _, series := range metricFamilies[0].GetMetric() {
+		require.Regexp(t, `^value_bucket_[0-7]$`, series.GetLabel()[0].GetValue())
+		require.Positive(t, series.GetCounter().GetValue())
+
+		total += series.GetCounter().GetValue()
+	}
+
+	require.InDelta(t, 1000, total, 0)
+
+	// The same values map to the same buckets in a new metric, e.g. after a restart.
+	expected, err := testutil.CollectAndFormat(met, expfmt.TypeTextPlain, "http_requests_total")
+	require.NoError(t, err)
+
+	actual, err := testutil.CollectAndFormat(newMetric(), expfmt.TypeTextPlain, "http_requests_total")
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(actual))
+
+	met, err = metric.New(cfg)
+	require.NoError(t, err)
+
+	for _, path := range []string{"/api", "/login", "/static", "/api"} {
+		require.NoError(t, met.Parse([]string{path}))
+	}
+
+	require.NoError(t, testutil.CollectAndCompare(met, strings.NewReader(`
+# HELP http_requests_total The total number of client requests.
+# TYPE http_requests_total counter
+http_requests_total{path="value_bucket_2"} 2
+http_requests_total{path="value_bucket_3"} 1
+http_requests_total{path="value_bucket_4"} 1
+`)))
+
+	cfg.Labels[0].Allowlist = []string{"/api"}
+
+	_, err = metric.New(cfg)
+	require.EqualError(t, err, "label 'path': hashBuckets and allowlist are mutually exclusive")
 }
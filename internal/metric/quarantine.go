@@ -0,0 +1,111 @@
+package metric
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// quarantine tracks consecutive value parse failures per label set.
+// Label sets reaching the threshold are quarantined and skipped from then on.
+type quarantine struct {
+	failures  map[string]uint
+	mu        sync.Mutex
+	threshold uint
+}
+
+func newQuarantine(threshold uint) *quarantine {
+	return &quarantine{
+		failures:  make(map[string]uint),
+		threshold: threshold,
+	}
+}
+
+// key returns a unique key for the given label values.
+func (q *quarantine) key(labels []string) string {
+	return strings.Join(labels, "\xff")
+}
+
+// isQuarantined reports whether the label set has been quarantined.
+func (q *quarantine) isQuarantined(key string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.failures[key] >= q.threshold
+}
+
+// failure records a parse failure for the label set and reports whether the label set became quarantined.
+func (q *quarantine) failure(key string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.failures[key]++
+
+	return q.failures[key] == q.threshold
+}
+
+// success resets the consecutive failures of the label set.
+func (q *quarantine) success(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.failures, key)
+}
+
+// quarantineSeries drops the series of the label set and counts the quarantined label set.
+func (m *Metric) quarantineSeries(labels []string) {
+	// The label values are not yet completed by limitCardinality, so add the overflow label of regular series.
+	if m.cardinality != nil {
+		labels = append(labels, "")
+	}
+
+	m.deleteSeries(labels)
+
+	if m.quarantined != nil {
+		m.quarantined.Inc()
+	}
+}
+
+// deleteSeries drops the series of the label set from the metric, its companions, the gaugeWhen gauge,
+// the bucketOverrides histograms and the active upstreams gauge.
+// If maxCardinality is configured, the label values must include the overflow label.
+func (m *Metric) deleteSeries(labels []string) {
+	m.releaseCardinality(labels)
+	m.forgetUpstreams(labels)
+
+	collectors := append([]prometheus.Collector{m.metric}, m.companions...)
+	if m.gaugeWhen != nil {
+		collectors = append(collectors, m.gaugeWhen)
+	}
+
+	collectors = append(collectors, m.bucketOverrides...)
+
+	for _, collector := range collectors {
+		switch metric := collector.(type) {
+		case *prometheus.CounterVec:
+			metric.DeleteLabelValues(labels...)
+		case *prometheus.GaugeVec:
+			metric.DeleteLabelValues(labels...)
+		case *prometheus.HistogramVec:
+			metric.DeleteLabelValues(labels...)
+		case *prometheus.SummaryVec:
+			metric.DeleteLabelValues(labels...)
+		}
+	}
+}
+
+// forgetUpstreams drops the upstreams of the label set from the active upstreams gauge, if configured.
+// With the upstream label, only the upstream of the series is dropped, since the other upstreams have their own series.
+func (m *Metric) forgetUpstreams(labels []string) {
+	if m.upstreams == nil {
+		return
+	}
+
+	var upstream string
+	if m.cfg.Upstream.Label {
+		upstream = labels[len(m.cfg.Labels)]
+	}
+
+	m.upstreams.forget(m.upstreamLabels(labels), upstream)
+}
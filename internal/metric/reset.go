@@ -0,0 +1,62 @@
+package metric
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// addWithReset adds value to the counter of the label set. If the sum would exceed the configured resetThreshold,
+// the series is recreated starting from value. Prometheus detects the drop as a regular counter reset,
+// so functions like rate() and increase() are not affected, while the precision of the float64 stays intact.
+func (m *Metric) addWithReset(counterVec *prometheus.CounterVec, value float64, labels []string) error {
+	m.resetMu.Lock()
+	defer m.resetMu.Unlock()
+
+	var current dto.Metric
+	if err := counterVec.WithLabelValues(labels...).Write(&current); err != nil {
+		return fmt.Errorf("could not read counter value: %w", err)
+	}
+
+	// Compare against the remaining headroom, since the sum itself may already be rounded.
+	if current.GetCounter().GetValue() > m.cfg.ResetThreshold-value {
+		counterVec.DeleteLabelValues(labels...)
+	}
+
+	counterVec.WithLabelValues(labels...).Add(value)
+
+	return nil
+}
+
+// resetSeries drops all series of the metric, its companions, the gaugeWhen gauge, the bucketOverrides histograms
+// and the active upstreams gauge, so the next scrape only exposes the observations in between, see resetOnCollect.
+func (m *Metric) resetSeries() {
+	collectors := append([]prometheus.Collector{m.metric}, m.companions...)
+	if m.gaugeWhen != nil {
+		collectors = append(collectors, m.gaugeWhen)
+	}
+
+	collectors = append(collectors, m.bucketOverrides...)
+
+	for _, collector := range collectors {
+		switch metric := collector.(type) {
+		case *prometheus.CounterVec:
+			metric.Reset()
+		case *prometheus.GaugeVec:
+			metric.Reset()
+		case *prometheus.HistogramVec:
+			metric.Reset()
+		case *prometheus.SummaryVec:
+			metric.Reset()
+		}
+	}
+
+	if m.cardinality != nil {
+		m.cardinality.reset()
+	}
+
+	if m.upstreams != nil {
+		m.upstreams.reset()
+	}
+}
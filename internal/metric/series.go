@@ -0,0 +1,64 @@
+package metric
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// seriesTracker tracks the last observation of each label set, so series untouched for longer than the TTL
+// can be removed on [Metric.Collect].
+type seriesTracker struct {
+	lastSeen map[string]trackedSeries
+	now      func() time.Time
+	mu       sync.Mutex
+	ttl      time.Duration
+}
+
+type trackedSeries struct {
+	lastSeen time.Time
+	labels   []string
+}
+
+func newSeriesTracker(ttl time.Duration, now func() time.Time) *seriesTracker {
+	return &seriesTracker{
+		lastSeen: make(map[string]trackedSeries),
+		now:      now,
+		ttl:      ttl,
+	}
+}
+
+// touch records an observation of the label set. The label values are copied, since they are reused by the pool.
+func (s *seriesTracker) touch(labels []string) {
+	key := strings.Join(labels, "\xff")
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if series, ok := s.lastSeen[key]; ok {
+		series.lastSeen = now
+		s.lastSeen[key] = series
+
+		return
+	}
+
+	s.lastSeen[key] = trackedSeries{lastSeen: now, labels: append([]string(nil), labels...)}
+}
+
+// expire calls deleteFn for each label set not observed within the TTL and stops tracking it.
+// The lock is held while deleting, so a concurrent observation either happens before and keeps the series,
+// or after and recreates it.
+func (s *seriesTracker) expire(deleteFn func(labels []string)) {
+	deadline := s.now().Add(-s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, series := range s.lastSeen {
+		if series.lastSeen.Before(deadline) {
+			deleteFn(series.labels)
+			delete(s.lastSeen, key)
+		}
+	}
+}
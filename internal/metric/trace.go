@@ -0,0 +1,91 @@
+package metric
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Trace extracts the labels and value from a log line like [Metric.Parse] does, but without updating the metric.
+// It's intended for debugging field offsets and is guaranteed to be thread-safe.
+func (m *Metric) Trace(line []string) TraceResult {
+	result := TraceResult{
+		Metric: m.cfg.Name,
+	}
+
+	skip, err := m.shouldDrop(line)
+	if err != nil {
+		result.Error = err.Error()
+
+		return result
+	}
+
+	if skip {
+		result.Skipped = true
+
+		return result
+	}
+
+	value, skip, err := m.validateAndExtractValue(line)
+	if err != nil {
+		result.Error = err.Error()
+
+		return result
+	}
+
+	if m.cfg.RatioIndices != nil && !skip {
+		var ratio float64
+
+		ratio, skip, err = m.extractRatio(line)
+		if err != nil {
+			result.Error = err.Error()
+
+			return result
+		}
+
+		value = strconv.FormatFloat(m.applyMathTransformations(ratio), 'g', -1, 64)
+	}
+
+	if skip {
+		result.Skipped = true
+
+		return result
+	}
+
+	if m.expression != nil && strings.TrimSpace(value) != "" {
+		evaluated, _, err := m.evalExpression(line, value)
+		if err != nil {
+			result.Error = err.Error()
+
+			return result
+		}
+
+		value = strconv.FormatFloat(m.applyMathTransformations(evaluated), 'g', -1, 64)
+	}
+
+	// Values of upstream metrics are lists, which are parsed element by element.
+	if value != "" && !m.cfg.Upstream.Enabled {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+			result.Error = fmt.Sprintf("failed to parse value %q: %v", value, err)
+
+			return result
+		}
+	}
+
+	labels := make([]string, len(m.cfg.Labels))
+
+	if err := m.processLabels(line, labels); err != nil {
+		result.Error = err.Error()
+
+		return result
+	}
+
+	result.Labels = make(map[string]string, len(labels))
+	for i, label := range m.cfg.Labels {
+		result.Labels[label.Name] = labels[i]
+	}
+
+	result.Value = value
+
+	return result
+}
@@ -2,16 +2,51 @@ package metric
 
 import (
 	"sync"
+	"time"
 
 	"github.com/jkroepke/access-log-exporter/internal/config"
+	"github.com/jkroepke/access-log-exporter/internal/config/types"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/ua-parser/uap-go/uaparser"
 )
 
 type Metric struct {
-	metric     prometheus.Collector
-	ua         *uaparser.Parser
-	labelsPool *sync.Pool // Pool for reusing label value slices in a thread-safe way
+	metric           prometheus.Collector
+	companions       []prometheus.Collector
+	gaugeWhen        prometheus.Collector   // Set if gaugeWhen is configured, see [Metric.observationCollector]
+	bucketOverrides  []prometheus.Collector // One histogram per bucketOverrides entry, see [Metric.observationCollector]
+	overrideLabels   []int                  // Index of the label compared with the values of each bucketOverrides entry
+	observed         prometheus.Counter
+	quarantined      prometheus.Counter
+	regexpMismatches prometheus.Counter
+	quarantine       *quarantine
+	upstreams        *upstreamTracker
+	series           *seriesTracker    // Set if seriesTTL is configured
+	cardinality      *cardinalityLimit // Set if maxCardinality is configured
+	expression       *expression       // Set if valueExpression is configured, see [Metric.handleExpression]
+	overflowLabels   []string          // Label values of the overflow series, see [Metric.limitCardinality]
+	now              func() time.Time
+	namespace        string             // Prefix of all metric names, see [WithNamespace]
+	counter          prometheus.Counter // Set for counters without dynamic labels and value, see [Metric.Parse]
+	ua               *uaparser.Parser
+	allowlists       []*labelAllowlist             // Indexed like cfg.Labels, nil if no label has an allowlist
+	hashBuckets      []*labelHashBuckets           // Indexed like cfg.Labels, nil if no label has hashBuckets
+	bucketSets       map[string]types.Float64Slice // Only used during New, see [WithBucketSets]
+	labelsPool       *sync.Pool                    // Pool for reusing label value slices in a thread-safe way
+	resetMu          sync.Mutex                    // Serializes counter updates if resetThreshold is set
+	collectMu        sync.RWMutex                  // Excludes Parse during Collect if resetOnCollect is set
 
 	cfg config.Metric
 }
+
+// Option configures optional behavior of a [Metric].
+type Option func(*Metric)
+
+// TraceResult describes the labels and value a [Metric] extracts from a single log line.
+type TraceResult struct {
+	Labels  map[string]string `json:"labels,omitempty"`
+	Metric  string            `json:"metric"`
+	Value   string            `json:"value,omitempty"`
+	Error   string            `json:"error,omitempty"`
+	Skipped bool              `json:"skipped,omitempty"`
+}
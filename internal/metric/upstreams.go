@@ -0,0 +1,133 @@
+package metric
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultUpstreamActiveWindow is the duration an upstream counts as active after its last observation, unless activeWindow is set.
+const defaultUpstreamActiveWindow = 5 * time.Minute
+
+// upstreamTracker counts the distinct upstream servers observed per label set within the active window.
+type upstreamTracker struct {
+	gauge     *prometheus.GaugeVec
+	upstreams map[string]*activeUpstreams
+	now       func() time.Time
+	mu        sync.Mutex
+	window    time.Duration
+}
+
+// activeUpstreams holds the last observation of each upstream of a label set.
+type activeUpstreams struct {
+	lastSeen map[string]time.Time
+	labels   []string
+}
+
+func newUpstreamTracker(name string, constLabels map[string]string, labelKeys []string, window time.Duration, now func() time.Time) *upstreamTracker {
+	if window <= 0 {
+		window = defaultUpstreamActiveWindow
+	}
+
+	return &upstreamTracker{
+		gauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        name,
+			Help:        "Number of distinct upstream servers observed",
+			ConstLabels: constLabels,
+		}, labelKeys),
+		upstreams: make(map[string]*activeUpstreams),
+		now:       now,
+		window:    window,
+	}
+}
+
+// observe records the upstream for the label set and updates the gauge if the upstream wasn't active before.
+// The label values are copied, since they are reused by the pool.
+func (t *upstreamTracker) observe(labels []string, upstream string) {
+	if upstream == "" || upstream == "-" {
+		return
+	}
+
+	key := strings.Join(labels, "\xff")
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	upstreams, ok := t.upstreams[key]
+	if !ok {
+		upstreams = &activeUpstreams{lastSeen: make(map[string]time.Time), labels: append([]string(nil), labels...)}
+		t.upstreams[key] = upstreams
+	}
+
+	_, active := upstreams.lastSeen[upstream]
+	upstreams.lastSeen[upstream] = now
+
+	if !active {
+		t.gauge.WithLabelValues(labels...).Set(float64(len(upstreams.lastSeen)))
+	}
+}
+
+// expire forgets upstreams not observed within the active window and updates the gauge.
+// Label sets without active upstreams are removed from the gauge.
+func (t *upstreamTracker) expire() {
+	deadline := t.now().Add(-t.window)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, upstreams := range t.upstreams {
+		count := len(upstreams.lastSeen)
+
+		for upstream, lastSeen := range upstreams.lastSeen {
+			if lastSeen.Before(deadline) {
+				delete(upstreams.lastSeen, upstream)
+			}
+		}
+
+		switch {
+		case len(upstreams.lastSeen) == 0:
+			t.gauge.DeleteLabelValues(upstreams.labels...)
+			delete(t.upstreams, key)
+		case len(upstreams.lastSeen) != count:
+			t.gauge.WithLabelValues(upstreams.labels...).Set(float64(len(upstreams.lastSeen)))
+		}
+	}
+}
+
+// forget removes the upstream from the label set, e.g. after its series expired. An empty upstream removes the whole label set.
+func (t *upstreamTracker) forget(labels []string, upstream string) {
+	key := strings.Join(labels, "\xff")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	upstreams, ok := t.upstreams[key]
+	if !ok {
+		return
+	}
+
+	if upstream != "" {
+		delete(upstreams.lastSeen, upstream)
+	}
+
+	if upstream == "" || len(upstreams.lastSeen) == 0 {
+		t.gauge.DeleteLabelValues(upstreams.labels...)
+		delete(t.upstreams, key)
+
+		return
+	}
+
+	t.gauge.WithLabelValues(upstreams.labels...).Set(float64(len(upstreams.lastSeen)))
+}
+
+// reset removes all label sets.
+func (t *upstreamTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.gauge.Reset()
+	clear(t.upstreams)
+}
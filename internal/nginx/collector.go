@@ -2,6 +2,8 @@ package nginx
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -9,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -37,8 +40,24 @@ type Collector struct {
 	connectionsWriting  *prometheus.Desc
 	logger              *slog.Logger
 	client              *http.Client
-	scrapeURL           string
+	tlsConfig           *tls.Config
+	targets             []*target
+	username            string
+	password            string
 	timeout             time.Duration
+	cacheDuration       time.Duration
+}
+
+// target is a single stub_status endpoint scraped by [Collector].
+type target struct {
+	cachedAt      time.Time
+	client        *http.Client
+	cachedStats   StubStats
+	cachedVersion string
+	scrapeURL     string
+	requestURL    string   // The scrape URL, or http://unix/ for unix domain sockets
+	labels        []string // The value of the target label, if the collector scrapes multiple targets
+	mu            sync.Mutex
 }
 
 // StubStats represents NGINX stub_status metrics.
@@ -74,61 +93,99 @@ func WithTimeout(timeout time.Duration) Option {
 	}
 }
 
-func New(logger *slog.Logger, scrapeURL string, opts ...Option) *Collector {
+// WithCacheDuration reuses the last successfully scraped stats for duration instead of scraping again,
+// e.g. if multiple Prometheus replicas scrape the exporter. A duration of 0 disables the cache.
+func WithCacheDuration(duration time.Duration) Option {
+	return func(c *Collector) {
+		c.cacheDuration = duration
+	}
+}
+
+// WithBasicAuth authenticates the scrape requests with HTTP basic auth, if username is not empty.
+func WithBasicAuth(username, password string) Option {
+	return func(c *Collector) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// New returns a collector scraping the stub_status pages at scrapeURLs concurrently.
+// If there is more than one URL, all metrics have a target label with the URL of their stub_status page.
+func New(logger *slog.Logger, scrapeURLs []string, opts ...Option) *Collector {
+	var labels []string
+	if len(scrapeURLs) > 1 {
+		labels = []string{"target"}
+	}
+
 	collector := &Collector{
-		scrapeURL: scrapeURL,
-		logger:    logger.With(slog.String("component", "nginx_collector")),
-		client:    http.DefaultClient,
-		timeout:   defaultScrapeTimeout,
-		upMetric: prometheus.NewDesc(
-			"nginx_up",
-			"Whether the NGINX server is up (1) or down (0). 1 means the server is up and metrics are being collected, 0 means the server is down or unreachable.",
-			[]string{"version"}, nil,
-		),
+		logger:   logger.With(slog.String("component", "nginx_collector")),
+		client:   http.DefaultClient,
+		timeout:  defaultScrapeTimeout,
+		upMetric: newUpDesc(labels...),
 		connectionsAccepted: prometheus.NewDesc(
 			"nginx_connections_accepted_total",
 			"Accepted client connections.",
-			nil, nil,
+			labels, nil,
 		),
 		connectionsActive: prometheus.NewDesc(
 			"nginx_connections_active",
 			"Active client connections.",
-			nil, nil,
+			labels, nil,
 		),
 		connectionsHandled: prometheus.NewDesc(
 			"nginx_connections_handled_total",
 			"Handled client connections.",
-			nil, nil,
+			labels, nil,
 		),
 		connectionsReading: prometheus.NewDesc(
 			"nginx_connections_reading",
 			"Connections where NGINX is reading the request header.",
-			nil, nil,
+			labels, nil,
 		),
 		connectionsWaiting: prometheus.NewDesc(
 			"nginx_connections_waiting",
 			"Idle client connections.",
-			nil, nil,
+			labels, nil,
 		),
 		connectionsWriting: prometheus.NewDesc(
 			"nginx_connections_writing",
 			"Connections where NGINX is writing the response back to the client.",
-			nil, nil,
+			labels, nil,
 		),
 	}
 
-	if client, ok := newUnixHTTPClient(scrapeURL); ok {
-		collector.client = client
-		collector.scrapeURL = "http://unix/"
-	}
-
 	for _, opt := range opts {
 		opt(collector)
 	}
 
+	collector.applyTLSConfig()
+
+	collector.targets = make([]*target, len(scrapeURLs))
+	for i, scrapeURL := range scrapeURLs {
+		collector.targets[i] = &target{scrapeURL: scrapeURL, requestURL: scrapeURL, client: collector.client}
+
+		if labels != nil {
+			collector.targets[i].labels = []string{scrapeURL}
+		}
+
+		if client, ok := newUnixHTTPClient(scrapeURL); ok {
+			collector.targets[i].client = client
+			collector.targets[i].requestURL = "http://unix/"
+		}
+	}
+
 	return collector
 }
 
+// newUpDesc returns the descriptor of nginx_up, which [Collector] and [PlusCollector] share.
+func newUpDesc(labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		"nginx_up",
+		"Whether the NGINX server is up (1) or down (0). 1 means the server is up and metrics are being collected, 0 means the server is down or unreachable.",
+		append([]string{"version"}, labels...), nil,
+	)
+}
+
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.upMetric
 
@@ -146,35 +203,64 @@ func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	var wg sync.WaitGroup
+
+	for _, t := range c.targets {
+		wg.Go(func() {
+			c.collectTarget(ch, t)
+		})
+	}
+
+	wg.Wait()
+}
+
+// collectTarget scrapes the stub_status page of t, unless its last stats are cached.
+func (c *Collector) collectTarget(ch chan<- prometheus.Metric, t *target) {
+	if stats, serverVersion, ok := c.cached(t); ok {
+		c.collectStats(ch, t, stats, serverVersion)
+
+		return
+	}
+
 	serverVersion := defaultServerVersion
 
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.scrapeURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.requestURL, nil)
 	if err != nil {
 		c.logger.Error(
 			"Failed to create HTTP request for NGINX metrics",
-			slog.String("url", c.scrapeURL),
+			slog.String("url", t.scrapeURL),
 			slog.Any("error", err),
 		)
 
-		c.collectUp(ch, 0, serverVersion)
+		c.collectUp(ch, t, 0, serverVersion)
 
 		return
 	}
 
 	req.Header.Set("User-Agent", userAgent)
 
-	resp, err := c.client.Do(req)
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := t.client.Do(req)
 	if err != nil {
+		message := "Failed to scrape NGINX metrics"
+		if errors.Is(err, context.DeadlineExceeded) {
+			message = "Timed out scraping NGINX metrics"
+		}
+
 		c.logger.Error(
-			"Failed to scrape NGINX metrics",
-			slog.String("url", c.scrapeURL),
+			message,
+			slog.String("url", t.scrapeURL),
+			slog.Duration("timeout", c.timeout),
 			slog.Any("error", err),
 		)
 
-		c.collectUp(ch, 0, serverVersion)
+		c.collectUp(ch, t, 0, serverVersion)
 
 		return
 	}
@@ -186,11 +272,11 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	if resp.StatusCode != http.StatusOK {
 		c.logger.Error(
 			"NGINX metrics endpoint returned non-200 status code",
-			slog.String("url", c.scrapeURL),
+			slog.String("url", t.scrapeURL),
 			slog.Int("status_code", resp.StatusCode),
 		)
 
-		c.collectUp(ch, 0, serverVersion)
+		c.collectUp(ch, t, 0, serverVersion)
 
 		return
 	}
@@ -204,39 +290,75 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	if err != nil {
 		c.logger.Error(
 			"Failed to parse NGINX metrics",
-			slog.String("url", c.scrapeURL),
+			slog.String("url", t.scrapeURL),
 			slog.Any("error", err),
 		)
 
-		c.collectUp(ch, 0, serverVersion)
+		c.collectUp(ch, t, 0, serverVersion)
 
 		return
 	}
 
-	c.collectUp(ch, 1, serverVersion)
+	c.store(t, stats, serverVersion)
+	c.collectStats(ch, t, stats, serverVersion)
+}
+
+// collectStats collects the metrics of successfully scraped stats.
+func (c *Collector) collectStats(ch chan<- prometheus.Metric, t *target, stats StubStats, serverVersion string) {
+	c.collectUp(ch, t, 1, serverVersion)
 
 	ch <- prometheus.MustNewConstMetric(c.connectionsActive,
-		prometheus.GaugeValue, float64(stats.Connections.Active))
+		prometheus.GaugeValue, float64(stats.Connections.Active), t.labels...)
 
 	ch <- prometheus.MustNewConstMetric(c.connectionsAccepted,
-		prometheus.CounterValue, float64(stats.Connections.Accepted))
+		prometheus.CounterValue, float64(stats.Connections.Accepted), t.labels...)
 
 	ch <- prometheus.MustNewConstMetric(c.connectionsHandled,
-		prometheus.CounterValue, float64(stats.Connections.Handled))
+		prometheus.CounterValue, float64(stats.Connections.Handled), t.labels...)
 
 	ch <- prometheus.MustNewConstMetric(c.connectionsReading,
-		prometheus.GaugeValue, float64(stats.Connections.Reading))
+		prometheus.GaugeValue, float64(stats.Connections.Reading), t.labels...)
 
 	ch <- prometheus.MustNewConstMetric(c.connectionsWriting,
-		prometheus.GaugeValue, float64(stats.Connections.Writing))
+		prometheus.GaugeValue, float64(stats.Connections.Writing), t.labels...)
 
 	ch <- prometheus.MustNewConstMetric(c.connectionsWaiting,
-		prometheus.GaugeValue, float64(stats.Connections.Waiting))
+		prometheus.GaugeValue, float64(stats.Connections.Waiting), t.labels...)
+}
+
+// cached returns the stats of the last scrape of t, if they're younger than the cache duration.
+func (c *Collector) cached(t *target) (StubStats, string, bool) {
+	if c.cacheDuration <= 0 {
+		return StubStats{}, "", false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cachedAt.IsZero() || time.Since(t.cachedAt) >= c.cacheDuration {
+		return StubStats{}, "", false
+	}
+
+	return t.cachedStats, t.cachedVersion, true
+}
+
+// store caches successfully scraped stats of t, if a cache duration is configured. Failed scrapes are never cached.
+func (c *Collector) store(t *target, stats StubStats, serverVersion string) {
+	if c.cacheDuration <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cachedAt = time.Now()
+	t.cachedStats = stats
+	t.cachedVersion = serverVersion
 }
 
-func (c *Collector) collectUp(ch chan<- prometheus.Metric, value float64, serverVersion string) {
+func (c *Collector) collectUp(ch chan<- prometheus.Metric, t *target, value float64, serverVersion string) {
 	ch <- prometheus.MustNewConstMetric(c.upMetric,
-		prometheus.GaugeValue, value, serverVersion)
+		prometheus.GaugeValue, value, append([]string{serverVersion}, t.labels...)...)
 }
 
 func newUnixHTTPClient(scrapeURL string) (*http.Client, bool) {
@@ -21,7 +21,7 @@ func BenchmarkCollectorCollect(b *testing.B) {
 	}))
 	b.Cleanup(stubServer.Close)
 
-	col := nginx.New(slog.New(slog.DiscardHandler), stubServer.URL)
+	col := nginx.New(slog.New(slog.DiscardHandler), []string{stubServer.URL})
 	metrics := make(chan prometheus.Metric, 7)
 
 	b.ResetTimer()
@@ -1,11 +1,17 @@
 package nginx_test
 
 import (
+	"encoding/pem"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/jkroepke/access-log-exporter/internal/nginx"
 	"github.com/prometheus/client_golang/prometheus/testutil"
@@ -131,7 +137,7 @@ nginx_up{version="N/A"} 0`,
 			stubServer := httptest.NewServer(tc.handler)
 			t.Cleanup(stubServer.Close)
 
-			col := nginx.New(slog.New(slog.DiscardHandler), stubServer.URL)
+			col := nginx.New(slog.New(slog.DiscardHandler), []string{stubServer.URL})
 
 			require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(strings.TrimSpace(tc.metrics)+"\n")))
 		})
@@ -141,7 +147,7 @@ nginx_up{version="N/A"} 0`,
 func TestCollector_NoServer(t *testing.T) {
 	t.Parallel()
 
-	col := nginx.New(slog.New(slog.DiscardHandler), "http://nonexistent-server")
+	col := nginx.New(slog.New(slog.DiscardHandler), []string{"http://nonexistent-server"})
 
 	expected := `# HELP nginx_up Whether the NGINX server is up (1) or down (0). 1 means the server is up and metrics are being collected, 0 means the server is down or unreachable.
 # TYPE nginx_up gauge
@@ -150,6 +156,99 @@ nginx_up{version="N/A"} 0`
 	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(strings.TrimSpace(expected)+"\n")))
 }
 
+func TestCollector_Timeout(t *testing.T) {
+	t.Parallel()
+
+	stubServer := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		// Hang until the client gives up.
+		<-r.Context().Done()
+	}))
+	t.Cleanup(stubServer.Close)
+
+	col := nginx.New(slog.New(slog.DiscardHandler), []string{stubServer.URL}, nginx.WithTimeout(50*time.Millisecond))
+
+	expected := `# HELP nginx_up Whether the NGINX server is up (1) or down (0). 1 means the server is up and metrics are being collected, 0 means the server is down or unreachable.
+# TYPE nginx_up gauge
+nginx_up{version="N/A"} 0`
+
+	start := time.Now()
+
+	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(strings.TrimSpace(expected)+"\n")))
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestCollector_CacheDuration(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+
+	stubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+
+		w.WriteHeader(http.StatusOK)
+
+		_, err := w.Write([]byte("Active connections: 1\nserver accepts handled requests\n10 10 10\nReading: 0 Writing: 1 Waiting: 0\n"))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(stubServer.Close)
+
+	col := nginx.New(slog.New(slog.DiscardHandler), []string{stubServer.URL}, nginx.WithCacheDuration(time.Minute))
+
+	expected := `# HELP nginx_connections_active Active client connections.
+# TYPE nginx_connections_active gauge
+nginx_connections_active 1
+# HELP nginx_up Whether the NGINX server is up (1) or down (0). 1 means the server is up and metrics are being collected, 0 means the server is down or unreachable.
+# TYPE nginx_up gauge
+nginx_up{version="N/A"} 1
+`
+
+	for range 2 {
+		require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(expected), "nginx_up", "nginx_connections_active"))
+	}
+
+	require.Equal(t, int32(1), requests.Load())
+}
+
+func TestCollector_MultipleTargets(t *testing.T) {
+	t.Parallel()
+
+	newStubServer := func(active int) *httptest.Server {
+		stubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Add("Server", "nginx/1.29.0")
+			w.WriteHeader(http.StatusOK)
+
+			_, err := fmt.Fprintf(w, "Active connections: %d\nserver accepts handled requests\n10 10 10\nReading: 0 Writing: 1 Waiting: 0\n", active)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+		}))
+		t.Cleanup(stubServer.Close)
+
+		return stubServer
+	}
+
+	first := newStubServer(1)
+	second := newStubServer(2)
+	unreachable := "http://nonexistent-server"
+
+	col := nginx.New(slog.New(slog.DiscardHandler), []string{first.URL, second.URL, unreachable})
+
+	expected := fmt.Sprintf(`# HELP nginx_connections_active Active client connections.
+# TYPE nginx_connections_active gauge
+nginx_connections_active{target=%[1]q} 1
+nginx_connections_active{target=%[2]q} 2
+# HELP nginx_up Whether the NGINX server is up (1) or down (0). 1 means the server is up and metrics are being collected, 0 means the server is down or unreachable.
+# TYPE nginx_up gauge
+nginx_up{target=%[1]q,version="1.29.0"} 1
+nginx_up{target=%[2]q,version="1.29.0"} 1
+nginx_up{target=%[3]q,version="N/A"} 0
+`, first.URL, second.URL, unreachable)
+
+	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(expected), "nginx_up", "nginx_connections_active"))
+}
+
 func TestCollector_UnixSocket(t *testing.T) {
 	t.Parallel()
 
@@ -169,7 +268,7 @@ func TestCollector_UnixSocket(t *testing.T) {
 	stubServer.Start()
 	t.Cleanup(stubServer.Close)
 
-	col := nginx.New(slog.New(slog.DiscardHandler), "unix://"+listener.Addr().String())
+	col := nginx.New(slog.New(slog.DiscardHandler), []string{"unix://" + listener.Addr().String()})
 
 	expected := `# HELP nginx_connections_accepted_total Accepted client connections.
 # TYPE nginx_connections_accepted_total counter
@@ -195,3 +294,219 @@ nginx_up{version="1.29.0"} 1`
 
 	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(strings.TrimSpace(expected)+"\n")))
 }
+
+func TestCollector_BasicAuth(t *testing.T) {
+	t.Parallel()
+
+	stubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "exporter" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="stub_status"`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		_, err := w.Write([]byte("Active connections: 1\nserver accepts handled requests\n10 10 10\nReading: 0 Writing: 1 Waiting: 0\n"))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(stubServer.Close)
+
+	for _, tc := range []struct {
+		name string
+		opts []nginx.Option
+		up   float64
+	}{
+		{
+			name: "without credentials",
+			up:   0,
+		},
+		{
+			name: "wrong credentials",
+			opts: []nginx.Option{nginx.WithBasicAuth("exporter", "wrong")},
+			up:   0,
+		},
+		{
+			name: "valid credentials",
+			opts: []nginx.Option{nginx.WithBasicAuth("exporter", "secret")},
+			up:   1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			col := nginx.New(slog.New(slog.DiscardHandler), []string{stubServer.URL}, tc.opts...)
+
+			expected := fmt.Sprintf(`# HELP nginx_up Whether the NGINX server is up (1) or down (0). 1 means the server is up and metrics are being collected, 0 means the server is down or unreachable.
+# TYPE nginx_up gauge
+nginx_up{version="N/A"} %v
+`, tc.up)
+
+			require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(expected), "nginx_up"))
+		})
+	}
+}
+
+func TestCollector_TLS(t *testing.T) {
+	t.Parallel()
+
+	stubServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+
+		_, err := w.Write([]byte("Active connections: 1\nserver accepts handled requests\n10 10 10\nReading: 0 Writing: 1 Waiting: 0\n"))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(stubServer.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: stubServer.Certificate().Raw}), 0o600))
+
+	for _, tc := range []struct {
+		name               string
+		caFile             string
+		insecureSkipVerify bool
+		up                 float64
+	}{
+		{
+			name: "unknown CA",
+			up:   0,
+		},
+		{
+			name:   "CA file",
+			caFile: caFile,
+			up:     1,
+		},
+		{
+			name:               "insecure skip verify",
+			insecureSkipVerify: true,
+			up:                 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tlsConfig, err := nginx.NewTLSConfig(tc.caFile, "", "", tc.insecureSkipVerify)
+			require.NoError(t, err)
+
+			col := nginx.New(slog.New(slog.DiscardHandler), []string{stubServer.URL}, nginx.WithTLSConfig(tlsConfig))
+
+			expected := fmt.Sprintf(`# HELP nginx_up Whether the NGINX server is up (1) or down (0). 1 means the server is up and metrics are being collected, 0 means the server is down or unreachable.
+# TYPE nginx_up gauge
+nginx_up{version="N/A"} %v
+`, tc.up)
+
+			require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(expected), "nginx_up"))
+		})
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	tlsConfig, err := nginx.NewTLSConfig("", "", "", false)
+	require.NoError(t, err)
+	require.Nil(t, tlsConfig)
+
+	invalidCAFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(invalidCAFile, []byte("not a certificate"), 0o600))
+
+	_, err = nginx.NewTLSConfig(invalidCAFile, "", "", false)
+	require.ErrorContains(t, err, "does not contain any PEM certificate")
+
+	_, err = nginx.NewTLSConfig("", "missing.crt", "missing.key", false)
+	require.ErrorContains(t, err, "could not load nginx scrape client certificate")
+}
+
+func TestPlusCollector(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/9/connections", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Add("Server", "nginx/1.27.4")
+		_, _ = w.Write([]byte(`{"accepted":12,"dropped":2,"active":3,"idle":1}`))
+	})
+	mux.HandleFunc("GET /api/9/http/requests", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"total":120,"current":2}`))
+	})
+	mux.HandleFunc("GET /api/9/http/server_zones", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"example.com":{"processing":1,"requests":100,"responses":{"1xx":0,"2xx":90,"3xx":4,"4xx":5,"5xx":1,"codes":{"200":90},"total":100},"discarded":0,"received":2048,"sent":4096}}`))
+	})
+
+	stubServer := httptest.NewServer(mux)
+	t.Cleanup(stubServer.Close)
+
+	col := nginx.NewPlus(slog.New(slog.DiscardHandler), stubServer.URL+"/api/9/")
+
+	expected := `# HELP nginx_connections_accepted_total Accepted client connections.
+# TYPE nginx_connections_accepted_total counter
+nginx_connections_accepted_total 12
+# HELP nginx_connections_active Active client connections.
+# TYPE nginx_connections_active gauge
+nginx_connections_active 3
+# HELP nginx_connections_handled_total Handled client connections.
+# TYPE nginx_connections_handled_total counter
+nginx_connections_handled_total 10
+# HELP nginx_connections_waiting Idle client connections.
+# TYPE nginx_connections_waiting gauge
+nginx_connections_waiting 1
+# HELP nginx_http_requests_current Client requests currently being processed.
+# TYPE nginx_http_requests_current gauge
+nginx_http_requests_current 2
+# HELP nginx_http_requests_total Total client requests.
+# TYPE nginx_http_requests_total counter
+nginx_http_requests_total 120
+# HELP nginx_server_zone_processing Client requests of the server zone currently being processed.
+# TYPE nginx_server_zone_processing gauge
+nginx_server_zone_processing{server_zone="example.com"} 1
+# HELP nginx_server_zone_received_bytes_total Bytes received from clients by the server zone.
+# TYPE nginx_server_zone_received_bytes_total counter
+nginx_server_zone_received_bytes_total{server_zone="example.com"} 2048
+# HELP nginx_server_zone_requests_total Client requests received by the server zone.
+# TYPE nginx_server_zone_requests_total counter
+nginx_server_zone_requests_total{server_zone="example.com"} 100
+# HELP nginx_server_zone_responses_total Responses sent by the server zone, by status code class.
+# TYPE nginx_server_zone_responses_total counter
+nginx_server_zone_responses_total{code="1xx",server_zone="example.com"} 0
+nginx_server_zone_responses_total{code="2xx",server_zone="example.com"} 90
+nginx_server_zone_responses_total{code="3xx",server_zone="example.com"} 4
+nginx_server_zone_responses_total{code="4xx",server_zone="example.com"} 5
+nginx_server_zone_responses_total{code="5xx",server_zone="example.com"} 1
+# HELP nginx_server_zone_sent_bytes_total Bytes sent to clients by the server zone.
+# TYPE nginx_server_zone_sent_bytes_total counter
+nginx_server_zone_sent_bytes_total{server_zone="example.com"} 4096
+# HELP nginx_up Whether the NGINX server is up (1) or down (0). 1 means the server is up and metrics are being collected, 0 means the server is down or unreachable.
+# TYPE nginx_up gauge
+nginx_up{version="1.27.4"} 1`
+
+	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(strings.TrimSpace(expected)+"\n")))
+}
+
+func TestPlusCollector_Error(t *testing.T) {
+	t.Parallel()
+
+	// If one of the endpoints fails, only nginx_up is exposed, without partial metrics.
+	stubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/9/connections" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"accepted":12,"dropped":2,"active":3,"idle":1}`))
+	}))
+	t.Cleanup(stubServer.Close)
+
+	col := nginx.NewPlus(slog.New(slog.DiscardHandler), stubServer.URL+"/api/9")
+
+	expected := `# HELP nginx_up Whether the NGINX server is up (1) or down (0). 1 means the server is up and metrics are being collected, 0 means the server is down or unreachable.
+# TYPE nginx_up gauge
+nginx_up{version="N/A"} 0`
+
+	require.NoError(t, testutil.CollectAndCompare(col, strings.NewReader(strings.TrimSpace(expected)+"\n")))
+}
@@ -0,0 +1,304 @@
+package nginx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PlusCollector collects the metrics of the NGINX Plus JSON API, e.g. at http://127.0.0.1:8080/api/9.
+// Connection metrics use the names of [Collector], which the API provides as well. In addition,
+// it exposes the HTTP request counters and per server zone request and response counters.
+type PlusCollector struct {
+	upMetric             *prometheus.Desc
+	connectionsAccepted  *prometheus.Desc
+	connectionsActive    *prometheus.Desc
+	connectionsHandled   *prometheus.Desc
+	connectionsWaiting   *prometheus.Desc
+	httpRequests         *prometheus.Desc
+	httpRequestsCurrent  *prometheus.Desc
+	serverZoneProcessing *prometheus.Desc
+	serverZoneRequests   *prometheus.Desc
+	serverZoneResponses  *prometheus.Desc
+	serverZoneReceived   *prometheus.Desc
+	serverZoneSent       *prometheus.Desc
+	logger               *slog.Logger
+	client               *http.Client
+	apiURL               string
+	username             string
+	password             string
+	timeout              time.Duration
+}
+
+// PlusStats represents the NGINX Plus API endpoints scraped by [PlusCollector].
+type PlusStats struct {
+	ServerZones  map[string]PlusServerZone
+	HTTPRequests PlusHTTPRequests
+	Connections  PlusConnections
+}
+
+// PlusConnections represents the /connections endpoint.
+type PlusConnections struct {
+	Accepted int64 `json:"accepted"`
+	Dropped  int64 `json:"dropped"`
+	Active   int64 `json:"active"`
+	Idle     int64 `json:"idle"`
+}
+
+// PlusHTTPRequests represents the /http/requests endpoint.
+type PlusHTTPRequests struct {
+	Total   int64 `json:"total"`
+	Current int64 `json:"current"`
+}
+
+// PlusServerZone represents a single server zone of the /http/server_zones endpoint.
+type PlusServerZone struct {
+	Responses  PlusResponses `json:"responses"`
+	Processing int64         `json:"processing"`
+	Requests   int64         `json:"requests"`
+	Received   int64         `json:"received"`
+	Sent       int64         `json:"sent"`
+}
+
+// PlusResponses represents the responses of a server zone by status code class.
+type PlusResponses struct {
+	Responses1xx int64 `json:"1xx"`
+	Responses2xx int64 `json:"2xx"`
+	Responses3xx int64 `json:"3xx"`
+	Responses4xx int64 `json:"4xx"`
+	Responses5xx int64 `json:"5xx"`
+}
+
+// NewPlus returns a collector for the NGINX Plus API at apiURL, including the API version, e.g. http://127.0.0.1:8080/api/9.
+// It accepts the options of [New].
+func NewPlus(logger *slog.Logger, apiURL string, opts ...Option) *PlusCollector {
+	options := &Collector{
+		client:  http.DefaultClient,
+		timeout: defaultScrapeTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	options.applyTLSConfig()
+
+	return &PlusCollector{
+		apiURL:   strings.TrimSuffix(apiURL, "/"),
+		logger:   logger.With(slog.String("component", "nginx_plus_collector")),
+		client:   options.client,
+		username: options.username,
+		password: options.password,
+		timeout:  options.timeout,
+		upMetric: newUpDesc(),
+		connectionsAccepted: prometheus.NewDesc(
+			"nginx_connections_accepted_total",
+			"Accepted client connections.",
+			nil, nil,
+		),
+		connectionsActive: prometheus.NewDesc(
+			"nginx_connections_active",
+			"Active client connections.",
+			nil, nil,
+		),
+		connectionsHandled: prometheus.NewDesc(
+			"nginx_connections_handled_total",
+			"Handled client connections.",
+			nil, nil,
+		),
+		connectionsWaiting: prometheus.NewDesc(
+			"nginx_connections_waiting",
+			"Idle client connections.",
+			nil, nil,
+		),
+		httpRequests: prometheus.NewDesc(
+			"nginx_http_requests_total",
+			"Total client requests.",
+			nil, nil,
+		),
+		httpRequestsCurrent: prometheus.NewDesc(
+			"nginx_http_requests_current",
+			"Client requests currently being processed.",
+			nil, nil,
+		),
+		serverZoneProcessing: prometheus.NewDesc(
+			"nginx_server_zone_processing",
+			"Client requests of the server zone currently being processed.",
+			[]string{"server_zone"}, nil,
+		),
+		serverZoneRequests: prometheus.NewDesc(
+			"nginx_server_zone_requests_total",
+			"Client requests received by the server zone.",
+			[]string{"server_zone"}, nil,
+		),
+		serverZoneResponses: prometheus.NewDesc(
+			"nginx_server_zone_responses_total",
+			"Responses sent by the server zone, by status code class.",
+			[]string{"server_zone", "code"}, nil,
+		),
+		serverZoneReceived: prometheus.NewDesc(
+			"nginx_server_zone_received_bytes_total",
+			"Bytes received from clients by the server zone.",
+			[]string{"server_zone"}, nil,
+		),
+		serverZoneSent: prometheus.NewDesc(
+			"nginx_server_zone_sent_bytes_total",
+			"Bytes sent to clients by the server zone.",
+			[]string{"server_zone"}, nil,
+		),
+	}
+}
+
+func (c *PlusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.upMetric
+
+	ch <- c.connectionsAccepted
+
+	ch <- c.connectionsActive
+
+	ch <- c.connectionsHandled
+
+	ch <- c.connectionsWaiting
+
+	ch <- c.httpRequests
+
+	ch <- c.httpRequestsCurrent
+
+	ch <- c.serverZoneProcessing
+
+	ch <- c.serverZoneRequests
+
+	ch <- c.serverZoneResponses
+
+	ch <- c.serverZoneReceived
+
+	ch <- c.serverZoneSent
+}
+
+func (c *PlusCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	stats, serverVersion, err := c.scrape(ctx)
+	if err != nil {
+		c.logger.Error(
+			"Failed to scrape NGINX Plus metrics",
+			slog.String("url", c.apiURL),
+			slog.Any("error", err),
+		)
+
+		ch <- prometheus.MustNewConstMetric(c.upMetric, prometheus.GaugeValue, 0, serverVersion)
+
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.upMetric, prometheus.GaugeValue, 1, serverVersion)
+
+	ch <- prometheus.MustNewConstMetric(c.connectionsAccepted,
+		prometheus.CounterValue, float64(stats.Connections.Accepted))
+
+	ch <- prometheus.MustNewConstMetric(c.connectionsActive,
+		prometheus.GaugeValue, float64(stats.Connections.Active))
+
+	// Like stub_status, handled connections are the accepted ones, unless dropped due to resource limits.
+	ch <- prometheus.MustNewConstMetric(c.connectionsHandled,
+		prometheus.CounterValue, float64(stats.Connections.Accepted-stats.Connections.Dropped))
+
+	ch <- prometheus.MustNewConstMetric(c.connectionsWaiting,
+		prometheus.GaugeValue, float64(stats.Connections.Idle))
+
+	ch <- prometheus.MustNewConstMetric(c.httpRequests,
+		prometheus.CounterValue, float64(stats.HTTPRequests.Total))
+
+	ch <- prometheus.MustNewConstMetric(c.httpRequestsCurrent,
+		prometheus.GaugeValue, float64(stats.HTTPRequests.Current))
+
+	for name, zone := range stats.ServerZones {
+		ch <- prometheus.MustNewConstMetric(c.serverZoneProcessing,
+			prometheus.GaugeValue, float64(zone.Processing), name)
+
+		ch <- prometheus.MustNewConstMetric(c.serverZoneRequests,
+			prometheus.CounterValue, float64(zone.Requests), name)
+
+		for code, responses := range map[string]int64{
+			"1xx": zone.Responses.Responses1xx,
+			"2xx": zone.Responses.Responses2xx,
+			"3xx": zone.Responses.Responses3xx,
+			"4xx": zone.Responses.Responses4xx,
+			"5xx": zone.Responses.Responses5xx,
+		} {
+			ch <- prometheus.MustNewConstMetric(c.serverZoneResponses,
+				prometheus.CounterValue, float64(responses), name, code)
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.serverZoneReceived,
+			prometheus.CounterValue, float64(zone.Received), name)
+
+		ch <- prometheus.MustNewConstMetric(c.serverZoneSent,
+			prometheus.CounterValue, float64(zone.Sent), name)
+	}
+}
+
+// scrape fetches all endpoints. It returns the server version of the Server header, or N/A if unknown.
+func (c *PlusCollector) scrape(ctx context.Context) (PlusStats, string, error) {
+	var stats PlusStats
+
+	serverVersion, err := c.fetch(ctx, "/connections", &stats.Connections)
+	if err != nil {
+		return PlusStats{}, serverVersion, err
+	}
+
+	if _, err = c.fetch(ctx, "/http/requests", &stats.HTTPRequests); err != nil {
+		return PlusStats{}, serverVersion, err
+	}
+
+	if _, err = c.fetch(ctx, "/http/server_zones", &stats.ServerZones); err != nil {
+		return PlusStats{}, serverVersion, err
+	}
+
+	return stats, serverVersion, nil
+}
+
+// fetch decodes the JSON response of the API endpoint at path into target and returns the server version.
+func (c *PlusCollector) fetch(ctx context.Context, path string, target any) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiURL+path, nil)
+	if err != nil {
+		return defaultServerVersion, fmt.Errorf("failed to create HTTP request for %s: %w", path, err)
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return defaultServerVersion, fmt.Errorf("failed to request %s: %w", path, err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	serverVersion := defaultServerVersion
+	if version, ok := strings.CutPrefix(resp.Header.Get("Server"), "nginx/"); ok {
+		serverVersion = version
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return serverVersion, fmt.Errorf("%s returned status code %d", path, resp.StatusCode)
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return serverVersion, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	return serverVersion, nil
+}
@@ -0,0 +1,71 @@
+package nginx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// NewTLSConfig returns the TLS configuration to scrape HTTPS endpoints, e.g. with a certificate of an internal CA.
+// caFile replaces the system roots, and certFile and keyFile present a client certificate.
+// It returns nil if no option is set, so the default HTTP client is used.
+func NewTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" && !insecureSkipVerify {
+		return nil, nil //nolint:nilnil // no TLS configuration
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecureSkipVerify, //nolint:gosec // explicitly configured
+	}
+
+	if caFile != "" {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read nginx scrape CA: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("nginx scrape CA '%s' does not contain any PEM certificate", caFile)
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load nginx scrape client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// WithTLSConfig scrapes HTTPS endpoints with tlsConfig, see [NewTLSConfig]. A nil tlsConfig keeps the default.
+// It doesn't apply to unix domain sockets or a client set by [WithHTTPClient].
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *Collector) {
+		c.tlsConfig = tlsConfig
+	}
+}
+
+// applyTLSConfig replaces the default HTTP client by one using the configured TLS configuration.
+func (c *Collector) applyTLSConfig() {
+	if c.tlsConfig == nil || c.client != http.DefaultClient {
+		return
+	}
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return
+	}
+
+	tlsTransport := transport.Clone()
+	tlsTransport.TLSClientConfig = c.tlsConfig
+
+	c.client = &http.Client{Transport: tlsTransport}
+}
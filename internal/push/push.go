@@ -0,0 +1,92 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const defaultInterval = 15 * time.Second
+
+// Pusher periodically pushes all metrics of a gatherer to a Prometheus Pushgateway.
+type Pusher struct {
+	logger   *slog.Logger
+	pusher   *push.Pusher
+	url      string
+	interval time.Duration
+}
+
+type Option func(*Pusher)
+
+func WithInterval(interval time.Duration) Option {
+	return func(p *Pusher) {
+		if interval > 0 {
+			p.interval = interval
+		}
+	}
+}
+
+func WithGrouping(grouping map[string]string) Option {
+	return func(p *Pusher) {
+		// Sort the grouping labels to get a stable push URL.
+		for _, name := range slices.Sorted(maps.Keys(grouping)) {
+			p.pusher.Grouping(name, grouping[name])
+		}
+	}
+}
+
+func New(logger *slog.Logger, url, job string, gatherer prometheus.Gatherer, opts ...Option) *Pusher {
+	pusher := &Pusher{
+		logger:   logger.With(slog.String("component", "push")),
+		pusher:   push.New(url, job).Gatherer(gatherer),
+		url:      url,
+		interval: defaultInterval,
+	}
+
+	for _, opt := range opts {
+		opt(pusher)
+	}
+
+	return pusher
+}
+
+// Run pushes the metrics in the configured interval until the context is done.
+// A final push is sent on shutdown to transmit the latest state.
+func (p *Pusher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.interval)
+			p.push(shutdownCtx) //nolint:contextcheck
+			cancel()
+
+			return
+		case <-ticker.C:
+			p.push(ctx)
+		}
+	}
+}
+
+// Push sends all metrics to the Pushgateway, replacing all metrics with the same grouping key.
+func (p *Pusher) Push(ctx context.Context) error {
+	if err := p.pusher.PushContext(ctx); err != nil {
+		return fmt.Errorf("could not push metrics to %s: %w", p.url, err)
+	}
+
+	return nil
+}
+
+func (p *Pusher) push(ctx context.Context) {
+	if err := p.Push(ctx); err != nil {
+		p.logger.LogAttrs(ctx, slog.LevelError, "error pushing metrics", slog.Any("error", err))
+	}
+}
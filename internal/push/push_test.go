@@ -0,0 +1,78 @@
+package push_test
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jkroepke/access-log-exporter/internal/push"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPush(t *testing.T) {
+	t.Parallel()
+
+	type request struct {
+		metricFamilies map[string]*dto.MetricFamily
+		method         string
+		path           string
+	}
+
+	requestCh := make(chan request, 1)
+
+	pushgateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metricFamilies := make(map[string]*dto.MetricFamily)
+		decoder := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+
+		for {
+			metricFamily := &dto.MetricFamily{}
+
+			err := decoder.Decode(metricFamily)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+
+				return
+			}
+
+			metricFamilies[metricFamily.GetName()] = metricFamily
+		}
+
+		requestCh <- request{metricFamilies: metricFamilies, method: r.Method, path: r.URL.Path}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(pushgateway.Close)
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "The total number of client requests.",
+	})
+	counter.Add(3)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(counter)
+
+	pusher := push.New(slog.New(slog.DiscardHandler), pushgateway.URL, "access_log_exporter", reg,
+		push.WithGrouping(map[string]string{"instance": "web-1", "env": "prod"}),
+	)
+
+	require.NoError(t, pusher.Push(t.Context()))
+
+	req := <-requestCh
+
+	assert.Equal(t, http.MethodPut, req.method)
+	assert.Equal(t, "/metrics/job/access_log_exporter/env/prod/instance/web-1", req.path)
+	require.Contains(t, req.metricFamilies, "http_requests_total")
+	assert.InDelta(t, 3.0, req.metricFamilies["http_requests_total"].GetMetric()[0].GetCounter().GetValue(), 0)
+}
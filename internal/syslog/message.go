@@ -2,9 +2,11 @@ package syslog
 
 import "sync"
 
-const bufferSize = 4096
+// defaultMaxMessageSize is the size of the message buffers, unless set by [WithMaxMessageSize].
+const defaultMaxMessageSize = 4096
 
-type packetBuffer [bufferSize]byte
+// packetBuffer holds a single message. Its length is the maximum message size.
+type packetBuffer []byte
 
 type Message struct {
 	buffer *packetBuffer
@@ -14,7 +16,7 @@ type Message struct {
 
 func newMessage(buffer *packetBuffer, start, end int, pool *sync.Pool) Message {
 	return Message{
-		Line:   string(buffer[start:end]),
+		Line:   string((*buffer)[start:end]),
 		buffer: buffer,
 		pool:   pool,
 	}
@@ -0,0 +1,78 @@
+package syslog
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics counts the messages of one or more listeners, labeled by the listen address.
+// It is a [prometheus.Collector], which can be shared by several listeners, see [WithMetrics].
+type Metrics struct {
+	received  *prometheus.CounterVec
+	invalid   *prometheus.CounterVec
+	truncated *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_messages_received_total",
+			Help: "Total number of syslog messages received per listener",
+		}, []string{"listener"}),
+		invalid: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_messages_invalid_total",
+			Help: "Total number of received syslog messages skipped per listener because they are not valid syslog messages",
+		}, []string{"listener"}),
+		truncated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_truncated_messages_total",
+			Help: "Total number of received syslog messages per listener truncated because they exceed the maximum message size",
+		}, []string{"listener"}),
+	}
+}
+
+// WithMetrics counts the messages of the listener in metrics, labeled by the listen address.
+func WithMetrics(metrics *Metrics) Option {
+	return func(s *Syslog) {
+		s.received = metrics.received.WithLabelValues(s.listenAddr)
+		s.invalid = metrics.invalid.WithLabelValues(s.listenAddr)
+		s.truncated = metrics.truncated.WithLabelValues(s.listenAddr)
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.received.Describe(ch)
+	m.invalid.Describe(ch)
+	m.truncated.Describe(ch)
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.received.Collect(ch)
+	m.invalid.Collect(ch)
+	m.truncated.Collect(ch)
+}
+
+// countMessage counts a received message, and whether it's invalid, if metrics are configured.
+func (s *Syslog) countMessage(valid bool) {
+	if s.received == nil {
+		return
+	}
+
+	s.received.Inc()
+
+	if !valid {
+		s.invalid.Inc()
+	}
+}
+
+// truncatedMessage logs and, if metrics are configured, counts a message exceeding the maximum message size.
+func (s *Syslog) truncatedMessage() {
+	s.logger.LogAttrs(context.Background(), slog.LevelWarn, "syslog message exceeds the maximum message size and was truncated",
+		slog.Int("max_message_size", s.maxMessageSize),
+	)
+
+	if s.truncated != nil {
+		s.truncated.Inc()
+	}
+}
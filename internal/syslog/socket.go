@@ -0,0 +1,69 @@
+package syslog
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// setSocketPermissions applies the file mode and owner of [WithSocketPermissions] to the unix socket at path.
+func (s *Syslog) setSocketPermissions(path string) error {
+	if s.socketMode != 0 {
+		if err := os.Chmod(path, s.socketMode); err != nil {
+			return fmt.Errorf("could not set mode of syslog socket '%s': %w", path, err)
+		}
+	}
+
+	if s.socketOwner == "" && s.socketGroup == "" {
+		return nil
+	}
+
+	uid, err := lookupID(s.socketOwner, func(name string) (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err //nolint:wrapcheck
+		}
+
+		return u.Uid, nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not look up owner of syslog socket: %w", err)
+	}
+
+	gid, err := lookupID(s.socketGroup, func(name string) (string, error) {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err //nolint:wrapcheck
+		}
+
+		return g.Gid, nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not look up group of syslog socket: %w", err)
+	}
+
+	if err = os.Chown(path, uid, gid); err != nil {
+		return fmt.Errorf("could not set owner of syslog socket '%s': %w", path, err)
+	}
+
+	return nil
+}
+
+// lookupID returns the numeric ID of a user or group given by name or ID, or -1 to keep the current one if empty.
+func lookupID(nameOrID string, lookup func(name string) (string, error)) (int, error) {
+	if nameOrID == "" {
+		return -1, nil
+	}
+
+	if id, err := strconv.Atoi(nameOrID); err == nil {
+		return id, nil
+	}
+
+	id, err := lookup(nameOrID)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(id) //nolint:wrapcheck
+}
@@ -0,0 +1,343 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// errNewlineFraming is returned for newline-framed messages if gzip frames are enabled, see [readCompressedFrame].
+	errNewlineFraming = errors.New("newline framing is not supported with gzip frames, use octet counting")
+	// errInvalidFrame is returned for a frame that can't be decoded. The stream continues with the next frame.
+	errInvalidFrame = errors.New("invalid frame")
+)
+
+// gzipMagic are the first bytes of a gzip stream.
+//
+//nolint:gochecknoglobals
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// streams tracks the open connections of a stream listener, so [Syslog.Close] can shut them down.
+type streams struct {
+	conns  map[net.Conn]struct{}
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	closed bool
+}
+
+func newStreams() *streams {
+	return &streams{
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// add tracks the connection. It reports false if the streams are already closed.
+func (s *streams) add(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+
+	return true
+}
+
+// remove closes the connection and stops tracking it.
+func (s *streams) remove(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+
+	_ = conn.Close()
+
+	s.wg.Done()
+}
+
+// close closes all connections and waits until their readers returned.
+func (s *streams) close() {
+	s.mu.Lock()
+
+	s.closed = true
+
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// startStream accepts connections until the server is closed. Each connection is read in its own goroutine.
+func (s *Syslog) startStream() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+			}
+
+			// Accept fails temporarily, e.g. if the process runs out of file descriptors.
+			var opError *net.OpError
+
+			ok := errors.As(err, &opError)
+			if ok && !opError.Temporary() && !opError.Timeout() {
+				return fmt.Errorf("syslog server stopped: %w", err)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+
+			continue
+		}
+
+		if !s.streams.add(conn) {
+			_ = conn.Close()
+
+			return nil
+		}
+
+		go func() {
+			defer s.streams.remove(conn)
+
+			s.readStream(conn)
+		}()
+	}
+}
+
+// readStream reads messages from conn until it's closed. Each message is framed either by octet counting or by
+// a trailing newline, see [readFrame]. Like datagrams, messages exceeding the buffer size are truncated.
+func (s *Syslog) readStream(conn net.Conn) {
+	reader := bufio.NewReaderSize(conn, s.maxMessageSize)
+
+	// With gzip frames, each frame is read into frame first and decompressed into the message buffer.
+	var (
+		frame        []byte
+		decompressor gzip.Reader
+	)
+
+	if s.gzipFrames {
+		frame = make([]byte, s.maxMessageSize)
+	}
+
+	for {
+		buffer, _ := s.bufferPool.Get().(*packetBuffer)
+
+		var (
+			n         int
+			truncated bool
+			err       error
+		)
+
+		if frame != nil {
+			n, truncated, err = readCompressedFrame(reader, buffer, frame, &decompressor)
+		} else {
+			n, truncated, err = readFrame(reader, buffer)
+		}
+
+		if truncated {
+			s.truncatedMessage()
+		}
+
+		switch {
+		case errors.Is(err, errInvalidFrame):
+			s.countMessage(false)
+
+			err = nil
+		case errors.Is(err, errNewlineFraming):
+			s.logger.LogAttrs(context.Background(), slog.LevelWarn, "closing syslog connection",
+				slog.String("remote_addr", conn.RemoteAddr().String()),
+				slog.Any("error", err),
+			)
+		}
+
+		if n == 0 {
+			s.bufferPool.Put(buffer)
+		} else {
+			message, ok := s.parseMessage(buffer, n)
+			s.countMessage(ok)
+
+			if !ok {
+				s.bufferPool.Put(buffer)
+			} else {
+				select {
+				case s.msgCh <- message:
+				case <-s.done:
+					message.Release()
+
+					return
+				}
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readFrame reads the next message of a stream into buffer and returns its length and whether it was truncated.
+// Messages starting with a digit are octet-counted (RFC 6587), i.e. prefixed by their length and a space,
+// e.g. sent by rsyslog with TCP_Framing="octet-counted". Since syslog messages start with '<', all other messages are delimited by a newline.
+// An invalid octet count returns an error, because the start of the next message can't be found.
+func readFrame(reader *bufio.Reader, buffer *packetBuffer) (int, bool, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return 0, false, err //nolint:wrapcheck
+	}
+
+	if first[0] < '0' || first[0] > '9' {
+		line, err := reader.ReadSlice('\n')
+
+		// Empty lines, e.g. a newline trailing an octet-counted message, are skipped.
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			return 0, false, err //nolint:wrapcheck
+		}
+
+		n := copy(*buffer, line)
+		truncated := errors.Is(err, bufio.ErrBufferFull)
+
+		// Discard the remainder of a truncated message.
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = reader.ReadSlice('\n')
+		}
+
+		return n, truncated, err //nolint:wrapcheck
+	}
+
+	return readOctetCounted(reader, *buffer)
+}
+
+// readOctetCounted reads an octet-counted message into dst and returns its length and whether it was truncated.
+func readOctetCounted(reader *bufio.Reader, dst []byte) (int, bool, error) {
+	count, err := reader.ReadSlice(' ')
+	if err != nil {
+		return 0, false, err //nolint:wrapcheck
+	}
+
+	length, err := strconv.ParseUint(string(count[:len(count)-1]), 10, 31)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid octet count: %w", err)
+	}
+
+	// An incomplete message at the end of the stream is dropped.
+	n, err := io.ReadFull(reader, dst[:min(int(length), len(dst))])
+	if err != nil {
+		return 0, false, err //nolint:wrapcheck
+	}
+
+	_, err = reader.Discard(int(length) - n)
+
+	return n, n < int(length), err //nolint:wrapcheck
+}
+
+// readCompressedFrame reads the next octet-counted frame into frame and decompresses it into buffer
+// if it starts with the gzip magic, e.g. sent by a forwarder compressing each message. Other frames are copied as is.
+// The decompressed message is truncated to the size of buffer, so a small frame can't expand beyond the maximum message size.
+// A frame exceeding frame is truncated before decompression, the decompressed part is kept.
+// Newline framing returns [errNewlineFraming], since compressed data may contain newlines.
+func readCompressedFrame(reader *bufio.Reader, buffer *packetBuffer, frame []byte, decompressor *gzip.Reader) (int, bool, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return 0, false, err //nolint:wrapcheck
+	}
+
+	if first[0] < '0' || first[0] > '9' {
+		return 0, false, errNewlineFraming
+	}
+
+	length, truncated, err := readOctetCounted(reader, frame)
+	if err != nil || !bytes.HasPrefix(frame[:length], gzipMagic) {
+		return copy(*buffer, frame[:length]), truncated, err
+	}
+
+	if err := decompressor.Reset(bytes.NewReader(frame[:length])); err != nil {
+		return 0, false, fmt.Errorf("%w: %w", errInvalidFrame, err)
+	}
+
+	n, overflow, err := decompress(decompressor, *buffer)
+	if err != nil && !(truncated && errors.Is(err, io.ErrUnexpectedEOF)) {
+		return 0, false, fmt.Errorf("%w: %w", errInvalidFrame, err)
+	}
+
+	return n, truncated || overflow, nil
+}
+
+// decompress reads the decompressed data into dst and reports whether it exceeds dst.
+func decompress(decompressor *gzip.Reader, dst []byte) (int, bool, error) {
+	decompressor.Multistream(false)
+
+	n := 0
+
+	for n < len(dst) {
+		read, err := decompressor.Read(dst[n:])
+		n += read
+
+		if errors.Is(err, io.EOF) {
+			return n, false, nil
+		}
+
+		if err != nil {
+			return n, false, err //nolint:wrapcheck
+		}
+	}
+
+	// The buffer is full, check whether there is more data.
+	var probe [1]byte
+
+	read, err := decompressor.Read(probe[:])
+	if err != nil && !errors.Is(err, io.EOF) {
+		return n, false, err //nolint:wrapcheck
+	}
+
+	return n, read != 0, nil
+}
+
+// tlsConfig loads the certificate and, if configured, the client CA of the TLS listener.
+func (s *Syslog) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(s.tlsCertFile, s.tlsKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load syslog TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if s.tlsClientCA == "" {
+		return tlsConfig, nil
+	}
+
+	caPEM, err := os.ReadFile(s.tlsClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("could not read syslog TLS client CA: %w", err)
+	}
+
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("syslog TLS client CA '%s' does not contain any PEM certificate", s.tlsClientCA)
+	}
+
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return tlsConfig, nil
+}
@@ -1,10 +1,13 @@
 package syslog
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"net"
 	"net/url"
@@ -12,6 +15,9 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/jkroepke/access-log-exporter/internal/systemd"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type packetReader interface {
@@ -19,25 +25,107 @@ type packetReader interface {
 	io.Reader
 }
 
+// timestampLength is the length of an RFC3164 timestamp, e.g. "Oct 11 22:14:15".
+const timestampLength = len(time.Stamp)
+
 type Syslog struct {
-	logger     *slog.Logger
-	con        packetReader
-	msgCh      chan<- Message
-	done       chan struct{}
-	bufferPool *sync.Pool
-	listenAddr string
+	logger         *slog.Logger
+	con            packetReader
+	listener       net.Listener // Set instead of con for tcp://, see [Syslog.startStream]
+	streams        *streams
+	received       prometheus.Counter // Set by [WithMetrics]
+	invalid        prometheus.Counter
+	truncated      prometheus.Counter
+	msgCh          chan<- Message
+	done           chan struct{}
+	bufferPool     *sync.Pool
+	listenAddr     string
+	tlsCertFile    string
+	tlsKeyFile     string
+	tlsClientCA    string
+	socketOwner    string
+	socketGroup    string
+	socketMode     fs.FileMode
+	maxMessageSize int
+	keepTimestamp  bool
+	keepTag        bool
+	gzipFrames     bool
+}
+
+type Option func(*Syslog)
+
+// WithKeepTimestamp prepends the RFC3164 timestamp of the syslog header as the first field of each message.
+func WithKeepTimestamp(keepTimestamp bool) Option {
+	return func(s *Syslog) {
+		s.keepTimestamp = keepTimestamp
+	}
+}
+
+// WithKeepTag prepends the tag of the syslog header, e.g. "nginx", as the first field of each message.
+// A process ID suffix like "[123]" is stripped. Combined with [WithKeepTimestamp], the timestamp comes first.
+func WithKeepTag(keepTag bool) Option {
+	return func(s *Syslog) {
+		s.keepTag = keepTag
+	}
+}
+
+// WithTLS enables TLS for tcp:// listeners with the given certificate and key files.
+// If clientCAFile is set, clients must present a certificate signed by that CA.
+func WithTLS(certFile, keyFile, clientCAFile string) Option {
+	return func(s *Syslog) {
+		s.tlsCertFile = certFile
+		s.tlsKeyFile = keyFile
+		s.tlsClientCA = clientCAFile
+	}
+}
+
+// WithSocketPermissions sets the file mode and the owner of unix:// sockets. Owner and group are names or numeric IDs.
+// Zero values keep the defaults of the process, i.e. the umask and its user and group.
+func WithSocketPermissions(mode fs.FileMode, owner, group string) Option {
+	return func(s *Syslog) {
+		s.socketMode = mode
+		s.socketOwner = owner
+		s.socketGroup = group
+	}
+}
+
+// WithMaxMessageSize sets the size of the message buffers in bytes. Longer messages are truncated.
+// A size of 0 keeps the default of 4096 bytes.
+func WithMaxMessageSize(size int) Option {
+	return func(s *Syslog) {
+		if size > 0 {
+			s.maxMessageSize = size
+		}
+	}
+}
+
+// WithGzipFrames decompresses octet-counted frames of a tcp:// listener that start with the gzip magic.
+// Newline-framed messages are rejected then, since compressed data may contain newlines.
+func WithGzipFrames(gzipFrames bool) Option {
+	return func(s *Syslog) {
+		s.gzipFrames = gzipFrames
+	}
 }
 
-func New(ctx context.Context, logger *slog.Logger, listenAddr string, msgCh chan<- Message) (Syslog, error) {
+func New(ctx context.Context, logger *slog.Logger, listenAddr string, msgCh chan<- Message, opts ...Option) (Syslog, error) {
 	syslogServer := Syslog{
-		listenAddr: listenAddr,
-		logger:     logger.With(slog.String("component", "syslog")),
-		msgCh:      msgCh,
-		done:       make(chan struct{}),
-		bufferPool: &sync.Pool{
-			New: func() any {
-				return new(packetBuffer)
-			},
+		listenAddr:     listenAddr,
+		logger:         logger.With(slog.String("component", "syslog")),
+		msgCh:          msgCh,
+		done:           make(chan struct{}),
+		maxMessageSize: defaultMaxMessageSize,
+	}
+
+	for _, opt := range opts {
+		opt(&syslogServer)
+	}
+
+	maxMessageSize := syslogServer.maxMessageSize
+	syslogServer.bufferPool = &sync.Pool{
+		New: func() any {
+			buffer := make(packetBuffer, maxMessageSize)
+
+			return &buffer
 		},
 	}
 
@@ -51,19 +139,62 @@ func New(ctx context.Context, logger *slog.Logger, listenAddr string, msgCh chan
 		listener   net.PacketConn
 	)
 
+	// TCP is a stream of newline-delimited messages instead of one message per packet.
+	if uri.Scheme == "tcp" {
+		streamListener, err := listenConf.Listen(ctx, "tcp", uri.Host)
+		if err != nil {
+			return Syslog{}, fmt.Errorf("could not listen syslog server on '%s': %w", listenAddr, err)
+		}
+
+		if syslogServer.tlsCertFile != "" {
+			tlsConfig, err := syslogServer.tlsConfig()
+			if err != nil {
+				_ = streamListener.Close()
+
+				return Syslog{}, err
+			}
+
+			streamListener = tls.NewListener(streamListener, tlsConfig)
+		}
+
+		syslogServer.listener = streamListener
+		syslogServer.streams = newStreams()
+
+		return syslogServer, nil
+	}
+
+	if syslogServer.tlsCertFile != "" {
+		return Syslog{}, fmt.Errorf("syslog TLS requires a tcp:// listen address, got '%s'", listenAddr)
+	}
+
+	if syslogServer.gzipFrames {
+		return Syslog{}, fmt.Errorf("syslog gzip frames require a tcp:// listen address, got '%s'", listenAddr)
+	}
+
 	switch uri.Scheme {
 	case "udp":
 		listener, err = listenConf.ListenPacket(ctx, "udp", uri.Host)
 	case "unix":
 		listener, err = listenConf.ListenPacket(ctx, "unixgram", uri.Host+uri.Path)
+	case "systemd":
+		listener, err = systemd.PacketConn(uri.Host)
 	default:
-		err = errors.New("syslog listen address must be start with udp:// or unix://")
+		err = errors.New("syslog listen address must be start with udp://, tcp://, unix:// or systemd://")
 	}
 
 	if err != nil {
 		return Syslog{}, fmt.Errorf("could not listen syslog server on '%s': %w", listenAddr, err)
 	}
 
+	if uri.Scheme == "unix" {
+		if err = syslogServer.setSocketPermissions(uri.Host + uri.Path); err != nil {
+			_ = listener.Close()
+			_ = os.Remove(uri.Host + uri.Path)
+
+			return Syslog{}, err
+		}
+	}
+
 	conn, ok := listener.(packetReader)
 	if !ok {
 		_ = listener.Close()
@@ -76,18 +207,21 @@ func New(ctx context.Context, logger *slog.Logger, listenAddr string, msgCh chan
 	return syslogServer, nil
 }
 
-//nolint:gocognit,cyclop
+// Start reads messages until the server is closed.
 func (s *Syslog) Start() error {
+	if s.listener != nil {
+		return s.startStream()
+	}
+
 	con := s.con
 	msgCh := s.msgCh
 	done := s.done
 
 	for {
 		buffer, _ := s.bufferPool.Get().(*packetBuffer)
-		msg := buffer[:]
 
 		// The sender address is unused, so prefer Read over ReadFrom to avoid address allocation.
-		n, err := con.Read(msg)
+		n, err := con.Read(*buffer)
 		if err != nil {
 			s.bufferPool.Put(buffer)
 
@@ -112,72 +246,170 @@ func (s *Syslog) Start() error {
 			continue
 		}
 
-		if n <= 0 {
-			// Ignore empty messages
-			s.bufferPool.Put(buffer)
-
-			continue
+		// A datagram filling the whole buffer was most likely cut off.
+		if n == len(*buffer) {
+			s.truncatedMessage()
 		}
 
-		// Ignore messages not starting with '<'
-		if msg[0] != '<' {
+		message, ok := s.parseMessage(buffer, n)
+		s.countMessage(ok)
+
+		if !ok {
 			s.bufferPool.Put(buffer)
 
 			continue
 		}
 
-		// Ignore trailing control characters and NULs
-		//nolint:revive
-		for ; (n > 0) && (msg[n-1] < 32); n-- {
+		select {
+		case msgCh <- message:
+		case <-done:
+			message.Release()
+
+			return nil
 		}
+	}
+}
+
+// parseMessage extracts the message from the first n bytes of buffer, which hold a single syslog message.
+// It reports false if the message is invalid, in which case the buffer is not used.
+//
+//nolint:gocognit,cyclop
+func (s *Syslog) parseMessage(buffer *packetBuffer, n int) (Message, bool) {
+	msg := *buffer
+
+	if n <= 0 {
+		// Ignore empty messages
+		return Message{}, false
+	}
+
+	// Ignore messages not starting with '<'
+	if msg[0] != '<' {
+		return Message{}, false
+	}
+
+	// Ignore trailing control characters and NULs
+	//nolint:revive
+	for ; (n > 0) && (msg[n-1] < 32); n-- {
+	}
 
-		// msg may contain a syslog message with a header like "<34>Oct 11 22:14:15 nginx: "
-		// We need to find the first occurrence of ": " to extract the actual message.
-		// Find the index after the third occurrence of ':' (optionally followed by a space).
-		colonCount := 0
-		messageStart := -1
-
-		for i, b := range msg[:n] {
-			if b == ':' {
-				colonCount++
-				if colonCount == 3 {
-					messageStart = i + 1
-					// Optionally, check for a space after the colon
-					if messageStart < n && msg[messageStart] == ' ' {
-						messageStart++
-					}
-
-					break
+	// msg may contain a syslog message with a header like "<34>Oct 11 22:14:15 nginx: "
+	// We need to find the first occurrence of ": " to extract the actual message.
+	// Find the index after the third occurrence of ':' (optionally followed by a space).
+	colonCount := 0
+	messageStart := -1
+	tagEnd := -1
+
+	for i, b := range msg[:n] {
+		if b == ':' {
+			colonCount++
+			if colonCount == 3 {
+				tagEnd = i
+				messageStart = i + 1
+				// Optionally, check for a space after the colon
+				if messageStart < n && msg[messageStart] == ' ' {
+					messageStart++
 				}
+
+				break
 			}
 		}
+	}
+
+	if messageStart == -1 {
+		return Message{}, false // fewer than 4 colons found
+	}
 
+	if s.keepTag {
+		messageStart = prependTag(msg[:n], tagEnd, messageStart)
 		if messageStart == -1 {
-			s.bufferPool.Put(buffer)
+			return Message{}, false // no tag found
+		}
+	}
 
-			continue // fewer than 4 colons found
+	if s.keepTimestamp {
+		messageStart = prependTimestamp(msg[:n], messageStart)
+		if messageStart == -1 {
+			return Message{}, false // no timestamp found
 		}
+	}
 
-		// Now msg[messageStart:n] contains the message after the third colon (and space, if present).
-		message := newMessage(buffer, messageStart, n, s.bufferPool)
+	// Now msg[messageStart:n] contains the message after the third colon (and space, if present).
+	return newMessage(buffer, messageStart, n, s.bufferPool), true
+}
 
-		select {
-		case msgCh <- message:
-		case <-done:
-			message.Release()
+// prependTimestamp copies the RFC3164 timestamp following the PRI part of the header
+// in front of the message, separated by a tab. It reuses the space of the header, so no allocation is required.
+// It returns the new start of the message or -1 if the header does not contain a timestamp.
+func prependTimestamp(msg []byte, messageStart int) int {
+	timestampStart := bytes.IndexByte(msg[:messageStart], '>') + 1
+	if timestampStart == 0 || timestampStart+timestampLength >= messageStart {
+		return -1
+	}
 
-			return nil
-		}
+	newStart := messageStart - timestampLength - 1
+
+	copy(msg[newStart:], msg[timestampStart:timestampStart+timestampLength])
+	msg[messageStart-1] = '\t'
+
+	return newStart
+}
+
+// prependTag copies the tag preceding the colon at tagEnd in front of the message, separated by a tab.
+// A process ID suffix like "[123]" is stripped. It reuses the space of the header, so no allocation is required.
+// It returns the new start of the message or -1 if the header does not contain a tag.
+func prependTag(msg []byte, tagEnd, messageStart int) int {
+	tagStart := bytes.LastIndexByte(msg[:tagEnd], ' ') + 1
+	if tagStart == 0 {
+		return -1
+	}
+
+	if pidStart := bytes.IndexByte(msg[tagStart:tagEnd], '['); pidStart != -1 {
+		tagEnd = tagStart + pidStart
 	}
+
+	if tagStart == tagEnd {
+		return -1
+	}
+
+	newStart := messageStart - (tagEnd - tagStart) - 1
+
+	copy(msg[newStart:], msg[tagStart:tagEnd])
+	msg[messageStart-1] = '\t'
+
+	return newStart
+}
+
+// Addr returns the address the server listens on, e.g. to find the port chosen for port 0.
+func (s *Syslog) Addr() net.Addr {
+	if s.listener != nil {
+		return s.listener.Addr()
+	}
+
+	return s.con.LocalAddr()
 }
 
 func (s *Syslog) Close(ctx context.Context) error {
-	if s.con == nil {
+	if s.con == nil && s.listener == nil {
 		return errors.New("syslog server is not initialized")
 	}
 
 	close(s.done)
 
+	if s.listener != nil {
+		err := s.listener.Close()
+
+		// Close the open connections and wait until their messages are handed over.
+		s.streams.close()
+
+		if err != nil {
+			return fmt.Errorf("could not stop syslog server: %w", err)
+		}
+
+		s.logger.InfoContext(ctx, "syslog server shutdown complete")
+
+		return nil
+	}
+
 	err := s.con.Close()
 	if err != nil {
 		return fmt.Errorf("could not stop syslog server: %w", err)
@@ -1,13 +1,30 @@
 package syslog_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"io"
 	"log/slog"
 	syslogclient "log/syslog"
+	"math/big"
 	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jkroepke/access-log-exporter/internal/syslog"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/nettest"
 )
@@ -89,6 +106,553 @@ func TestSyslogServerRawMessage(t *testing.T) {
 	require.Equal(t, logMessage, readMessage(t, logBuffer))
 }
 
+func TestSyslogServerTCP(t *testing.T) {
+	t.Parallel()
+
+	logBuffer := make(chan syslog.Message, 3)
+
+	server, err := syslog.New(t.Context(), slog.New(slog.DiscardHandler), "tcp://127.0.0.1:0", logBuffer)
+	require.NoError(t, err)
+
+	serverErr := make(chan error, 1)
+
+	go func() {
+		serverErr <- server.Start()
+	}()
+
+	var dial net.Dialer
+
+	syslogClient, err := dial.DialContext(t.Context(), "tcp", server.Addr().String())
+	require.NoError(t, err)
+
+	// Messages are delimited by newlines, independent of how they are split into writes.
+	_, err = syslogClient.Write([]byte("<190>Aug 15 20:16:01 nginx: localhost:8080\tGET\t200\n<190>Aug 15 20:16:02 nginx: local"))
+	require.NoError(t, err)
+
+	_, err = syslogClient.Write([]byte("host:8080\tGET\t404\r\n"))
+	require.NoError(t, err)
+
+	// A message longer than the buffer is truncated, the next one is read as usual.
+	_, err = syslogClient.Write([]byte("<190>Aug 15 20:16:03 nginx: " + strings.Repeat("a", 5000) + "\n<190>Aug 15 20:16:04 nginx: localhost:8080\tPOST\t201\n"))
+	require.NoError(t, err)
+
+	require.Equal(t, "localhost:8080\tGET\t200", readMessage(t, logBuffer))
+	require.Equal(t, "localhost:8080\tGET\t404", readMessage(t, logBuffer))
+	require.Len(t, readMessage(t, logBuffer), 4096-len("<190>Aug 15 20:16:03 nginx: "))
+	require.Equal(t, "localhost:8080\tPOST\t201", readMessage(t, logBuffer))
+
+	// Close shuts down the open connection as well.
+	require.NoError(t, server.Close(t.Context()))
+	require.NoError(t, <-serverErr)
+
+	require.NoError(t, syslogClient.SetReadDeadline(time.Now().Add(time.Second)))
+
+	_, err = syslogClient.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestSyslogServerTCPOctetCounting(t *testing.T) {
+	t.Parallel()
+
+	logBuffer := make(chan syslog.Message, 4)
+
+	server, err := syslog.New(t.Context(), slog.New(slog.DiscardHandler), "tcp://127.0.0.1:0", logBuffer)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(t.Context()))
+	})
+
+	go func() {
+		_ = server.Start()
+	}()
+
+	var dial net.Dialer
+
+	syslogClient, err := dial.DialContext(t.Context(), "tcp", server.Addr().String())
+	require.NoError(t, err)
+
+	first := "<190>Aug 15 20:16:01 nginx: localhost:8080\tGET\t200\nsecond line"
+	second := "<190>Aug 15 20:16:02 nginx: localhost:8080\tGET\t404"
+
+	// Octet-counted messages may contain newlines and are sent back-to-back, optionally mixed with newline framing.
+	_, err = fmt.Fprintf(syslogClient, "%d %s%d %s\n<190>Aug 15 20:16:03 nginx: localhost:8080\tPOST\t201\n",
+		len(first), first, len(second), second)
+	require.NoError(t, err)
+
+	require.Equal(t, "localhost:8080\tGET\t200\nsecond line", readMessage(t, logBuffer))
+	require.Equal(t, "localhost:8080\tGET\t404", readMessage(t, logBuffer))
+	require.Equal(t, "localhost:8080\tPOST\t201", readMessage(t, logBuffer))
+
+	// A message longer than the buffer is truncated, the next one is read as usual.
+	long := "<190>Aug 15 20:16:04 nginx: " + strings.Repeat("a", 5000)
+
+	_, err = fmt.Fprintf(syslogClient, "%d %s%d %s", len(long), long, len(second), second)
+	require.NoError(t, err)
+
+	require.Len(t, readMessage(t, logBuffer), 4096-len("<190>Aug 15 20:16:04 nginx: "))
+	require.Equal(t, "localhost:8080\tGET\t404", readMessage(t, logBuffer))
+}
+
+func TestSyslogServerTCPGzipFrames(t *testing.T) {
+	t.Parallel()
+
+	metrics := syslog.NewMetrics()
+	logBuffer := make(chan syslog.Message, 4)
+
+	server, err := syslog.New(t.Context(), slog.New(slog.DiscardHandler), "tcp://127.0.0.1:0", logBuffer,
+		syslog.WithGzipFrames(true),
+		syslog.WithMetrics(metrics),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(t.Context()))
+	})
+
+	go func() {
+		_ = server.Start()
+	}()
+
+	var dial net.Dialer
+
+	syslogClient, err := dial.DialContext(t.Context(), "tcp", server.Addr().String())
+	require.NoError(t, err)
+
+	compress := func(message string) []byte {
+		t.Helper()
+
+		var buf bytes.Buffer
+
+		writer := gzip.NewWriter(&buf)
+
+		_, err := writer.Write([]byte(message))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		return buf.Bytes()
+	}
+
+	compressed := compress("<190>Aug 15 20:16:01 nginx: localhost:8080\tGET\t200\nsecond line")
+	plain := "<190>Aug 15 20:16:02 nginx: localhost:8080\tGET\t404"
+	// Compresses well below the maximum message size, but expands beyond it.
+	large := compress("<190>Aug 15 20:16:03 nginx: " + strings.Repeat("a", 10000))
+	invalid := append([]byte{0x1f, 0x8b}, "not gzip"...)
+
+	for _, frame := range [][]byte{compressed, []byte(plain), large, invalid} {
+		_, err = fmt.Fprintf(syslogClient, "%d %s", len(frame), frame)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, "localhost:8080\tGET\t200\nsecond line", readMessage(t, logBuffer))
+	require.Equal(t, "localhost:8080\tGET\t404", readMessage(t, logBuffer))
+	require.Len(t, readMessage(t, logBuffer), 4096-len("<190>Aug 15 20:16:03 nginx: "))
+
+	// Newline framing closes the connection, since compressed data may contain newlines.
+	_, err = syslogClient.Write([]byte(plain + "\n"))
+	require.NoError(t, err)
+
+	require.NoError(t, syslogClient.SetReadDeadline(time.Now().Add(time.Second)))
+
+	_, err = syslogClient.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+
+	expected := fmt.Sprintf(`
+# HELP syslog_messages_invalid_total Total number of received syslog messages skipped per listener because they are not valid syslog messages
+# TYPE syslog_messages_invalid_total counter
+syslog_messages_invalid_total{listener=%[1]q} 1
+# HELP syslog_truncated_messages_total Total number of received syslog messages per listener truncated because they exceed the maximum message size
+# TYPE syslog_truncated_messages_total counter
+syslog_truncated_messages_total{listener=%[1]q} 1
+`, "tcp://127.0.0.1:0")
+
+	require.NoError(t, testutil.CollectAndCompare(metrics, strings.NewReader(expected),
+		"syslog_messages_invalid_total", "syslog_truncated_messages_total"))
+
+	_, err = syslog.New(t.Context(), slog.New(slog.DiscardHandler), "udp://127.0.0.1:0", logBuffer, syslog.WithGzipFrames(true))
+	require.EqualError(t, err, "syslog gzip frames require a tcp:// listen address, got 'udp://127.0.0.1:0'")
+}
+
+func TestSyslogServerTLS(t *testing.T) {
+	t.Parallel()
+
+	certFile, keyFile, cert := writeTestCertificate(t)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(cert.Leaf)
+
+	for _, tc := range []struct {
+		name         string
+		clientCAFile string
+	}{
+		{name: "TLS"},
+		{name: "mutual TLS", clientCAFile: certFile},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			logBuffer := make(chan syslog.Message, 1)
+
+			server, err := syslog.New(t.Context(), slog.New(slog.DiscardHandler), "tcp://127.0.0.1:0", logBuffer,
+				syslog.WithTLS(certFile, keyFile, tc.clientCAFile),
+			)
+			require.NoError(t, err)
+
+			t.Cleanup(func() {
+				require.NoError(t, server.Close(t.Context()))
+			})
+
+			go func() {
+				_ = server.Start()
+			}()
+
+			// The self-signed certificate doubles as client certificate.
+			dialer := tls.Dialer{Config: &tls.Config{
+				RootCAs:      rootCAs,
+				Certificates: []tls.Certificate{cert},
+				MinVersion:   tls.VersionTLS12,
+			}}
+
+			tlsClient, err := dialer.DialContext(t.Context(), "tcp", server.Addr().String())
+			require.NoError(t, err)
+
+			_, err = tlsClient.Write([]byte("<190>Aug 15 20:16:01 nginx: localhost:8080\tGET\t200\n"))
+			require.NoError(t, err)
+
+			require.Equal(t, "localhost:8080\tGET\t200", readMessage(t, logBuffer))
+
+			var dial net.Dialer
+
+			plainClient, err := dial.DialContext(t.Context(), "tcp", server.Addr().String())
+			require.NoError(t, err)
+
+			_, err = plainClient.Write([]byte("<190>Aug 15 20:16:01 nginx: localhost:8080\tGET\t200\n"))
+			require.NoError(t, err)
+
+			// The server closes the connection after the failed handshake, without accepting the message.
+			require.NoError(t, plainClient.SetReadDeadline(time.Now().Add(time.Second)))
+
+			_, err = io.ReadAll(plainClient)
+			require.NoError(t, err)
+			require.Empty(t, logBuffer)
+
+			if tc.clientCAFile == "" {
+				return
+			}
+
+			// With a client CA, clients without certificate are rejected.
+			dialer.Config.Certificates = nil
+
+			tlsClient, err = dialer.DialContext(t.Context(), "tcp", server.Addr().String())
+			require.NoError(t, err)
+
+			_, err = tlsClient.Write([]byte("<190>Aug 15 20:16:01 nginx: localhost:8080\tGET\t200\n"))
+			require.NoError(t, err)
+
+			_, err = tlsClient.Read(make([]byte, 1))
+			require.Error(t, err)
+			require.Empty(t, logBuffer)
+		})
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1, usable by servers and clients, to a temporary directory.
+func writeTestCertificate(t *testing.T) (string, string, tls.Certificate) {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "access-log-exporter"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	certFile := filepath.Join(t.TempDir(), "cert.pem")
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	return certFile, keyFile, cert
+}
+
+func TestSyslogServerMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := syslog.NewMetrics()
+	logBuffer := make(chan syslog.Message, 3)
+	listenAddrs := make([]string, 2)
+
+	for i := range listenAddrs {
+		unixSocket, err := nettest.LocalPath()
+		require.NoError(t, err)
+
+		listenAddrs[i] = "unix://" + unixSocket
+
+		server, err := syslog.New(t.Context(), slog.New(slog.DiscardHandler), listenAddrs[i], logBuffer, syslog.WithMetrics(metrics))
+		require.NoError(t, err)
+
+		t.Cleanup(func() {
+			require.NoError(t, server.Close(t.Context()))
+		})
+
+		go func() {
+			_ = server.Start()
+		}()
+	}
+
+	var dial net.Dialer
+
+	for i, messages := range [][]string{
+		{"<190>Aug 15 20:16:01 nginx: first", "<190>Aug 15 20:16:01 nginx: second"},
+		{"<190>Aug 15 20:16:01 nginx: third", "invalid"},
+	} {
+		syslogClient, err := dial.DialContext(t.Context(), "unixgram", strings.TrimPrefix(listenAddrs[i], "unix://"))
+		require.NoError(t, err)
+
+		for _, message := range messages {
+			_, err = syslogClient.Write([]byte(message))
+			require.NoError(t, err)
+		}
+	}
+
+	for range 3 {
+		readMessage(t, logBuffer)
+	}
+
+	expected := fmt.Sprintf(`
+# HELP syslog_messages_invalid_total Total number of received syslog messages skipped per listener because they are not valid syslog messages
+# TYPE syslog_messages_invalid_total counter
+syslog_messages_invalid_total{listener=%[1]q} 0
+syslog_messages_invalid_total{listener=%[2]q} 1
+# HELP syslog_messages_received_total Total number of syslog messages received per listener
+# TYPE syslog_messages_received_total counter
+syslog_messages_received_total{listener=%[1]q} 2
+syslog_messages_received_total{listener=%[2]q} 2
+# HELP syslog_truncated_messages_total Total number of received syslog messages per listener truncated because they exceed the maximum message size
+# TYPE syslog_truncated_messages_total counter
+syslog_truncated_messages_total{listener=%[1]q} 0
+syslog_truncated_messages_total{listener=%[2]q} 0
+`, listenAddrs[0], listenAddrs[1])
+
+	// The invalid message may be read after the valid ones of the other listener.
+	require.Eventually(t, func() bool {
+		return testutil.CollectAndCompare(metrics, strings.NewReader(expected)) == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSyslogServerMaxMessageSize(t *testing.T) {
+	t.Parallel()
+
+	unixSocket, err := nettest.LocalPath()
+	require.NoError(t, err)
+
+	metrics := syslog.NewMetrics()
+	logBuffer := make(chan syslog.Message, 2)
+
+	server, err := syslog.New(t.Context(), slog.New(slog.DiscardHandler), "unix://"+unixSocket, logBuffer,
+		syslog.WithMaxMessageSize(8192),
+		syslog.WithMetrics(metrics),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(t.Context()))
+	})
+
+	go func() {
+		_ = server.Start()
+	}()
+
+	var dial net.Dialer
+
+	syslogClient, err := dial.DialContext(t.Context(), "unixgram", unixSocket)
+	require.NoError(t, err)
+
+	// A message longer than the default size arrives whole.
+	_, err = syslogClient.Write([]byte("<190>Aug 15 20:16:01 nginx: " + strings.Repeat("a", 5000)))
+	require.NoError(t, err)
+
+	require.Equal(t, strings.Repeat("a", 5000), readMessage(t, logBuffer))
+
+	// A message longer than the configured size is truncated and counted.
+	_, err = syslogClient.Write([]byte("<190>Aug 15 20:16:01 nginx: " + strings.Repeat("a", 10000)))
+	require.NoError(t, err)
+
+	require.Len(t, readMessage(t, logBuffer), 8192-len("<190>Aug 15 20:16:01 nginx: "))
+
+	expected := fmt.Sprintf(`
+# HELP syslog_truncated_messages_total Total number of received syslog messages per listener truncated because they exceed the maximum message size
+# TYPE syslog_truncated_messages_total counter
+syslog_truncated_messages_total{listener=%q} 1
+`, "unix://"+unixSocket)
+
+	require.NoError(t, testutil.CollectAndCompare(metrics, strings.NewReader(expected), "syslog_truncated_messages_total"))
+}
+
+func TestSyslogServerSocketPermissions(t *testing.T) {
+	t.Parallel()
+
+	currentUser, err := user.Current()
+	require.NoError(t, err)
+
+	unixSocket, err := nettest.LocalPath()
+	require.NoError(t, err)
+
+	// The current user and group are the only owners allowed without privileges.
+	server, err := syslog.New(t.Context(), slog.New(slog.DiscardHandler), "unix://"+unixSocket, make(chan syslog.Message),
+		syslog.WithSocketPermissions(0o666, currentUser.Username, currentUser.Gid),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(t.Context()))
+	})
+
+	info, err := os.Stat(unixSocket)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o666), info.Mode().Perm())
+
+	// The socket is removed again if its owner can't be set.
+	unixSocket, err = nettest.LocalPath()
+	require.NoError(t, err)
+
+	_, err = syslog.New(t.Context(), slog.New(slog.DiscardHandler), "unix://"+unixSocket, make(chan syslog.Message),
+		syslog.WithSocketPermissions(0, "access-log-exporter-unknown-user", ""),
+	)
+	require.ErrorContains(t, err, "could not look up owner of syslog socket")
+	require.NoFileExists(t, unixSocket)
+}
+
+func TestSyslogServerKeepTimestamp(t *testing.T) {
+	t.Parallel()
+
+	unixSocket, err := nettest.LocalPath()
+	require.NoError(t, err)
+
+	logBuffer := make(chan syslog.Message, 1)
+
+	server, err := syslog.New(t.Context(), slog.New(slog.DiscardHandler), "unix://"+unixSocket, logBuffer, syslog.WithKeepTimestamp(true))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, server.Close(t.Context()))
+	})
+
+	var serverErr error
+
+	go func() {
+		serverErr = server.Start()
+	}()
+
+	t.Cleanup(func() {
+		require.NoError(t, serverErr)
+	})
+
+	var dial net.Dialer
+
+	syslogClient, err := dial.DialContext(t.Context(), "unixgram", unixSocket)
+	require.NoError(t, err)
+
+	_, err = syslogClient.Write([]byte("<190>Aug 15 20:16:01 nginx: localhost:8080\tGET\t404"))
+	require.NoError(t, err)
+
+	fields := strings.Split(readMessage(t, logBuffer), "\t")
+	require.Equal(t, []string{"Aug 15 20:16:01", "localhost:8080", "GET", "404"}, fields)
+
+	timestamp, err := time.Parse(time.Stamp, fields[0])
+	require.NoError(t, err)
+	require.Equal(t, time.August, timestamp.Month())
+	require.Equal(t, 15, timestamp.Day())
+}
+
+func TestSyslogServerKeepTag(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name          string
+		message       string
+		fields        []string
+		keepTimestamp bool
+	}{
+		{
+			name:    "tag",
+			message: "<190>Aug 15 20:16:01 nginx: localhost:8080\tGET\t404",
+			fields:  []string{"nginx", "localhost:8080", "GET", "404"},
+		},
+		{
+			name:    "tag with hostname and pid",
+			message: "<190>Aug 15 20:16:01 web01 apache[1234]: localhost:8080\tGET\t404",
+			fields:  []string{"apache", "localhost:8080", "GET", "404"},
+		},
+		{
+			name:          "tag with timestamp",
+			message:       "<190>Aug 15 20:16:01 nginx:localhost:8080\tGET\t404",
+			fields:        []string{"Aug 15 20:16:01", "nginx", "localhost:8080", "GET", "404"},
+			keepTimestamp: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			unixSocket, err := nettest.LocalPath()
+			require.NoError(t, err)
+
+			logBuffer := make(chan syslog.Message, 1)
+
+			server, err := syslog.New(t.Context(), slog.New(slog.DiscardHandler), "unix://"+unixSocket, logBuffer,
+				syslog.WithKeepTag(true),
+				syslog.WithKeepTimestamp(tc.keepTimestamp),
+			)
+			require.NoError(t, err)
+
+			t.Cleanup(func() {
+				require.NoError(t, server.Close(t.Context()))
+			})
+
+			var serverErr error
+
+			go func() {
+				serverErr = server.Start()
+			}()
+
+			t.Cleanup(func() {
+				require.NoError(t, serverErr)
+			})
+
+			var dial net.Dialer
+
+			syslogClient, err := dial.DialContext(t.Context(), "unixgram", unixSocket)
+			require.NoError(t, err)
+
+			_, err = syslogClient.Write([]byte(tc.message))
+			require.NoError(t, err)
+
+			require.Equal(t, tc.fields, strings.Split(readMessage(t, logBuffer), "\t"))
+		})
+	}
+}
+
 func TestSyslogServerWithInvalidMessages(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,87 @@
+// Package systemd provides access to sockets passed by systemd socket activation.
+package systemd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/coreos/go-systemd/v22/activation"
+)
+
+// ErrNoSocket is returned if no matching activation socket was passed by systemd.
+var ErrNoSocket = errors.New("no matching systemd activation socket")
+
+//nolint:gochecknoglobals // activation sockets are process-wide and can only be taken over once.
+var (
+	mu        sync.Mutex
+	files     []*os.File
+	filesOnce sync.Once
+)
+
+// Listener returns a stream listener for the activation socket with the given name.
+// An empty name selects the first activation socket that is not used yet.
+func Listener(name string) (net.Listener, error) {
+	file, err := takeFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// FileListener duplicates the file descriptor, so the original can be closed.
+	listener, err := net.FileListener(file)
+	_ = file.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("could not use systemd activation socket '%s' as listener: %w", file.Name(), err)
+	}
+
+	return listener, nil
+}
+
+// PacketConn returns a packet connection for the activation socket with the given name.
+// An empty name selects the first activation socket that is not used yet.
+func PacketConn(name string) (net.PacketConn, error) {
+	file, err := takeFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.FilePacketConn(file)
+	_ = file.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("could not use systemd activation socket '%s' as packet connection: %w", file.Name(), err)
+	}
+
+	return conn, nil
+}
+
+// takeFile removes the activation socket with the given name from the pool, so each socket is used once.
+func takeFile(name string) (*os.File, error) {
+	filesOnce.Do(func() {
+		files = activation.Files(true)
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	index := slices.IndexFunc(files, func(file *os.File) bool {
+		return name == "" || file.Name() == name
+	})
+
+	if index == -1 {
+		if name == "" {
+			return nil, ErrNoSocket
+		}
+
+		return nil, fmt.Errorf("%w: '%s'", ErrNoSocket, name)
+	}
+
+	file := files[index]
+	files = slices.Delete(files, index, index+1)
+
+	return file, nil
+}
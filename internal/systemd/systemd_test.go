@@ -0,0 +1,85 @@
+package systemd_test
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/jkroepke/access-log-exporter/internal/systemd"
+	"github.com/stretchr/testify/require"
+)
+
+// activationEnv marks the child process that runs with sockets passed like systemd does.
+const activationEnv = "ACCESS_LOG_EXPORTER_TEST_SYSTEMD_ACTIVATION"
+
+func TestActivation(t *testing.T) {
+	if os.Getenv(activationEnv) != "" {
+		testActivationChild(t)
+
+		return
+	}
+
+	if runtime.GOOS == "windows" {
+		t.Skip("systemd socket activation is not supported on windows")
+	}
+
+	var listenConf net.ListenConfig
+
+	listener, err := listenConf.Listen(t.Context(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	packetConn, err := listenConf.ListenPacket(t.Context(), "udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = packetConn.Close()
+	})
+
+	listenerFile, err := listener.(*net.TCPListener).File()
+	require.NoError(t, err)
+
+	packetConnFile, err := packetConn.(*net.UDPConn).File()
+	require.NoError(t, err)
+
+	// Simulate the activation environment: sockets start at fd 3 in the order of ExtraFiles.
+	cmd := exec.CommandContext(t.Context(), os.Args[0], "-test.run=^TestActivation$", "-test.v")
+	cmd.ExtraFiles = []*os.File{listenerFile, packetConnFile}
+	cmd.Env = append(os.Environ(),
+		activationEnv+"=1",
+		"LISTEN_FDS=2",
+		"LISTEN_FDNAMES=web:syslog",
+		"TEST_WEB_ADDR="+listener.Addr().String(),
+		"TEST_SYSLOG_ADDR="+packetConn.LocalAddr().String(),
+	)
+
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func testActivationChild(t *testing.T) {
+	t.Helper()
+
+	// LISTEN_PID is set by systemd after forking, which can only be simulated from within the child.
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+
+	packetConn, err := systemd.PacketConn("syslog")
+	require.NoError(t, err)
+	require.Equal(t, os.Getenv("TEST_SYSLOG_ADDR"), packetConn.LocalAddr().String())
+	require.NoError(t, packetConn.Close())
+
+	listener, err := systemd.Listener("")
+	require.NoError(t, err)
+	require.Equal(t, os.Getenv("TEST_WEB_ADDR"), listener.Addr().String())
+	require.NoError(t, listener.Close())
+
+	// Each activation socket can only be taken over once.
+	_, err = systemd.Listener("web")
+	require.ErrorIs(t, err, systemd.ErrNoSocket)
+}